@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/backup"
+	"github.com/rs/zerolog/log"
+)
+
+// newBackupStore returns the backup store of the directory with its retention policy, a nil store when no
+// directory is given.
+func newBackupStore(dir string, keepDays int, maxSizeMiB int) (*backup.Store, backup.Retention, error) {
+	if keepDays < 0 {
+		return nil, backup.Retention{}, fmt.Errorf("invalid backup-keep-days value %d, it can't be negative", keepDays)
+	}
+	if maxSizeMiB < 0 {
+		return nil, backup.Retention{}, fmt.Errorf("invalid backup-max-size value %d, it can't be negative", maxSizeMiB)
+	}
+	retention := backup.Retention{
+		MaxAge:  time.Duration(keepDays) * 24 * time.Hour,
+		MaxSize: int64(maxSizeMiB) << 20,
+	}
+	if dir == "" {
+		return nil, retention, nil
+	}
+	store, err := backup.New(dir)
+	if err != nil {
+		return nil, retention, err
+	}
+	log.Debug().Str("backup_dir", store.Dir()).Dur("max_age", retention.MaxAge).Int64("max_size", retention.MaxSize).Msg("Backup directory ready")
+	return store, retention, nil
+}
+
+// pruneBackups applies the retention policy to the store, logging the failures as they don't affect the conversions.
+func pruneBackups(store *backup.Store, retention backup.Retention) {
+	if store == nil {
+		return
+	}
+	removed, err := store.Prune(retention)
+	if err != nil {
+		log.Warn().Str("backup_dir", store.Dir()).Err(err).Msg("Failed to apply the backup retention policy")
+		return
+	}
+	if removed > 0 {
+		log.Info().Str("backup_dir", store.Dir()).Int("removed", removed).Msg("Old backups removed")
+	}
+}
@@ -0,0 +1,180 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// stdinArg is the argument standing for the list of paths read from the standard input, one per line.
+const stdinArg = "-"
+
+// resolveInputs turns the arguments into the absolute paths of the files and folders to process. An argument is a
+// path, a glob pattern when no such path exists, or stdinArg. The paths read from stdin are taken literally, as
+// names like "[Group] Title.cbz" would be patterns. Every argument must match something, and each path is returned
+// once.
+func resolveInputs(args []string, stdin io.Reader) ([]string, error) {
+	var inputs []string
+	seen := make(map[string]bool)
+	add := func(path string) error {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return fmt.Errorf("invalid path %s: %w", path, err)
+		}
+		if !seen[absPath] {
+			seen[absPath] = true
+			inputs = append(inputs, absPath)
+		}
+		return nil
+	}
+
+	readStdin := false
+	for _, arg := range args {
+		if arg == stdinArg {
+			if readStdin {
+				continue
+			}
+			readStdin = true
+			scanner := bufio.NewScanner(stdin)
+			for scanner.Scan() {
+				line := strings.TrimSuffix(scanner.Text(), "\r")
+				if line == "" {
+					continue
+				}
+				if _, err := os.Stat(line); err != nil {
+					return nil, fmt.Errorf("invalid path %s read from stdin: %w", line, err)
+				}
+				if err := add(line); err != nil {
+					return nil, err
+				}
+			}
+			if err := scanner.Err(); err != nil {
+				return nil, fmt.Errorf("failed to read paths from stdin: %w", err)
+			}
+			continue
+		}
+
+		if _, err := os.Stat(arg); err == nil {
+			if err := add(arg); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", arg, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no file or folder matches %s", arg)
+		}
+		for _, match := range matches {
+			if err := add(match); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("no file or folder to process")
+	}
+	return inputs, nil
+}
+
+// commonRoot returns the deepest folder holding all the inputs: a folder given alone is its own root, a file
+// is held by its folder.
+func commonRoot(inputs []string) (string, error) {
+	var root string
+	for _, input := range inputs {
+		info, err := os.Stat(input)
+		if err != nil {
+			return "", err
+		}
+		dir := input
+		if !info.IsDir() {
+			dir = filepath.Dir(input)
+		}
+		if root == "" {
+			root = dir
+			continue
+		}
+		for !isWithinDir(root, dir) {
+			parent := filepath.Dir(root)
+			if parent == root {
+				return "", fmt.Errorf("%s and %s have no folder in common", root, input)
+			}
+			root = parent
+		}
+	}
+	return root, nil
+}
+
+// walkInputs calls chapter for every CBZ/CBR file of the inputs, recursing into the folders, and other for the
+// other files of the folders. Overlapping inputs, like a folder and a file or folder inside it, or a symbolic link
+// to another input, give each file once. Skipped paths, and the whole tree of skipped folders, are left out.
+func walkInputs(inputs []string, skip func(path string) bool, chapter func(path string), other func(path string)) error {
+	seen := make(map[string]bool)
+	firstVisit := func(path string) bool {
+		key := path
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			key = resolved
+		}
+		if seen[key] {
+			return false
+		}
+		seen[key] = true
+		return true
+	}
+	isChapter := func(path string) bool {
+		name := strings.ToLower(filepath.Base(path))
+		return strings.HasSuffix(name, ".cbz") || strings.HasSuffix(name, ".cbr")
+	}
+
+	for _, input := range inputs {
+		log.Debug().Str("search_path", input).Msg("Starting filesystem walk for CBZ/CBR files")
+		err := filepath.WalkDir(input, func(filePath string, d fs.DirEntry, err error) error {
+			if err != nil {
+				log.Error().Str("file_path", filePath).Err(err).Msg("Error during filesystem walk")
+				return err
+			}
+			if skip(filePath) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				return nil
+			}
+			if !firstVisit(filePath) {
+				log.Debug().Str("file_path", filePath).Msg("Skipping file already listed")
+				return nil
+			}
+
+			switch {
+			case isChapter(filePath):
+				log.Debug().Str("file_path", filePath).Msg("Found CBZ/CBR file")
+				chapter(filePath)
+			case filePath == input:
+				log.Warn().Str("file_path", filePath).Msg("Not a CBZ/CBR file, skipping it")
+			default:
+				other(filePath)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("error walking %s: %w", input, err)
+		}
+	}
+	return nil
+}
+
+// isWithinDir tells whether path is dir or is under it.
+func isWithinDir(dir string, path string) bool {
+	relative, err := filepath.Rel(dir, path)
+	return err == nil && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator))
+}
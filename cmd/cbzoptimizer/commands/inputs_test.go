@@ -0,0 +1,162 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createFiles creates empty files at the given paths under dir, with their folders.
+func createFiles(t *testing.T, dir string, paths ...string) {
+	for _, path := range paths {
+		path = filepath.Join(dir, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, nil, 0644))
+	}
+}
+
+func TestResolveInputs(t *testing.T) {
+	dir := t.TempDir()
+	createFiles(t, dir,
+		"Series A/Chapter 1.cbz",
+		"Series A/Chapter 2.cbr",
+		"Series B/Chapter 1.cbz",
+		"[Group] Series C - Chapter 1.cbz",
+	)
+	join := func(paths ...string) []string {
+		for i, path := range paths {
+			paths[i] = filepath.Join(dir, path)
+		}
+		return paths
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		stdin    string
+		expected []string
+		err      string
+	}{
+		{
+			name:     "Files and folders",
+			args:     join("Series A", "Series B/Chapter 1.cbz"),
+			expected: join("Series A", "Series B/Chapter 1.cbz"),
+		},
+		{
+			name:     "Glob",
+			args:     join("Series */Chapter 1.cbz"),
+			expected: join("Series A/Chapter 1.cbz", "Series B/Chapter 1.cbz"),
+		},
+		{
+			name:     "Existing path with glob characters",
+			args:     join("[Group] Series C - Chapter 1.cbz"),
+			expected: join("[Group] Series C - Chapter 1.cbz"),
+		},
+		{
+			name:     "Stdin",
+			args:     []string{"-", filepath.Join(dir, "Series B")},
+			stdin:    filepath.Join(dir, "Series A/Chapter 2.cbr") + "\r\n\n" + filepath.Join(dir, "[Group] Series C - Chapter 1.cbz") + "\n",
+			expected: join("Series A/Chapter 2.cbr", "[Group] Series C - Chapter 1.cbz", "Series B"),
+		},
+		{
+			name:     "Duplicates",
+			args:     append(join("Series A", "Series A/../Series A", "Series */"), "-"),
+			stdin:    filepath.Join(dir, "Series B"),
+			expected: join("Series A", "Series B"),
+		},
+		{
+			name: "Missing path",
+			args: join("Series A", "Series D"),
+			err:  "no file or folder matches",
+		},
+		{
+			name:  "Missing path from stdin",
+			args:  []string{"-"},
+			stdin: filepath.Join(dir, "Series D/Chapter 1.cbz"),
+			err:   "read from stdin",
+		},
+		{
+			name:  "Empty stdin",
+			args:  []string{"-"},
+			stdin: "\n",
+			err:   "no file or folder to process",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputs, err := resolveInputs(tt.args, strings.NewReader(tt.stdin))
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, inputs)
+		})
+	}
+}
+
+func TestCommonRoot(t *testing.T) {
+	dir := t.TempDir()
+	createFiles(t, dir, "Library/Series A/Chapter 1.cbz", "Library/Series B/Chapter 1.cbz")
+
+	root, err := commonRoot([]string{filepath.Join(dir, "Library/Series A")})
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "Library/Series A"), root, "a folder is its own root")
+
+	root, err = commonRoot([]string{filepath.Join(dir, "Library/Series A/Chapter 1.cbz")})
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "Library/Series A"), root, "a file is held by its folder")
+
+	root, err = commonRoot([]string{filepath.Join(dir, "Library/Series A"), filepath.Join(dir, "Library/Series B/Chapter 1.cbz")})
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "Library"), root)
+
+	_, err = commonRoot([]string{filepath.Join(dir, "Library/Series C")})
+	assert.Error(t, err)
+}
+
+func TestWalkInputs(t *testing.T) {
+	dir := t.TempDir()
+	createFiles(t, dir,
+		"Series A/Chapter 1.cbz",
+		"Series A/Volume 1/Chapter 2.CBR",
+		"Series A/cover.jpg",
+		"Series A/backups/Chapter 1.cbz",
+		"Series B/Chapter 1.cbz",
+		"notes.txt",
+	)
+	require.NoError(t, os.Symlink(filepath.Join(dir, "Series B/Chapter 1.cbz"), filepath.Join(dir, "link.cbz")))
+
+	inputs := []string{
+		filepath.Join(dir, "Series A/Chapter 1.cbz"),
+		filepath.Join(dir, "Series A"),
+		filepath.Join(dir, "Series A/Volume 1"),
+		filepath.Join(dir, "Series B/Chapter 1.cbz"),
+		filepath.Join(dir, "link.cbz"),
+		filepath.Join(dir, "notes.txt"),
+	}
+	var chapters, others []string
+	err := walkInputs(inputs, func(path string) bool {
+		return filepath.Base(path) == "backups"
+	}, func(path string) {
+		chapters = append(chapters, path)
+	}, func(path string) {
+		others = append(others, path)
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		filepath.Join(dir, "Series A/Chapter 1.cbz"),
+		filepath.Join(dir, "Series A/Volume 1/Chapter 2.CBR"),
+		filepath.Join(dir, "Series B/Chapter 1.cbz"),
+	}, chapters, "each chapter is listed once")
+	assert.Equal(t, []string{filepath.Join(dir, "Series A/cover.jpg")}, others, "the files given as inputs aren't other files")
+
+	err = walkInputs([]string{filepath.Join(dir, "missing")}, func(string) bool { return false }, func(string) {}, func(string) {})
+	assert.Error(t, err)
+}
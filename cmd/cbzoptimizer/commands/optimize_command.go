@@ -1,29 +1,35 @@
 package commands
 
 import (
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
 	"sync"
 
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/cbz"
 	utils2 "github.com/danielkitchener/CBZOptimizer/v2/internal/utils"
 	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter"
 	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/constant"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/webp"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 	"github.com/thediveo/enumflag/v2"
 )
 
 var converterType constant.ConversionFormat
 
+// configFlags are the optimize flags also read from the config file.
+var configFlags = []string{"split-height", "crop-height", "effort", "webp-preset", "webp-sharp-yuv", "webp-auto-filter", "webp-near-lossless"}
+
 func init() {
 	command := &cobra.Command{
-		Use:   "optimize [folder]",
-		Short: "Optimize all CBZ/CBR files in a folder recursively",
-		Long:  "Optimize all CBZ/CBR files in a folder recursively.\nIt will take all the different pages in the CBZ/CBR files and convert them to the given format.\nThe original CBZ/CBR files will be kept intact depending if you choose to override or not.",
+		Use:   "optimize [files or folders...]",
+		Short: "Optimize CBZ/CBR files, and all the ones in folders recursively",
+		Long:  "Optimize CBZ/CBR files, and all the ones in folders recursively.\nThe arguments can be any mix of files, folders and glob patterns, and - reads a list of paths from stdin, one per line.\nIt will take all the different pages in the CBZ/CBR files and convert them to the given format.\nThe original CBZ/CBR files will be kept intact depending if you choose to override or not.",
 		RunE:  ConvertCbzCommand,
-		Args:  cobra.ExactArgs(1),
+		Args:  cobra.MinimumNArgs(1),
 	}
 	formatFlag := enumflag.New(&converterType, "format", constant.CommandValue, enumflag.EnumCaseInsensitive)
 	_ = formatFlag.RegisterCompletion(command, "format", constant.HelpText)
@@ -41,6 +47,48 @@ func init() {
 		"format", "f",
 		fmt.Sprintf("Format to convert the images to: %s", constant.ListAll()))
 	command.PersistentFlags().Lookup("format").NoOptDefVal = constant.DefaultConversion.String()
+	command.Flags().Float64("min-page-savings", 0, "Keep the original page unless the converted one is smaller by this ratio (0-1)")
+	command.Flags().Float64("min-chapter-savings", 0, "Don't rewrite the chapter unless it gets smaller by this ratio (0-1)")
+	command.Flags().String("webp-backend", webp.AutoBackend, fmt.Sprintf("WebP encoder backend: %s", strings.Join(append([]string{webp.AutoBackend}, webp.Backends()...), ", ")))
+	command.Flags().Int("split-height", 0, "Height from which a page is split when splitting, 0 uses the format default")
+	command.Flags().String("split-mode", string(options.SplitFixed), fmt.Sprintf("How split pages are cut: %s cuts every crop height, %s moves the cuts to the nearest gutter", options.SplitFixed, options.SplitSmart))
+	command.Flags().String("spreads", string(options.SpreadKeep), fmt.Sprintf("What to do with double page spreads (pages wider than tall): %s", strings.Join(spreadModeNames(), ", ")))
+	command.Flags().String("animations", string(options.AnimationKeep), fmt.Sprintf("What to do with animated pages (GIF, WebP or PNG with several frames): %s keeps them as they are, %s encodes them to animations of the target format, except jxl", options.AnimationKeep, options.AnimationConvert))
+	command.Flags().String("backup-dir", "", "Directory the originals replaced or deleted by --override are moved to, under their absolute path, to be put back with the restore command")
+	command.Flags().Int("backup-keep-days", 0, "Remove the backups older than this many days, 0 keeps them forever")
+	command.Flags().Int("backup-max-size", 0, "Remove the oldest backups once the backup directory is bigger than this many MiB, 0 for no limit")
+	command.Flags().String("output-dir", "", "Write the converted chapters to this directory, reproducing the folders of the converted folder, instead of next to the originals")
+	command.Flags().String("sidecars", string(utils2.SidecarCopy), fmt.Sprintf("How the other files of the folder, like cover.jpg, get into --output-dir: %s", strings.Join(sidecarModeNames(), ", ")))
+	command.MarkFlagsMutuallyExclusive("override", "output-dir")
+	command.Flags().StringSlice("ignore", cbz.DefaultIgnorePatterns, "Glob patterns of the archive files always dropped, matched against their path and each folder name")
+	command.Flags().String("other-files", string(cbz.OtherFilesKeep), fmt.Sprintf("What to do with the archive files that aren't images: %s writes them back as they are, %s leaves them out", cbz.OtherFilesKeep, cbz.OtherFilesDrop))
+	command.Flags().String("page-names", string(cbz.NamingSequential), fmt.Sprintf("How the pages of the converted archives are named: %s (0000, 0001...), %s (their original name) or a template like {chapter}-{index:03}", cbz.NamingSequential, cbz.NamingOriginal))
+	command.Flags().String("profile", "", profileHelp)
+	command.Flags().Int("resize-width", 0, "Width of the box the pages are resized to, 0 for no limit")
+	command.Flags().Int("resize-height", 0, "Height of the box the pages are resized to, 0 for no limit")
+	command.Flags().String("resize-mode", string(options.ResizeFit), fmt.Sprintf("How pages are resized into the box: %s keeps the whole page, %s crops what overflows", options.ResizeFit, options.ResizeFill))
+	command.Flags().String("resize-filter", string(options.FilterLanczos), fmt.Sprintf("Resize filter: %s, %s or %s", options.FilterLanczos, options.FilterCatmullRom, options.FilterBilinear))
+	command.Flags().Bool("upscale", false, "Enlarge the pages smaller than the resize box")
+	command.Flags().Bool("auto-levels", false, "Stretch the tones of the pages so their darkest pixels become black and their brightest white")
+	command.Flags().Float64("black-point", 0, fmt.Sprintf("Percentage of the darkest pixels clipped to black by the auto levels, 0 uses %g", options.DefaultClipPercent))
+	command.Flags().Float64("white-point", 0, fmt.Sprintf("Percentage of the brightest pixels clipped to white by the auto levels, 0 uses %g", options.DefaultClipPercent))
+	command.Flags().Float64("gamma", 0, "Gamma applied to the midtones, below 1 darkens them, 0 leaves them alone")
+	command.Flags().Float64("sharpen", 0, fmt.Sprintf("Strength of the sharpening from 0 (disabled) to %g, 0.5 is mild", options.MaxSharpen))
+	command.Flags().String("preview", "", "Write before and after samples of the image adjustments of each chapter to this directory instead of converting it")
+	command.Flags().Bool("trim", false, "Crop the uniform scanner borders of the pages, spreads and full bleed art are left alone")
+	command.Flags().Int("trim-tolerance", 0, fmt.Sprintf("Largest luma difference (0-255) of a border pixel with the border color, 0 uses %d", options.DefaultTrimTolerance))
+	command.Flags().Int("trim-max-percent", 0, fmt.Sprintf("Largest share of the width or height trimmed from each side (1-%d), 0 uses %d", options.MaxTrimPercent, options.DefaultTrimMaxPercent))
+	command.Flags().Bool("grayscale", false, "Convert the pages without color to single channel grayscale before encoding them")
+	command.Flags().Int("grayscale-tolerance", 0, fmt.Sprintf("Highest chroma (0-255) of a pixel still considered gray, 0 uses %d", options.DefaultGrayscaleTolerance))
+	command.Flags().Int("gray-levels", 0, "Quantize the grayscale pages to this many gray levels (2-256), e.g. 16 for e-ink, 0 keeps them as is. Implies --grayscale")
+	command.Flags().Bool("dither", false, "Dither the quantized pages to smooth their gradients")
+	command.Flags().Bool("stitch", false, "Stitch consecutive pages of the same width and re-cut them at gutters into pages of the crop height, for webtoons (webp only)")
+	command.Flags().Int("crop-height", 0, "Height of the parts of a split page, 0 uses the format default")
+	command.Flags().Int("effort", 0, fmt.Sprintf("Encoding effort from 1 (fastest) to %d (smallest), 0 uses the encoder default", options.MaxEffort))
+	command.Flags().String("webp-preset", "", fmt.Sprintf("WebP encoder preset: %s", strings.Join(options.WebPPresets, ", ")))
+	command.Flags().Bool("webp-sharp-yuv", false, "Use the sharper but slower RGB to YUV conversion for WebP")
+	command.Flags().Bool("webp-auto-filter", false, "Let the WebP encoder pick the deblocking filter strength")
+	command.Flags().Int("webp-near-lossless", -1, "WebP near lossless level from 0 (strongest) to 100, -1 disables it")
 
 	AddCommand(command)
 }
@@ -48,18 +96,13 @@ func init() {
 func ConvertCbzCommand(cmd *cobra.Command, args []string) error {
 	log.Info().Str("command", "optimize").Msg("Starting optimize command")
 
-	path := args[0]
-	if path == "" {
-		log.Error().Msg("Path argument is required but empty")
-		return fmt.Errorf("path is required")
-	}
-
-	log.Debug().Str("input_path", path).Msg("Validating input path")
-	if !utils2.IsValidFolder(path) {
-		log.Error().Str("input_path", path).Msg("Path validation failed - not a valid folder")
-		return fmt.Errorf("the path needs to be a folder")
+	log.Debug().Strs("input_paths", args).Msg("Resolving input paths")
+	inputs, err := resolveInputs(args, cmd.InOrStdin())
+	if err != nil {
+		log.Error().Strs("input_paths", args).Err(err).Msg("Input path validation failed")
+		return err
 	}
-	log.Debug().Str("input_path", path).Msg("Input path validated successfully")
+	log.Debug().Strs("inputs", inputs).Msg("Input paths resolved successfully")
 
 	log.Debug().Msg("Parsing command-line flags")
 
@@ -99,6 +142,228 @@ func ConvertCbzCommand(cmd *cobra.Command, args []string) error {
 	}
 	log.Debug().Int("parallelism", parallelism).Msg("Parallelism parameter validated")
 
+	minPageSavings, err := cmd.Flags().GetFloat64("min-page-savings")
+	if err != nil || minPageSavings < 0 || minPageSavings >= 1 {
+		log.Error().Err(err).Float64("min_page_savings", minPageSavings).Msg("Invalid min-page-savings value")
+		return fmt.Errorf("invalid min-page-savings value, it must be between 0 and 1")
+	}
+	minChapterSavings, err := cmd.Flags().GetFloat64("min-chapter-savings")
+	if err != nil || minChapterSavings < 0 || minChapterSavings >= 1 {
+		log.Error().Err(err).Float64("min_chapter_savings", minChapterSavings).Msg("Invalid min-chapter-savings value")
+		return fmt.Errorf("invalid min-chapter-savings value, it must be between 0 and 1")
+	}
+	log.Debug().Float64("min_page_savings", minPageSavings).Float64("min_chapter_savings", minChapterSavings).Msg("Savings thresholds validated")
+
+	webpBackend, err := cmd.Flags().GetString("webp-backend")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse webp-backend flag")
+		return fmt.Errorf("invalid webp-backend value")
+	}
+	err = webp.SetBackend(webpBackend)
+	if err != nil {
+		log.Error().Str("webp_backend", webpBackend).Err(err).Msg("Invalid WebP encoder backend")
+		return err
+	}
+	log.Debug().Str("webp_backend", webpBackend).Msg("WebP encoder backend parameter validated")
+
+	// The split heights, effort and WebP tuning can also be set in the config file. The keys are bound to the flags
+	// of the running command, the watch command binds them too.
+	for _, name := range configFlags {
+		if err := viper.BindPFlag(name, cmd.Flags().Lookup(name)); err != nil {
+			log.Error().Str("flag", name).Err(err).Msg("Failed to bind flag to the config")
+			return fmt.Errorf("invalid %s flag: %w", name, err)
+		}
+	}
+	splitHeight := viper.GetInt("split-height")
+	cropHeight := viper.GetInt("crop-height")
+	effort := viper.GetInt("effort")
+
+	splitMode, err := cmd.Flags().GetString("split-mode")
+	stitch, err2 := cmd.Flags().GetBool("stitch")
+	spreads, err3 := cmd.Flags().GetString("spreads")
+	grayscale, err4 := cmd.Flags().GetBool("grayscale")
+	grayscaleTolerance, err5 := cmd.Flags().GetInt("grayscale-tolerance")
+	grayLevels, err6 := cmd.Flags().GetInt("gray-levels")
+	dither, err7 := cmd.Flags().GetBool("dither")
+	animations, err8 := cmd.Flags().GetString("animations")
+	if err := errors.Join(err, err2, err3, err4, err5, err6, err7, err8); err != nil {
+		log.Error().Err(err).Msg("Failed to parse conversion flags")
+		return fmt.Errorf("invalid conversion flags: %w", err)
+	}
+
+	trim, err := cmd.Flags().GetBool("trim")
+	trimTolerance, err2 := cmd.Flags().GetInt("trim-tolerance")
+	trimMaxPercent, err3 := cmd.Flags().GetInt("trim-max-percent")
+	if err := errors.Join(err, err2, err3); err != nil {
+		log.Error().Err(err).Msg("Failed to parse trim flags")
+		return fmt.Errorf("invalid trim flags: %w", err)
+	}
+
+	webpPreset := viper.GetString("webp-preset")
+	webpSharpYUV := viper.GetBool("webp-sharp-yuv")
+	webpAutoFilter := viper.GetBool("webp-auto-filter")
+	webpNearLossless := viper.GetInt("webp-near-lossless")
+
+	profileName, err := cmd.Flags().GetString("profile")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse profile flag")
+		return fmt.Errorf("invalid profile value")
+	}
+	profile, err := resolveProfile(profileName)
+	if err != nil {
+		log.Error().Str("profile", profileName).Err(err).Msg("Invalid device profile")
+		return err
+	}
+	// The resize flags override the profile
+	resize := profile.Resize
+	if cmd.Flags().Changed("resize-width") {
+		resize.Width, _ = cmd.Flags().GetInt("resize-width")
+	}
+	if cmd.Flags().Changed("resize-height") {
+		resize.Height, _ = cmd.Flags().GetInt("resize-height")
+	}
+	if cmd.Flags().Changed("resize-mode") || resize.Mode == "" {
+		mode, _ := cmd.Flags().GetString("resize-mode")
+		resize.Mode = options.ResizeMode(strings.ToLower(mode))
+	}
+	if cmd.Flags().Changed("resize-filter") || resize.Filter == "" {
+		filter, _ := cmd.Flags().GetString("resize-filter")
+		resize.Filter = options.ResizeFilter(strings.ToLower(filter))
+	}
+	if cmd.Flags().Changed("upscale") {
+		resize.Upscale, _ = cmd.Flags().GetBool("upscale")
+	}
+	// The adjustment flags override the profile
+	adjust := profile.Adjust
+	if cmd.Flags().Changed("auto-levels") {
+		adjust.AutoLevels, _ = cmd.Flags().GetBool("auto-levels")
+	}
+	if cmd.Flags().Changed("black-point") {
+		adjust.BlackPoint, _ = cmd.Flags().GetFloat64("black-point")
+	}
+	if cmd.Flags().Changed("white-point") {
+		adjust.WhitePoint, _ = cmd.Flags().GetFloat64("white-point")
+	}
+	if cmd.Flags().Changed("gamma") {
+		adjust.Gamma, _ = cmd.Flags().GetFloat64("gamma")
+	}
+	if cmd.Flags().Changed("sharpen") {
+		adjust.Sharpen, _ = cmd.Flags().GetFloat64("sharpen")
+	}
+	log.Debug().Str("profile", profileName).Interface("resize", resize).Interface("adjust", adjust).Msg("Profile parameters resolved")
+
+	previewDir, err := cmd.Flags().GetString("preview")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse preview flag")
+		return fmt.Errorf("invalid preview value")
+	}
+
+	ignore, err := cmd.Flags().GetStringSlice("ignore")
+	otherFiles, err2 := cmd.Flags().GetString("other-files")
+	pageNames, err3 := cmd.Flags().GetString("page-names")
+	if err := errors.Join(err, err2, err3); err != nil {
+		log.Error().Err(err).Msg("Failed to parse archive flags")
+		return fmt.Errorf("invalid archive flags: %w", err)
+	}
+	loadOptions := &cbz.LoadOptions{Ignore: ignore, OtherFiles: cbz.OtherFilesPolicy(strings.ToLower(otherFiles))}
+	err = loadOptions.Validate()
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid archive options")
+		return err
+	}
+	pageNaming := cbz.PageNaming(pageNames)
+	err = pageNaming.Validate()
+	if err != nil {
+		log.Error().Str("page_names", pageNames).Err(err).Msg("Invalid page naming")
+		return err
+	}
+	log.Debug().Strs("ignore", ignore).Str("other_files", otherFiles).Str("page_names", pageNames).Msg("Archive options validated")
+
+	backupDir, err := cmd.Flags().GetString("backup-dir")
+	backupKeepDays, err2 := cmd.Flags().GetInt("backup-keep-days")
+	backupMaxSize, err3 := cmd.Flags().GetInt("backup-max-size")
+	if err := errors.Join(err, err2, err3); err != nil {
+		log.Error().Err(err).Msg("Failed to parse backup flags")
+		return fmt.Errorf("invalid backup flags: %w", err)
+	}
+	backupStore, retention, err := newBackupStore(backupDir, backupKeepDays, backupMaxSize)
+	if err != nil {
+		log.Error().Str("backup_dir", backupDir).Err(err).Msg("Invalid backup options")
+		return err
+	}
+
+	outputDir, err := cmd.Flags().GetString("output-dir")
+	sidecars, err2 := cmd.Flags().GetString("sidecars")
+	if err := errors.Join(err, err2); err != nil {
+		log.Error().Err(err).Msg("Failed to parse output flags")
+		return fmt.Errorf("invalid output flags: %w", err)
+	}
+	var mirror *utils2.Mirror
+	if outputDir != "" {
+		// The folders of the inputs are reproduced from the folder they have in common
+		root, err := commonRoot(inputs)
+		if err != nil {
+			log.Error().Strs("inputs", inputs).Err(err).Msg("Failed to find the root of the inputs")
+			return err
+		}
+		mirror, err = utils2.NewMirror(root, outputDir, utils2.SidecarMode(strings.ToLower(sidecars)))
+		if err != nil {
+			log.Error().Str("output_dir", outputDir).Err(err).Msg("Invalid output options")
+			return err
+		}
+		log.Debug().Str("output_dir", mirror.OutputDir()).Str("sidecars", sidecars).Msg("Output directory ready")
+	}
+
+	convertOptions := converter.ConvertOptions{
+		Quality:            quality,
+		Lossless:           lossless,
+		Split:              split,
+		SplitMode:          options.SplitMode(strings.ToLower(splitMode)),
+		Stitch:             stitch,
+		Spreads:            options.SpreadMode(strings.ToLower(spreads)),
+		Animations:         options.AnimationMode(strings.ToLower(animations)),
+		Trim:               options.Trim{Enabled: trim, Tolerance: trimTolerance, MaxPercent: trimMaxPercent},
+		Resize:             resize,
+		Adjust:             adjust,
+		Grayscale:          grayscale,
+		GrayscaleTolerance: grayscaleTolerance,
+		GrayLevels:         grayLevels,
+		Dither:             dither,
+		MaxHeight:          splitHeight,
+		CropHeight:         cropHeight,
+		Effort:             effort,
+		WebP: options.WebPTuning{
+			Preset:       strings.ToLower(webpPreset),
+			SharpYUV:     webpSharpYUV,
+			AutoFilter:   webpAutoFilter,
+			NearLossless: nearLosslessLevel(webpNearLossless),
+		},
+	}
+	err = convertOptions.Validate()
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid conversion options")
+		return err
+	}
+	if convertOptions.Stitch && converterType != constant.WebP {
+		log.Error().Str("converter_format", converterType.String()).Msg("Stitching requested with a format that doesn't support it")
+		return fmt.Errorf("stitch is only supported by the %s format", constant.WebP)
+	}
+	log.Debug().
+		Str("split_mode", splitMode).
+		Bool("stitch", stitch).
+		Str("spreads", spreads).
+		Str("animations", animations).
+		Interface("trim", convertOptions.Trim).
+		Bool("grayscale", grayscale).
+		Int("gray_levels", grayLevels).
+		Bool("dither", dither).
+		Int("grayscale_tolerance", convertOptions.GrayscaleChromaTolerance()).
+		Int("split_height", splitHeight).
+		Int("crop_height", cropHeight).
+		Int("effort", effort).
+		Interface("webp_tuning", convertOptions.WebP).
+		Msg("Conversion options validated")
+
 	log.Debug().Str("converter_format", converterType.String()).Msg("Initializing converter")
 	chapterConverter, err := converter.Get(converterType)
 	if err != nil {
@@ -115,10 +380,22 @@ func ConvertCbzCommand(cmd *cobra.Command, args []string) error {
 	}
 	log.Debug().Msg("Converter prepared successfully")
 
+	var stats utils2.SavingsStats
+
 	// Channel to manage the files to process
 	fileChan := make(chan string)
 	// Channel to collect errors
 	errorChan := make(chan error, parallelism)
+	// The errors are collected while the workers run, so that they never block on a full channel
+	var errs []error
+	errsCollected := make(chan struct{})
+	go func() {
+		defer close(errsCollected)
+		for err := range errorChan {
+			errs = append(errs, err)
+			log.Error().Err(err).Msg("Collected processing error")
+		}
+	}()
 
 	// WaitGroup to wait for all goroutines to finish
 	var wg sync.WaitGroup
@@ -132,14 +409,26 @@ func ConvertCbzCommand(cmd *cobra.Command, args []string) error {
 			log.Debug().Int("worker_id", workerID).Msg("Worker started")
 			for path := range fileChan {
 				log.Debug().Int("worker_id", workerID).Str("file_path", path).Msg("Worker processing file")
+				if previewDir != "" {
+					if _, err := utils2.WritePreview(path, previewDir, &convertOptions.Adjust); err != nil {
+						log.Error().Int("worker_id", workerID).Str("file_path", path).Err(err).Msg("Worker failed to write preview")
+						errorChan <- fmt.Errorf("error previewing file %s: %w", path, err)
+					}
+					continue
+				}
 				err := utils2.Optimize(&utils2.OptimizeOptions{
-					ChapterConverter: chapterConverter,
-					Path:             path,
-					Quality:          quality,
-					Lossless:         lossless,
-					Override:         override,
-					Split:            split,
-					Timeout:          timeout,
+					ChapterConverter:  chapterConverter,
+					Path:              path,
+					LoadOptions:       loadOptions,
+					PageNaming:        pageNaming,
+					Backup:            backupStore,
+					Mirror:            mirror,
+					ConvertOptions:    convertOptions,
+					Override:          override,
+					Timeout:           timeout,
+					MinPageSavings:    minPageSavings,
+					MinChapterSavings: minChapterSavings,
+					Stats:             &stats,
 				})
 				if err != nil {
 					log.Error().Int("worker_id", workerID).Str("file_path", path).Err(err).Msg("Worker encountered error")
@@ -153,48 +442,81 @@ func ConvertCbzCommand(cmd *cobra.Command, args []string) error {
 	}
 	log.Debug().Int("worker_count", parallelism).Msg("All worker goroutines started")
 
-	// Walk the path and send files to the channel
-	log.Debug().Str("search_path", path).Msg("Starting filesystem walk for CBZ/CBR files")
-	err = filepath.WalkDir(path, func(filePath string, info os.DirEntry, err error) error {
-		if err != nil {
-			log.Error().Str("file_path", filePath).Err(err).Msg("Error during filesystem walk")
-			return err
+	// Walk the inputs and send files to the channel
+	var sidecarErrs []error
+	err = walkInputs(inputs, func(filePath string) bool {
+		// The backups are originals too, they aren't to be converted again
+		if backupStore != nil && backupStore.Contains(filePath) {
+			log.Debug().Str("file_path", filePath).Msg("Skipping backup directory")
+			return true
 		}
-
-		if !info.IsDir() {
-			fileName := strings.ToLower(info.Name())
-			if strings.HasSuffix(fileName, ".cbz") || strings.HasSuffix(fileName, ".cbr") {
-				log.Debug().Str("file_path", filePath).Str("file_name", fileName).Msg("Found CBZ/CBR file")
-				fileChan <- filePath
-			}
+		// Neither are the converted chapters
+		if mirror != nil && mirror.Contains(filePath) {
+			log.Debug().Str("file_path", filePath).Msg("Skipping output directory")
+			return true
+		}
+		return false
+	}, func(filePath string) {
+		fileChan <- filePath
+	}, func(filePath string) {
+		if mirror == nil || previewDir != "" {
+			return
+		}
+		if err := mirror.CopySidecar(filePath); err != nil {
+			log.Error().Str("file_path", filePath).Err(err).Msg("Failed to mirror file")
+			sidecarErrs = append(sidecarErrs, err)
 		}
-
-		return nil
 	})
 
 	if err != nil {
-		log.Error().Str("search_path", path).Err(err).Msg("Filesystem walk failed")
+		log.Error().Strs("inputs", inputs).Err(err).Msg("Filesystem walk failed")
 		return fmt.Errorf("error walking the path: %w", err)
 	}
-	log.Debug().Str("search_path", path).Msg("Filesystem walk completed")
+	log.Debug().Strs("inputs", inputs).Msg("Filesystem walk completed")
 
 	close(fileChan) // Close the channel to signal workers to stop
 	log.Debug().Msg("File channel closed, waiting for workers to complete")
 	wg.Wait() // Wait for all workers to finish
 	log.Debug().Msg("All workers completed")
+	log.Info().
+		Uint64("pages_kept", stats.PagesKept.Load()).
+		Uint64("chapters_skipped", stats.ChaptersSkipped.Load()).
+		Msg("Size guard summary")
+	pruneBackups(backupStore, retention)
 	close(errorChan) // Close the error channel
+	<-errsCollected
 
-	var errs []error
-	for err := range errorChan {
-		errs = append(errs, err)
-		log.Error().Err(err).Msg("Collected processing error")
-	}
+	errs = append(sidecarErrs, errs...)
 
 	if len(errs) > 0 {
 		log.Error().Int("error_count", len(errs)).Msg("Command completed with errors")
 		return fmt.Errorf("encountered errors: %v", errs)
 	}
 
-	log.Info().Str("search_path", path).Msg("Optimize command completed successfully")
+	log.Info().Strs("inputs", inputs).Msg("Optimize command completed successfully")
 	return nil
 }
+
+func sidecarModeNames() []string {
+	names := make([]string, len(utils2.SidecarModes))
+	for i, mode := range utils2.SidecarModes {
+		names[i] = string(mode)
+	}
+	return names
+}
+
+// nearLosslessLevel turns the value of the webp-near-lossless flag into the tuning level, -1 disabling it.
+func nearLosslessLevel(flag int) *int {
+	if flag == -1 {
+		return nil
+	}
+	return &flag
+}
+
+func spreadModeNames() []string {
+	names := make([]string, len(options.SpreadModes))
+	for i, mode := range options.SpreadModes {
+		names[i] = string(mode)
+	}
+	return names
+}
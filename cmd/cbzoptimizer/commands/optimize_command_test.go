@@ -20,7 +20,7 @@ import (
 // MockConverter is a mock implementation of the Converter interface
 type MockConverter struct{}
 
-func (m *MockConverter) ConvertChapter(ctx context.Context, chapter *manga.Chapter, quality uint8, lossless bool, split bool, progress func(message string, current uint32, total uint32)) (*manga.Chapter, error) {
+func (m *MockConverter) ConvertChapter(ctx context.Context, chapter *manga.Chapter, opts *converter.ConvertOptions, progress func(message string, current uint32, total uint32)) (*manga.Chapter, error) {
 	chapter.IsConverted = true
 	chapter.ConvertedTime = time.Now()
 	return chapter, nil
@@ -82,10 +82,52 @@ func TestConvertCbzCommand(t *testing.T) {
 		Use: "optimize",
 	}
 	cmd.Flags().Uint8P("quality", "q", 85, "Quality for conversion (0-100)")
+	cmd.Flags().BoolP("lossless", "p", false, "Use lossless conversion (overrides quality setting)")
 	cmd.Flags().IntP("parallelism", "n", 2, "Number of chapters to convert in parallel")
 	cmd.Flags().BoolP("override", "o", false, "Override the original CBZ/CBR files")
 	cmd.Flags().BoolP("split", "s", false, "Split long pages into smaller chunks")
 	cmd.Flags().DurationP("timeout", "t", 0, "Maximum time allowed for converting a single chapter (e.g., 30s, 5m, 1h). 0 means no timeout")
+	cmd.Flags().Float64("min-page-savings", 0, "Keep the original page unless the converted one is smaller by this ratio (0-1)")
+	cmd.Flags().Float64("min-chapter-savings", 0, "Don't rewrite the chapter unless it gets smaller by this ratio (0-1)")
+	cmd.Flags().String("webp-backend", "auto", "WebP encoder backend")
+	cmd.Flags().Int("split-height", 0, "Height from which a page is split when splitting")
+	cmd.Flags().String("split-mode", "fixed", "How split pages are cut")
+	cmd.Flags().String("spreads", "keep", "What to do with double page spreads")
+	cmd.Flags().String("profile", "", "Device profile")
+	cmd.Flags().Int("resize-width", 0, "Width of the resize box")
+	cmd.Flags().Int("resize-height", 0, "Height of the resize box")
+	cmd.Flags().String("resize-mode", "fit", "Resize mode")
+	cmd.Flags().String("resize-filter", "lanczos", "Resize filter")
+	cmd.Flags().Bool("upscale", false, "Enlarge small pages")
+	cmd.Flags().Bool("auto-levels", false, "Auto levels")
+	cmd.Flags().Float64("black-point", 0, "Black point")
+	cmd.Flags().Float64("white-point", 0, "White point")
+	cmd.Flags().Float64("gamma", 0, "Gamma")
+	cmd.Flags().Float64("sharpen", 0, "Sharpening strength")
+	cmd.Flags().String("preview", "", "Preview directory")
+	cmd.Flags().Bool("trim", false, "Crop the scanner borders")
+	cmd.Flags().Int("trim-tolerance", 0, "Border tolerance")
+	cmd.Flags().Int("trim-max-percent", 0, "Largest trim of a side")
+	cmd.Flags().Bool("grayscale", false, "Convert grayscale pages to a single channel")
+	cmd.Flags().Int("grayscale-tolerance", 0, "Chroma tolerance of gray pixels")
+	cmd.Flags().Int("gray-levels", 0, "Gray levels of the grayscale pages")
+	cmd.Flags().Bool("dither", false, "Dither the quantized pages")
+	cmd.Flags().Bool("stitch", false, "Stitch pages of the same width")
+	cmd.Flags().Int("crop-height", 0, "Height of the parts of a split page")
+	cmd.Flags().Int("effort", 0, "Encoding effort")
+	cmd.Flags().String("webp-preset", "", "WebP encoder preset")
+	cmd.Flags().Bool("webp-sharp-yuv", false, "Sharper RGB to YUV conversion for WebP")
+	cmd.Flags().Bool("webp-auto-filter", false, "WebP auto filter")
+	cmd.Flags().Int("webp-near-lossless", -1, "WebP near lossless level")
+	cmd.Flags().String("animations", "keep", "What to do with animated pages")
+	cmd.Flags().StringSlice("ignore", nil, "Archive files always dropped")
+	cmd.Flags().String("other-files", "keep", "What to do with the archive files that aren't images")
+	cmd.Flags().String("page-names", "sequential", "How the pages are named")
+	cmd.Flags().String("output-dir", "", "Output directory")
+	cmd.Flags().String("sidecars", "copy", "How the other files get into the output directory")
+	cmd.Flags().String("backup-dir", "", "Backup directory")
+	cmd.Flags().Int("backup-keep-days", 0, "Backup retention in days")
+	cmd.Flags().Int("backup-max-size", 0, "Backup retention in MiB")
 
 	// Execute the command
 	err = ConvertCbzCommand(cmd, []string{tempDir})
@@ -137,7 +179,7 @@ func TestConvertCbzCommand(t *testing.T) {
 			t.Logf("Archive file found: %s", path)
 
 			// Load the converted chapter
-			chapter, err := cbz.LoadChapter(path)
+			chapter, err := cbz.LoadChapter(path, nil)
 			if err != nil {
 				return err
 			}
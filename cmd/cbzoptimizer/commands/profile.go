@@ -0,0 +1,34 @@
+package commands
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/spf13/viper"
+)
+
+const profileHelp = "Device profile setting the resize box and image adjustments, built-in or from the profiles of the config file"
+
+// resolveProfile returns the device profile with the given name, the profiles of the config file
+// taking precedence over the built-in ones. An empty name returns an empty profile.
+func resolveProfile(name string) (options.Profile, error) {
+	if name == "" {
+		return options.Profile{}, nil
+	}
+
+	profiles := maps.Clone(options.Profiles)
+	var configured map[string]options.Profile
+	if err := viper.UnmarshalKey("profiles", &configured); err != nil {
+		return options.Profile{}, fmt.Errorf("invalid profiles in the config file: %w", err)
+	}
+	maps.Copy(profiles, configured)
+
+	profile, ok := profiles[strings.ToLower(name)]
+	if !ok {
+		return options.Profile{}, fmt.Errorf("unknown profile \"%s\", available profiles are %s", name, strings.Join(slices.Sorted(maps.Keys(profiles)), ", "))
+	}
+	return profile, nil
+}
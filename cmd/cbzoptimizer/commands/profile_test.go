@@ -0,0 +1,44 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveProfile(t *testing.T) {
+	previous := viper.Get("profiles")
+	defer viper.Set("profiles", previous)
+	viper.Set("profiles", map[string]any{
+		"my-phone":    map[string]any{"width": 1080, "height": 2400, "filter": "catmullrom"},
+		"my-kobo":     map[string]any{"width": 1264, "height": 1680, "auto-levels": true, "white-point": 5, "gamma": 0.8, "sharpen": 0.5},
+		"kobo-libra2": map[string]any{"width": 1000, "height": 1500, "mode": "fill"},
+	})
+
+	profile, err := resolveProfile("")
+	require.NoError(t, err)
+	assert.False(t, profile.Enabled(), "no profile means no resize")
+
+	profile, err = resolveProfile("Kindle-Scribe")
+	require.NoError(t, err)
+	assert.Equal(t, options.Profiles["kindle-scribe"], profile)
+
+	profile, err = resolveProfile("my-phone")
+	require.NoError(t, err)
+	assert.Equal(t, options.Resize{Width: 1080, Height: 2400, Filter: options.FilterCatmullRom}, profile.Resize)
+
+	profile, err = resolveProfile("my-kobo")
+	require.NoError(t, err)
+	assert.Equal(t, options.Resize{Width: 1264, Height: 1680}, profile.Resize)
+	assert.Equal(t, options.Adjust{AutoLevels: true, WhitePoint: 5, Gamma: 0.8, Sharpen: 0.5}, profile.Adjust)
+
+	profile, err = resolveProfile("kobo-libra2")
+	require.NoError(t, err)
+	assert.Equal(t, options.Resize{Width: 1000, Height: 1500, Mode: options.ResizeFill}, profile.Resize, "the config file overrides the built-in profiles")
+
+	_, err = resolveProfile("unknown")
+	assert.ErrorContains(t, err, "my-phone")
+}
@@ -0,0 +1,68 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/backup"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	command := &cobra.Command{
+		Use:   "restore [file or folder]",
+		Short: "Put the backed up originals of a file or folder back in place",
+		Long:  "Put the backed up originals of a file or folder back in place.\nThe originals replaced or deleted by optimize or watch with --backup-dir are moved back to their path, replacing the converted files.",
+		RunE:  RestoreCommand,
+		Args:  cobra.ExactArgs(1),
+	}
+	command.Flags().String("backup-dir", "", "Directory the originals were backed up to, defaults to the backup-dir of the config file")
+
+	AddCommand(command)
+}
+
+func RestoreCommand(cmd *cobra.Command, args []string) error {
+	log.Info().Str("command", "restore").Msg("Starting restore command")
+
+	path := args[0]
+	if path == "" {
+		return fmt.Errorf("path is required")
+	}
+
+	backupDir, err := cmd.Flags().GetString("backup-dir")
+	if err != nil {
+		return fmt.Errorf("invalid backup-dir value")
+	}
+	if backupDir == "" {
+		backupDir = viper.GetString("backup-dir")
+	}
+	if backupDir == "" {
+		return fmt.Errorf("the backup directory is required, set --backup-dir")
+	}
+
+	store, err := backup.New(backupDir)
+	if err != nil {
+		return err
+	}
+	restored, err := store.Restore(path)
+	if err != nil {
+		log.Error().Str("path", path).Str("backup_dir", store.Dir()).Err(err).Msg("Restore failed")
+		return err
+	}
+
+	for _, file := range restored {
+		// A CBR converted with --override was replaced by a CBZ, which is left to the user
+		if strings.EqualFold(filepath.Ext(file), ".cbr") {
+			converted := strings.TrimSuffix(file, filepath.Ext(file)) + ".cbz"
+			if _, err := os.Stat(converted); err == nil {
+				log.Warn().Str("file", file).Str("converted", converted).Msg("The CBZ converted from the restored CBR is still there")
+			}
+		}
+	}
+	log.Info().Str("path", path).Int("restored", len(restored)).Msg("Restore command completed successfully")
+	return nil
+}
@@ -6,9 +6,12 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/cbz"
 	utils2 "github.com/danielkitchener/CBZOptimizer/v2/internal/utils"
 	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter"
 	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/constant"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/webp"
 	"github.com/pablodz/inotifywaitgo/inotifywaitgo"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
@@ -49,6 +52,126 @@ func init() {
 	command.PersistentFlags().Lookup("format").NoOptDefVal = constant.DefaultConversion.String()
 	_ = viper.BindPFlag("format", command.PersistentFlags().Lookup("format"))
 
+	command.Flags().Float64("min-page-savings", 0, "Keep the original page unless the converted one is smaller by this ratio (0-1)")
+	_ = viper.BindPFlag("min-page-savings", command.Flags().Lookup("min-page-savings"))
+
+	command.Flags().Float64("min-chapter-savings", 0, "Don't rewrite the chapter unless it gets smaller by this ratio (0-1)")
+	_ = viper.BindPFlag("min-chapter-savings", command.Flags().Lookup("min-chapter-savings"))
+
+	command.Flags().String("webp-backend", webp.AutoBackend, fmt.Sprintf("WebP encoder backend: %s", strings.Join(append([]string{webp.AutoBackend}, webp.Backends()...), ", ")))
+	_ = viper.BindPFlag("webp-backend", command.Flags().Lookup("webp-backend"))
+
+	command.Flags().Int("split-height", 0, "Height from which a page is split when splitting, 0 uses the format default")
+	_ = viper.BindPFlag("split-height", command.Flags().Lookup("split-height"))
+
+	command.Flags().String("split-mode", string(options.SplitFixed), fmt.Sprintf("How split pages are cut: %s cuts every crop height, %s moves the cuts to the nearest gutter", options.SplitFixed, options.SplitSmart))
+	_ = viper.BindPFlag("split-mode", command.Flags().Lookup("split-mode"))
+
+	command.Flags().String("spreads", string(options.SpreadKeep), fmt.Sprintf("What to do with double page spreads (pages wider than tall): %s", strings.Join(spreadModeNames(), ", ")))
+	_ = viper.BindPFlag("spreads", command.Flags().Lookup("spreads"))
+
+	command.Flags().String("animations", string(options.AnimationKeep), fmt.Sprintf("What to do with animated pages (GIF, WebP or PNG with several frames): %s keeps them as they are, %s encodes them to animations of the target format, except jxl", options.AnimationKeep, options.AnimationConvert))
+	_ = viper.BindPFlag("animations", command.Flags().Lookup("animations"))
+
+	command.Flags().String("output-dir", "", "Write the converted chapters to this directory, reproducing the folders of the watched folder, instead of overriding the originals")
+	_ = viper.BindPFlag("output-dir", command.Flags().Lookup("output-dir"))
+
+	command.Flags().String("sidecars", string(utils2.SidecarCopy), fmt.Sprintf("How the other files of the folder, like cover.jpg, get into --output-dir: %s", strings.Join(sidecarModeNames(), ", ")))
+	_ = viper.BindPFlag("sidecars", command.Flags().Lookup("sidecars"))
+
+	command.Flags().String("backup-dir", "", "Directory the originals replaced or deleted by --override are moved to, under their absolute path, to be put back with the restore command")
+	_ = viper.BindPFlag("backup-dir", command.Flags().Lookup("backup-dir"))
+
+	command.Flags().Int("backup-keep-days", 0, "Remove the backups older than this many days, 0 keeps them forever")
+	_ = viper.BindPFlag("backup-keep-days", command.Flags().Lookup("backup-keep-days"))
+
+	command.Flags().Int("backup-max-size", 0, "Remove the oldest backups once the backup directory is bigger than this many MiB, 0 for no limit")
+	_ = viper.BindPFlag("backup-max-size", command.Flags().Lookup("backup-max-size"))
+
+	command.Flags().StringSlice("ignore", cbz.DefaultIgnorePatterns, "Glob patterns of the archive files always dropped, matched against their path and each folder name")
+	_ = viper.BindPFlag("ignore", command.Flags().Lookup("ignore"))
+
+	command.Flags().String("other-files", string(cbz.OtherFilesKeep), fmt.Sprintf("What to do with the archive files that aren't images: %s writes them back as they are, %s leaves them out", cbz.OtherFilesKeep, cbz.OtherFilesDrop))
+	_ = viper.BindPFlag("other-files", command.Flags().Lookup("other-files"))
+
+	command.Flags().String("page-names", string(cbz.NamingSequential), fmt.Sprintf("How the pages of the converted archives are named: %s (0000, 0001...), %s (their original name) or a template like {chapter}-{index:03}", cbz.NamingSequential, cbz.NamingOriginal))
+	_ = viper.BindPFlag("page-names", command.Flags().Lookup("page-names"))
+
+	command.Flags().String("profile", "", profileHelp)
+	_ = viper.BindPFlag("profile", command.Flags().Lookup("profile"))
+
+	command.Flags().Int("resize-width", 0, "Width of the box the pages are resized to, 0 for no limit")
+	_ = viper.BindPFlag("resize-width", command.Flags().Lookup("resize-width"))
+
+	command.Flags().Int("resize-height", 0, "Height of the box the pages are resized to, 0 for no limit")
+	_ = viper.BindPFlag("resize-height", command.Flags().Lookup("resize-height"))
+
+	command.Flags().String("resize-mode", string(options.ResizeFit), fmt.Sprintf("How pages are resized into the box: %s keeps the whole page, %s crops what overflows", options.ResizeFit, options.ResizeFill))
+	_ = viper.BindPFlag("resize-mode", command.Flags().Lookup("resize-mode"))
+
+	command.Flags().String("resize-filter", string(options.FilterLanczos), fmt.Sprintf("Resize filter: %s, %s or %s", options.FilterLanczos, options.FilterCatmullRom, options.FilterBilinear))
+	_ = viper.BindPFlag("resize-filter", command.Flags().Lookup("resize-filter"))
+
+	command.Flags().Bool("upscale", false, "Enlarge the pages smaller than the resize box")
+	_ = viper.BindPFlag("upscale", command.Flags().Lookup("upscale"))
+
+	command.Flags().Bool("auto-levels", false, "Stretch the tones of the pages so their darkest pixels become black and their brightest white")
+	_ = viper.BindPFlag("auto-levels", command.Flags().Lookup("auto-levels"))
+
+	command.Flags().Float64("black-point", 0, fmt.Sprintf("Percentage of the darkest pixels clipped to black by the auto levels, 0 uses %g", options.DefaultClipPercent))
+	_ = viper.BindPFlag("black-point", command.Flags().Lookup("black-point"))
+
+	command.Flags().Float64("white-point", 0, fmt.Sprintf("Percentage of the brightest pixels clipped to white by the auto levels, 0 uses %g", options.DefaultClipPercent))
+	_ = viper.BindPFlag("white-point", command.Flags().Lookup("white-point"))
+
+	command.Flags().Float64("gamma", 0, "Gamma applied to the midtones, below 1 darkens them, 0 leaves them alone")
+	_ = viper.BindPFlag("gamma", command.Flags().Lookup("gamma"))
+
+	command.Flags().Float64("sharpen", 0, fmt.Sprintf("Strength of the sharpening from 0 (disabled) to %g, 0.5 is mild", options.MaxSharpen))
+	_ = viper.BindPFlag("sharpen", command.Flags().Lookup("sharpen"))
+
+	command.Flags().Bool("trim", false, "Crop the uniform scanner borders of the pages, spreads and full bleed art are left alone")
+	_ = viper.BindPFlag("trim", command.Flags().Lookup("trim"))
+
+	command.Flags().Int("trim-tolerance", 0, fmt.Sprintf("Largest luma difference (0-255) of a border pixel with the border color, 0 uses %d", options.DefaultTrimTolerance))
+	_ = viper.BindPFlag("trim-tolerance", command.Flags().Lookup("trim-tolerance"))
+
+	command.Flags().Int("trim-max-percent", 0, fmt.Sprintf("Largest share of the width or height trimmed from each side (1-%d), 0 uses %d", options.MaxTrimPercent, options.DefaultTrimMaxPercent))
+	_ = viper.BindPFlag("trim-max-percent", command.Flags().Lookup("trim-max-percent"))
+
+	command.Flags().Bool("grayscale", false, "Convert the pages without color to single channel grayscale before encoding them")
+	_ = viper.BindPFlag("grayscale", command.Flags().Lookup("grayscale"))
+
+	command.Flags().Int("grayscale-tolerance", 0, fmt.Sprintf("Highest chroma (0-255) of a pixel still considered gray, 0 uses %d", options.DefaultGrayscaleTolerance))
+	_ = viper.BindPFlag("grayscale-tolerance", command.Flags().Lookup("grayscale-tolerance"))
+
+	command.Flags().Int("gray-levels", 0, "Quantize the grayscale pages to this many gray levels (2-256), e.g. 16 for e-ink, 0 keeps them as is. Implies --grayscale")
+	_ = viper.BindPFlag("gray-levels", command.Flags().Lookup("gray-levels"))
+
+	command.Flags().Bool("dither", false, "Dither the quantized pages to smooth their gradients")
+	_ = viper.BindPFlag("dither", command.Flags().Lookup("dither"))
+
+	command.Flags().Bool("stitch", false, "Stitch consecutive pages of the same width and re-cut them at gutters into pages of the crop height, for webtoons (webp only)")
+	_ = viper.BindPFlag("stitch", command.Flags().Lookup("stitch"))
+
+	command.Flags().Int("crop-height", 0, "Height of the parts of a split page, 0 uses the format default")
+	_ = viper.BindPFlag("crop-height", command.Flags().Lookup("crop-height"))
+
+	command.Flags().Int("effort", 0, fmt.Sprintf("Encoding effort from 1 (fastest) to %d (smallest), 0 uses the encoder default", options.MaxEffort))
+	_ = viper.BindPFlag("effort", command.Flags().Lookup("effort"))
+
+	command.Flags().String("webp-preset", "", fmt.Sprintf("WebP encoder preset: %s", strings.Join(options.WebPPresets, ", ")))
+	_ = viper.BindPFlag("webp-preset", command.Flags().Lookup("webp-preset"))
+
+	command.Flags().Bool("webp-sharp-yuv", false, "Use the sharper but slower RGB to YUV conversion for WebP")
+	_ = viper.BindPFlag("webp-sharp-yuv", command.Flags().Lookup("webp-sharp-yuv"))
+
+	command.Flags().Bool("webp-auto-filter", false, "Let the WebP encoder pick the deblocking filter strength")
+	_ = viper.BindPFlag("webp-auto-filter", command.Flags().Lookup("webp-auto-filter"))
+
+	command.Flags().Int("webp-near-lossless", -1, "WebP near lossless level from 0 (strongest) to 100, -1 disables it")
+	_ = viper.BindPFlag("webp-near-lossless", command.Flags().Lookup("webp-near-lossless"))
+
 	AddCommand(command)
 }
 func WatchCommand(_ *cobra.Command, args []string) error {
@@ -72,7 +195,125 @@ func WatchCommand(_ *cobra.Command, args []string) error {
 
 	timeout := viper.GetDuration("timeout")
 
+	minPageSavings := viper.GetFloat64("min-page-savings")
+	if minPageSavings < 0 || minPageSavings >= 1 {
+		return fmt.Errorf("invalid min-page-savings value, it must be between 0 and 1")
+	}
+
+	minChapterSavings := viper.GetFloat64("min-chapter-savings")
+	if minChapterSavings < 0 || minChapterSavings >= 1 {
+		return fmt.Errorf("invalid min-chapter-savings value, it must be between 0 and 1")
+	}
+
+	err := webp.SetBackend(viper.GetString("webp-backend"))
+	if err != nil {
+		return err
+	}
+
+	profile, err := resolveProfile(viper.GetString("profile"))
+	if err != nil {
+		return err
+	}
+	// The resize settings override the profile
+	resize := profile.Resize
+	if viper.IsSet("resize-width") {
+		resize.Width = viper.GetInt("resize-width")
+	}
+	if viper.IsSet("resize-height") {
+		resize.Height = viper.GetInt("resize-height")
+	}
+	if viper.IsSet("resize-mode") || resize.Mode == "" {
+		resize.Mode = options.ResizeMode(strings.ToLower(viper.GetString("resize-mode")))
+	}
+	if viper.IsSet("resize-filter") || resize.Filter == "" {
+		resize.Filter = options.ResizeFilter(strings.ToLower(viper.GetString("resize-filter")))
+	}
+	if viper.IsSet("upscale") {
+		resize.Upscale = viper.GetBool("upscale")
+	}
+	// The adjustment settings override the profile
+	adjust := profile.Adjust
+	if viper.IsSet("auto-levels") {
+		adjust.AutoLevels = viper.GetBool("auto-levels")
+	}
+	if viper.IsSet("black-point") {
+		adjust.BlackPoint = viper.GetFloat64("black-point")
+	}
+	if viper.IsSet("white-point") {
+		adjust.WhitePoint = viper.GetFloat64("white-point")
+	}
+	if viper.IsSet("gamma") {
+		adjust.Gamma = viper.GetFloat64("gamma")
+	}
+	if viper.IsSet("sharpen") {
+		adjust.Sharpen = viper.GetFloat64("sharpen")
+	}
+
+	loadOptions := &cbz.LoadOptions{
+		Ignore:     viper.GetStringSlice("ignore"),
+		OtherFiles: cbz.OtherFilesPolicy(strings.ToLower(viper.GetString("other-files"))),
+	}
+	err = loadOptions.Validate()
+	if err != nil {
+		return err
+	}
+
+	backupStore, retention, err := newBackupStore(viper.GetString("backup-dir"), viper.GetInt("backup-keep-days"), viper.GetInt("backup-max-size"))
+	if err != nil {
+		return err
+	}
+
+	var mirror *utils2.Mirror
+	if outputDir := viper.GetString("output-dir"); outputDir != "" {
+		mirror, err = utils2.NewMirror(path, outputDir, utils2.SidecarMode(strings.ToLower(viper.GetString("sidecars"))))
+		if err != nil {
+			return err
+		}
+	}
+
+	pageNaming := cbz.PageNaming(viper.GetString("page-names"))
+	err = pageNaming.Validate()
+	if err != nil {
+		return err
+	}
+
+	convertOptions := converter.ConvertOptions{
+		Quality:    quality,
+		Split:      split,
+		SplitMode:  options.SplitMode(strings.ToLower(viper.GetString("split-mode"))),
+		Stitch:     viper.GetBool("stitch"),
+		Spreads:    options.SpreadMode(strings.ToLower(viper.GetString("spreads"))),
+		Animations: options.AnimationMode(strings.ToLower(viper.GetString("animations"))),
+		Trim: options.Trim{
+			Enabled:    viper.GetBool("trim"),
+			Tolerance:  viper.GetInt("trim-tolerance"),
+			MaxPercent: viper.GetInt("trim-max-percent"),
+		},
+		Resize:             resize,
+		Adjust:             adjust,
+		Grayscale:          viper.GetBool("grayscale"),
+		GrayscaleTolerance: viper.GetInt("grayscale-tolerance"),
+		GrayLevels:         viper.GetInt("gray-levels"),
+		Dither:             viper.GetBool("dither"),
+		MaxHeight:          viper.GetInt("split-height"),
+		CropHeight:         viper.GetInt("crop-height"),
+		Effort:             viper.GetInt("effort"),
+		WebP: options.WebPTuning{
+			Preset:       strings.ToLower(viper.GetString("webp-preset")),
+			SharpYUV:     viper.GetBool("webp-sharp-yuv"),
+			AutoFilter:   viper.GetBool("webp-auto-filter"),
+			NearLossless: nearLosslessLevel(viper.GetInt("webp-near-lossless")),
+		},
+	}
+	err = convertOptions.Validate()
+	if err != nil {
+		return err
+	}
+
 	converterType := constant.FindConversionFormat(viper.GetString("format"))
+	if convertOptions.Stitch && converterType != constant.WebP {
+		return fmt.Errorf("stitch is only supported by the %s format", constant.WebP)
+	}
 	chapterConverter, err := converter.Get(converterType)
 	if err != nil {
 		return fmt.Errorf("failed to get chapterConverter: %v", err)
@@ -82,7 +323,9 @@ func WatchCommand(_ *cobra.Command, args []string) error {
 	if err != nil {
 		return fmt.Errorf("failed to prepare converter: %v", err)
 	}
-	log.Info().Str("path", path).Bool("override", override).Uint8("quality", quality).Str("format", converterType.String()).Bool("split", split).Msg("Watching directory")
+	log.Info().Str("path", path).Bool("override", override && mirror == nil).Uint8("quality", quality).Str("format", converterType.String()).Bool("split", split).Msg("Watching directory")
+
+	var stats utils2.SavingsStats
 
 	events := make(chan inotifywaitgo.FileEvent)
 	errors := make(chan error)
@@ -113,8 +356,18 @@ func WatchCommand(_ *cobra.Command, args []string) error {
 		for event := range events {
 			log.Debug().Str("file", event.Filename).Interface("events", event.Events).Msg("File event")
 
+			// The backups are originals too and the output directory holds the converted chapters, they aren't to
+			// be converted again
+			if (backupStore != nil && backupStore.Contains(event.Filename)) || (mirror != nil && mirror.Contains(event.Filename)) {
+				continue
+			}
 			filename := strings.ToLower(event.Filename)
 			if !strings.HasSuffix(filename, ".cbz") && !strings.HasSuffix(filename, ".cbr") {
+				if mirror != nil {
+					if err := mirror.CopySidecar(event.Filename); err != nil {
+						errors <- err
+					}
+				}
 				continue
 			}
 
@@ -122,16 +375,27 @@ func WatchCommand(_ *cobra.Command, args []string) error {
 				switch e {
 				case inotifywaitgo.CLOSE_WRITE, inotifywaitgo.MOVE:
 					err := utils2.Optimize(&utils2.OptimizeOptions{
-						ChapterConverter: chapterConverter,
-						Path:             event.Filename,
-						Quality:          quality,
-						Override:         override,
-						Split:            split,
-						Timeout:          timeout,
+						ChapterConverter:  chapterConverter,
+						Path:              event.Filename,
+						LoadOptions:       loadOptions,
+						PageNaming:        pageNaming,
+						Backup:            backupStore,
+						Mirror:            mirror,
+						ConvertOptions:    convertOptions,
+						Override:          override,
+						Timeout:           timeout,
+						MinPageSavings:    minPageSavings,
+						MinChapterSavings: minChapterSavings,
+						Stats:             &stats,
 					})
 					if err != nil {
 						errors <- fmt.Errorf("error processing file %s: %w", event.Filename, err)
 					}
+					pruneBackups(backupStore, retention)
+					log.Debug().
+						Uint64("pages_kept", stats.PagesKept.Load()).
+						Uint64("chapters_skipped", stats.ChaptersSkipped.Load()).
+						Msg("Size guard totals")
 				default:
 					// ignored
 				}
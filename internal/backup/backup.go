@@ -0,0 +1,281 @@
+package backup
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/utils/fsutil"
+	"github.com/rs/zerolog/log"
+)
+
+// Store keeps the originals replaced or deleted by the conversions in a directory, under their absolute path, so
+// that the originals of several folders can share it and be restored without knowing where they came from. Each
+// backup of an original is a version, named after the original with the time it was made as suffix, e.g.
+// "Chapter 1.cbz~20261016T180500.000000000Z", so that a new original saved at the same path never loses the older
+// ones.
+type Store struct {
+	dir string
+}
+
+// Retention bounds what the store keeps. The zero Retention keeps everything.
+type Retention struct {
+	// MaxAge is the age from which a backup is removed, 0 for no limit.
+	MaxAge time.Duration
+	// MaxSize is the total size in bytes above which the oldest backups are removed, 0 for no limit.
+	MaxSize int64
+}
+
+// New returns the store of the given directory, creating it when needed.
+func New(dir string) (*Store, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("backup directory is required")
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backup directory: %w", err)
+	}
+	if err := os.MkdirAll(absDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	return &Store{dir: absDir}, nil
+}
+
+// versionSeparator separates the name of the original from the time of its backup.
+const versionSeparator = "~"
+
+// versionLayout is the layout of the time of a backup, in UTC, sorting in the order the backups were made.
+const versionLayout = "20060102T150405.000000000Z"
+
+// Dir returns the absolute path of the backup directory.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Path returns where the backups of the original at the given path are stored, before their version suffix.
+func (s *Store) Path(original string) (string, error) {
+	absPath, err := filepath.Abs(original)
+	if err != nil {
+		return "", err
+	}
+	// The volume of Windows paths, like C:, becomes a folder
+	volume := filepath.VolumeName(absPath)
+	relative := strings.TrimPrefix(absPath, volume)
+	volume = strings.Trim(strings.ReplaceAll(volume, ":", ""), `\/`)
+	return filepath.Join(s.dir, volume, relative), nil
+}
+
+// Latest returns the newest backup of the original at the given path, fs.ErrNotExist when there is none.
+func (s *Store) Latest(original string) (string, error) {
+	backupPath, err := s.Path(original)
+	if err != nil {
+		return "", err
+	}
+	entries, err := os.ReadDir(filepath.Dir(backupPath))
+	if err != nil {
+		return "", err
+	}
+	latest := ""
+	var latestTime time.Time
+	for _, entry := range entries {
+		name, made, ok := parseVersion(entry.Name())
+		if !ok || entry.IsDir() || name != filepath.Base(backupPath) {
+			continue
+		}
+		if latest == "" || made.After(latestTime) {
+			latest = filepath.Join(filepath.Dir(backupPath), entry.Name())
+			latestTime = made
+		}
+	}
+	if latest == "" {
+		return "", fs.ErrNotExist
+	}
+	return latest, nil
+}
+
+// parseVersion splits the name of a backup into the name of its original and the time it was made.
+func parseVersion(fileName string) (string, time.Time, bool) {
+	i := strings.LastIndex(fileName, versionSeparator)
+	if i < 0 {
+		return "", time.Time{}, false
+	}
+	made, err := time.Parse(versionLayout, fileName[i+len(versionSeparator):])
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return fileName[:i], made, true
+}
+
+// Contains tells whether the path is in the backup directory, whose files must not be converted.
+func (s *Store) Contains(path string) bool {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	relative, err := filepath.Rel(s.dir, absPath)
+	return err == nil && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator))
+}
+
+// Save copies the original at the given path into the store, before it gets replaced or deleted, as a new version
+// next to its older backups.
+func (s *Store) Save(original string) error {
+	backupPath, err := s.Path(original)
+	if err != nil {
+		return fmt.Errorf("failed to locate backup of %s: %w", original, err)
+	}
+	now := time.Now()
+	backupPath += versionSeparator + now.UTC().Format(versionLayout)
+
+	if err := fsutil.CopyFile(original, backupPath, fsutil.CopyOptions{}); err != nil {
+		return fmt.Errorf("failed to back up %s: %w", original, err)
+	}
+	// The age of a backup is the time it was made, not the time the original was written
+	if err := os.Chtimes(backupPath, now, now); err != nil {
+		return fmt.Errorf("failed to date backup of %s: %w", original, err)
+	}
+	log.Info().Str("file", original).Str("backup", backupPath).Msg("Original backed up")
+	return nil
+}
+
+// Prune removes the backups older than the maximum age, then the oldest ones until the store fits in the maximum
+// size. Returns the number of removed backups.
+func (s *Store) Prune(retention Retention) (int, error) {
+	if retention.MaxAge <= 0 && retention.MaxSize <= 0 {
+		return 0, nil
+	}
+
+	type backupFile struct {
+		path     string
+		size     int64
+		modified time.Time
+	}
+	var files []backupFile
+	var total int64
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, backupFile{path: path, size: info.Size(), modified: info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	// Oldest first
+	slices.SortFunc(files, func(a, b backupFile) int {
+		return a.modified.Compare(b.modified)
+	})
+	removed := 0
+	for _, file := range files {
+		expired := retention.MaxAge > 0 && time.Since(file.modified) > retention.MaxAge
+		oversized := retention.MaxSize > 0 && total > retention.MaxSize
+		if !expired && !oversized {
+			break
+		}
+		if err := os.Remove(file.path); err != nil {
+			return removed, fmt.Errorf("failed to remove backup %s: %w", file.path, err)
+		}
+		log.Info().Str("backup", file.path).Time("backed_up", file.modified).Bool("expired", expired).Msg("Backup removed by the retention policy")
+		total -= file.size
+		removed++
+		s.removeEmptyDirs(filepath.Dir(file.path))
+	}
+	return removed, nil
+}
+
+// Restore moves the newest backups of the given path, a file or a folder, back in place, replacing what is there.
+// The older versions are left in the store. Returns the restored paths.
+func (s *Store) Restore(path string) ([]string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	backupPath, err := s.Path(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate backup of %s: %w", path, err)
+	}
+
+	// The newest backup of each original, by path of the original
+	backups := make(map[string]string)
+	if info, err := os.Stat(backupPath); err == nil && info.IsDir() {
+		newest := make(map[string]time.Time)
+		err = filepath.WalkDir(backupPath, func(file string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			name, made, ok := parseVersion(d.Name())
+			if !ok {
+				return nil
+			}
+			relative, err := filepath.Rel(backupPath, filepath.Join(filepath.Dir(file), name))
+			if err != nil {
+				return err
+			}
+			original := filepath.Join(absPath, relative)
+			if _, found := backups[original]; !found || made.After(newest[original]) {
+				backups[original] = file
+				newest[original] = made
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list backups of %s: %w", path, err)
+		}
+	} else if latest, err := s.Latest(absPath); err == nil {
+		backups[absPath] = latest
+	}
+	if len(backups) == 0 {
+		return nil, fmt.Errorf("no backup of %s in %s", path, s.dir)
+	}
+
+	originals := make([]string, 0, len(backups))
+	for original := range backups {
+		originals = append(originals, original)
+	}
+	slices.Sort(originals)
+	var restored []string
+	for _, original := range originals {
+		backup := backups[original]
+		if err := moveFile(backup, original); err != nil {
+			return restored, fmt.Errorf("failed to restore %s: %w", original, err)
+		}
+		s.removeEmptyDirs(filepath.Dir(backup))
+		log.Info().Str("file", original).Str("backup", backup).Msg("Original restored")
+		restored = append(restored, original)
+	}
+	return restored, nil
+}
+
+// removeEmptyDirs removes the directory and its parents while they are empty, up to the backup directory.
+func (s *Store) removeEmptyDirs(dir string) {
+	for dir != s.dir && s.Contains(dir) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// moveFile moves src to dst, copying it when they are on different file systems.
+func moveFile(src string, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	if err := fsutil.CopyFile(src, dst, fsutil.CopyOptions{KeepModTime: true}); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
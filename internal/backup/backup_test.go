@@ -0,0 +1,178 @@
+package backup
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, path string, contents string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0644))
+}
+
+func readFile(t *testing.T, path string) string {
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(contents)
+}
+
+func TestStore_Save(t *testing.T) {
+	library := t.TempDir()
+	store, err := New(filepath.Join(t.TempDir(), "backups"))
+	require.NoError(t, err)
+
+	original := filepath.Join(library, "Series", "Chapter 1.cbz")
+	writeFile(t, original, "original")
+	old := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, os.Chtimes(original, old, old))
+
+	require.NoError(t, store.Save(original))
+	backupPath, err := store.Path(original)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(store.Dir(), library, "Series", "Chapter 1.cbz"), backupPath, "the absolute path is mirrored")
+	first, err := store.Latest(original)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(first, backupPath+"~"), "the backup is versioned")
+	assert.Equal(t, "original", readFile(t, first))
+	info, err := os.Stat(first)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), info.ModTime(), time.Minute, "dated when backed up")
+	assert.Equal(t, "original", readFile(t, original), "the original is left in place")
+
+	// Another original saved at the same path is a new version, the first one is kept
+	writeFile(t, original, "another original")
+	require.NoError(t, store.Save(original))
+	second, err := store.Latest(original)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second)
+	assert.Equal(t, "another original", readFile(t, second))
+	assert.Equal(t, "original", readFile(t, first))
+
+	_, err = store.Latest(filepath.Join(library, "Series", "Chapter 2.cbz"))
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.Error(t, store.Save(filepath.Join(library, "missing.cbz")))
+}
+
+func TestStore_Contains(t *testing.T) {
+	dir := t.TempDir()
+	store, err := New(filepath.Join(dir, "backups"))
+	require.NoError(t, err)
+
+	assert.True(t, store.Contains(filepath.Join(dir, "backups")))
+	assert.True(t, store.Contains(filepath.Join(dir, "backups", "library", "Chapter 1.cbz")))
+	assert.False(t, store.Contains(filepath.Join(dir, "backups-old", "Chapter 1.cbz")))
+	assert.False(t, store.Contains(filepath.Join(dir, "Chapter 1.cbz")))
+}
+
+func TestStore_Prune(t *testing.T) {
+	tests := []struct {
+		name      string
+		retention Retention
+		// expected are the backups left, by their age in days
+		expected []int
+	}{
+		{name: "No retention", expected: []int{1, 5, 10}},
+		{name: "Max age", retention: Retention{MaxAge: 7 * 24 * time.Hour}, expected: []int{1, 5}},
+		{name: "Max size", retention: Retention{MaxSize: 250}, expected: []int{1, 5}},
+		{name: "Both", retention: Retention{MaxAge: 7 * 24 * time.Hour, MaxSize: 150}, expected: []int{1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := New(t.TempDir())
+			require.NoError(t, err)
+			for _, age := range []int{1, 5, 10} {
+				path := filepath.Join(store.Dir(), "library", fmt.Sprintf("day%02d", age), "chapter.cbz")
+				writeFile(t, path, string(make([]byte, 100)))
+				modified := time.Now().Add(-time.Duration(age) * 24 * time.Hour)
+				require.NoError(t, os.Chtimes(path, modified, modified))
+			}
+
+			removed, err := store.Prune(tt.retention)
+			require.NoError(t, err)
+			assert.Equal(t, 3-len(tt.expected), removed)
+
+			var left []int
+			for _, age := range []int{1, 5, 10} {
+				dir := filepath.Join(store.Dir(), "library", fmt.Sprintf("day%02d", age))
+				if _, err := os.Stat(dir); err == nil {
+					left = append(left, age)
+				}
+			}
+			assert.Equal(t, tt.expected, left, "the folders of the removed backups are removed too")
+		})
+	}
+}
+
+func TestStore_Restore(t *testing.T) {
+	library := t.TempDir()
+	store, err := New(filepath.Join(t.TempDir(), "backups"))
+	require.NoError(t, err)
+
+	chapters := []string{
+		filepath.Join(library, "Series", "Chapter 1.cbz"),
+		filepath.Join(library, "Series", "Chapter 2.cbr"),
+		filepath.Join(library, "Other", "Chapter 1.cbz"),
+	}
+	for _, chapter := range chapters {
+		writeFile(t, chapter, "original "+chapter)
+		require.NoError(t, store.Save(chapter))
+		writeFile(t, chapter, "converted")
+	}
+	// The CBR was deleted once converted
+	require.NoError(t, os.Remove(chapters[1]))
+
+	restored, err := store.Restore(chapters[2])
+	require.NoError(t, err)
+	assert.Equal(t, []string{chapters[2]}, restored)
+	assert.Equal(t, "original "+chapters[2], readFile(t, chapters[2]))
+	_, err = os.Stat(filepath.Join(store.Dir(), library, "Other"))
+	assert.True(t, os.IsNotExist(err), "the restored backup is moved out of the store")
+
+	restored, err = store.Restore(filepath.Join(library, "Series"))
+	require.NoError(t, err)
+	assert.ElementsMatch(t, chapters[:2], restored)
+	for _, chapter := range chapters[:2] {
+		assert.Equal(t, "original "+chapter, readFile(t, chapter))
+	}
+
+	_, err = store.Restore(filepath.Join(library, "Series"))
+	assert.ErrorContains(t, err, "no backup")
+}
+
+func TestStore_Restore_Versions(t *testing.T) {
+	library := t.TempDir()
+	store, err := New(filepath.Join(t.TempDir(), "backups"))
+	require.NoError(t, err)
+
+	chapter := filepath.Join(library, "Series", "Chapter 1.cbz")
+	writeFile(t, chapter, "first original")
+	require.NoError(t, store.Save(chapter))
+	// A new original dropped at the same path, converted again
+	writeFile(t, chapter, "second original")
+	require.NoError(t, store.Save(chapter))
+	writeFile(t, chapter, "converted")
+
+	restored, err := store.Restore(chapter)
+	require.NoError(t, err)
+	assert.Equal(t, []string{chapter}, restored)
+	assert.Equal(t, "second original", readFile(t, chapter), "the newest backup is restored")
+
+	// The older version is still there, for the folder as well
+	writeFile(t, chapter, "converted")
+	restored, err = store.Restore(filepath.Join(library, "Series"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{chapter}, restored)
+	assert.Equal(t, "first original", readFile(t, chapter))
+
+	_, err = store.Restore(chapter)
+	assert.ErrorContains(t, err, "no backup")
+}
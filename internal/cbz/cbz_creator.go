@@ -3,7 +3,10 @@ package cbz
 import (
 	"archive/zip"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
@@ -11,7 +14,35 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-func WriteChapterToCBZ(chapter *manga.Chapter, outputFilePath string) error {
+// Replaced in tests to simulate failures of the file system.
+var (
+	createTemp = os.CreateTemp
+	syncFile   = (*os.File).Sync
+	renameFile = os.Rename
+)
+
+// WriteOptions tells WriteChapterToCBZ how to write the archive.
+type WriteOptions struct {
+	// Naming tells how the pages are named, empty for NamingSequential.
+	Naming PageNaming
+	// Verify, when set, checks the written archive, given its temporary path, before it replaces the output.
+	// An error leaves the output untouched.
+	Verify func(path string) error
+	// BeforeReplace, when set, is called once the archive is verified, right before it replaces the output.
+	// An error leaves the output untouched.
+	BeforeReplace func() error
+}
+
+// WriteChapterToCBZ writes the pages, the other files and the ComicInfo.xml of the chapter to a CBZ file. Nil
+// options are the zero WriteOptions.
+//
+// The archive is written to a temporary file next to the output, synced to disk, checked, then renamed over the
+// output, so the output, which can be the original archive, is never left truncated or half written. The
+// temporary file is removed when anything fails.
+func WriteChapterToCBZ(chapter *manga.Chapter, outputFilePath string, options *WriteOptions) (err error) {
+	if options == nil {
+		options = &WriteOptions{}
+	}
 	log.Debug().
 		Str("chapter_file", chapter.FilePath).
 		Str("output_path", outputFilePath).
@@ -19,42 +50,133 @@ func WriteChapterToCBZ(chapter *manga.Chapter, outputFilePath string) error {
 		Bool("is_converted", chapter.IsConverted).
 		Msg("Starting CBZ file creation")
 
-	// Create a new ZIP file
-	log.Debug().Str("output_path", outputFilePath).Msg("Creating output CBZ file")
-	zipFile, err := os.Create(outputFilePath)
+	// Create the temporary file in the same directory, a rename can't be atomic across file systems
+	log.Debug().Str("output_path", outputFilePath).Msg("Creating temporary CBZ file")
+	tempFile, err := createTemp(filepath.Dir(outputFilePath), "."+filepath.Base(outputFilePath)+".*.tmp")
 	if err != nil {
 		log.Error().Str("output_path", outputFilePath).Err(err).Msg("Failed to create CBZ file")
 		return fmt.Errorf("failed to create .cbz file: %w", err)
 	}
-	defer errs.Capture(&err, zipFile.Close, "failed to close .cbz file")
+	tempPath := tempFile.Name()
+	closed := false
+	defer func() {
+		if err == nil {
+			return
+		}
+		if !closed {
+			_ = tempFile.Close()
+		}
+		if removeErr := os.Remove(tempPath); removeErr != nil && !os.IsNotExist(removeErr) {
+			log.Warn().Str("temp_path", tempPath).Err(removeErr).Msg("Failed to remove temporary CBZ file")
+		}
+	}()
 
-	// Create a new ZIP writer
-	log.Debug().Str("output_path", outputFilePath).Msg("Creating ZIP writer")
-	zipWriter := zip.NewWriter(zipFile)
+	entries, err := writeZip(chapter, tempFile, outputFilePath, options.Naming)
 	if err != nil {
-		log.Error().Str("output_path", outputFilePath).Err(err).Msg("Failed to create ZIP writer")
 		return err
 	}
+
+	// The data must be on disk before the rename makes it the output
+	if err = syncFile(tempFile); err != nil {
+		log.Error().Str("output_path", outputFilePath).Str("temp_path", tempPath).Err(err).Msg("Failed to sync CBZ file")
+		return fmt.Errorf("failed to sync .cbz file: %w", err)
+	}
+	closed = true
+	if err = tempFile.Close(); err != nil {
+		log.Error().Str("output_path", outputFilePath).Str("temp_path", tempPath).Err(err).Msg("Failed to close CBZ file")
+		return fmt.Errorf("failed to close .cbz file: %w", err)
+	}
+
+	if err = verifyArchive(tempPath, entries); err != nil {
+		log.Error().Str("output_path", outputFilePath).Str("temp_path", tempPath).Err(err).Msg("Written CBZ file is invalid")
+		return fmt.Errorf("written .cbz file is invalid: %w", err)
+	}
+	if options.Verify != nil {
+		log.Debug().Str("output_path", outputFilePath).Str("temp_path", tempPath).Msg("Verifying written CBZ file")
+		if err = options.Verify(tempPath); err != nil {
+			log.Error().Str("output_path", outputFilePath).Str("temp_path", tempPath).Err(err).Msg("Written CBZ file failed verification, leaving the output untouched")
+			return fmt.Errorf("written .cbz file failed verification: %w", err)
+		}
+	}
+
+	// Keep the permissions of the file being replaced
+	mode := os.FileMode(0644)
+	if info, statErr := os.Stat(outputFilePath); statErr == nil {
+		mode = info.Mode().Perm()
+	}
+	if err = os.Chmod(tempPath, mode); err != nil {
+		log.Error().Str("temp_path", tempPath).Err(err).Msg("Failed to set CBZ file permissions")
+		return fmt.Errorf("failed to set .cbz file permissions: %w", err)
+	}
+
+	if options.BeforeReplace != nil {
+		if err = options.BeforeReplace(); err != nil {
+			log.Error().Str("output_path", outputFilePath).Err(err).Msg("Failed to prepare the replacement of the output, leaving it untouched")
+			return fmt.Errorf("failed to prepare the replacement of the output: %w", err)
+		}
+	}
+
+	if err = renameFile(tempPath, outputFilePath); err != nil {
+		log.Error().Str("output_path", outputFilePath).Str("temp_path", tempPath).Err(err).Msg("Failed to move CBZ file into place")
+		return fmt.Errorf("failed to move .cbz file into place: %w", err)
+	}
+	syncDir(filepath.Dir(outputFilePath))
+
+	log.Debug().Str("output_path", outputFilePath).Int("entries", entries).Msg("CBZ file creation completed successfully")
+	return nil
+}
+
+// syncDir syncs the directory so that the rename survives a crash. Failures are only logged, the file systems
+// that can't sync directories keep the rename anyway.
+func syncDir(dir string) {
+	dirFile, err := os.Open(dir)
+	if err != nil {
+		log.Debug().Str("dir", dir).Err(err).Msg("Failed to open directory to sync it")
+		return
+	}
+	defer func() { _ = dirFile.Close() }()
+	if err := dirFile.Sync(); err != nil {
+		log.Debug().Str("dir", dir).Err(err).Msg("Failed to sync directory")
+	}
+}
+
+// verifyArchive checks that the written file can be read back as a zip archive with the expected number of entries.
+func verifyArchive(path string, expectedEntries int) (err error) {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer errs.Capture(&err, reader.Close, "failed to close written .cbz file")
+	if len(reader.File) != expectedEntries {
+		return fmt.Errorf("expected %d entries, found %d", expectedEntries, len(reader.File))
+	}
+	return nil
+}
+
+// writeZip writes the archive of the chapter and returns its number of entries.
+func writeZip(chapter *manga.Chapter, zipFile io.Writer, outputFilePath string, naming PageNaming) (entries int, err error) {
+	// Create a new ZIP writer
+	log.Debug().Str("output_path", outputFilePath).Msg("Creating ZIP writer")
+	zipWriter := zip.NewWriter(zipFile)
 	defer errs.Capture(&err, zipWriter.Close, "failed to close .cbz writer")
 
 	// Write each page to the ZIP archive
 	log.Debug().Str("output_path", outputFilePath).Int("pages_to_write", len(chapter.Pages)).Msg("Writing pages to CBZ archive")
+	// The pages can't take the names of the other files
+	usedNames := map[string]bool{"comicinfo.xml": true}
+	for _, file := range chapter.OtherFiles {
+		usedNames[strings.ToLower(file.Path)] = true
+	}
 	for _, page := range chapter.Pages {
-		// Construct the file name for the page
-		var fileName string
-		if page.IsSplitted {
-			// Use the format page%03d-%02d for split pages
-			fileName = fmt.Sprintf("%04d-%02d%s", page.Index, page.SplitPartIndex, page.Extension)
-		} else {
-			// Use the format page%03d for non-split pages
-			fileName = fmt.Sprintf("%04d%s", page.Index, page.Extension)
-		}
+		// Construct the file name for the page, split pages get their part index as suffix
+		fileName := naming.pageFileName(chapter, page, usedNames)
 
 		log.Debug().
 			Str("output_path", outputFilePath).
 			Uint16("page_index", page.Index).
 			Bool("is_splitted", page.IsSplitted).
 			Uint16("split_part", page.SplitPartIndex).
+			Str("original_path", page.Path).
 			Str("filename", fileName).
 			Int("size", len(page.Contents.Bytes())).
 			Msg("Writing page to CBZ archive")
@@ -67,15 +189,16 @@ func WriteChapterToCBZ(chapter *manga.Chapter, outputFilePath string) error {
 		})
 		if err != nil {
 			log.Error().Str("output_path", outputFilePath).Str("filename", fileName).Err(err).Msg("Failed to create file in CBZ archive")
-			return fmt.Errorf("failed to create file in .cbz: %w", err)
+			return entries, fmt.Errorf("failed to create file in .cbz: %w", err)
 		}
 
 		// Write the page contents to the file
 		bytesWritten, err := fileWriter.Write(page.Contents.Bytes())
 		if err != nil {
 			log.Error().Str("output_path", outputFilePath).Str("filename", fileName).Err(err).Msg("Failed to write page contents")
-			return fmt.Errorf("failed to write page contents: %w", err)
+			return entries, fmt.Errorf("failed to write page contents: %w", err)
 		}
+		entries++
 
 		log.Debug().
 			Str("output_path", outputFilePath).
@@ -84,6 +207,25 @@ func WriteChapterToCBZ(chapter *manga.Chapter, outputFilePath string) error {
 			Msg("Page written successfully")
 	}
 
+	// Write the files that aren't pages back under their own path
+	for _, file := range chapter.OtherFiles {
+		log.Debug().Str("output_path", outputFilePath).Str("filename", file.Path).Int("size", len(file.Contents)).Msg("Writing other file to CBZ archive")
+		fileWriter, err := zipWriter.CreateHeader(&zip.FileHeader{
+			Name:     file.Path,
+			Method:   zip.Deflate,
+			Modified: time.Now(),
+		})
+		if err != nil {
+			log.Error().Str("output_path", outputFilePath).Str("filename", file.Path).Err(err).Msg("Failed to create file in CBZ archive")
+			return entries, fmt.Errorf("failed to create %s in .cbz: %w", file.Path, err)
+		}
+		if _, err := fileWriter.Write(file.Contents); err != nil {
+			log.Error().Str("output_path", outputFilePath).Str("filename", file.Path).Err(err).Msg("Failed to write file contents")
+			return entries, fmt.Errorf("failed to write %s contents: %w", file.Path, err)
+		}
+		entries++
+	}
+
 	// Optionally, write the ComicInfo.xml file if present
 	if chapter.ComicInfoXml != "" {
 		log.Debug().Str("output_path", outputFilePath).Int("xml_size", len(chapter.ComicInfoXml)).Msg("Writing ComicInfo.xml to CBZ archive")
@@ -94,14 +236,15 @@ func WriteChapterToCBZ(chapter *manga.Chapter, outputFilePath string) error {
 		})
 		if err != nil {
 			log.Error().Str("output_path", outputFilePath).Err(err).Msg("Failed to create ComicInfo.xml in CBZ archive")
-			return fmt.Errorf("failed to create ComicInfo.xml in .cbz: %w", err)
+			return entries, fmt.Errorf("failed to create ComicInfo.xml in .cbz: %w", err)
 		}
 
 		bytesWritten, err := comicInfoWriter.Write([]byte(chapter.ComicInfoXml))
 		if err != nil {
 			log.Error().Str("output_path", outputFilePath).Err(err).Msg("Failed to write ComicInfo.xml contents")
-			return fmt.Errorf("failed to write ComicInfo.xml contents: %w", err)
+			return entries, fmt.Errorf("failed to write ComicInfo.xml contents: %w", err)
 		}
+		entries++
 		log.Debug().Str("output_path", outputFilePath).Int("bytes_written", bytesWritten).Msg("ComicInfo.xml written successfully")
 	} else {
 		log.Debug().Str("output_path", outputFilePath).Msg("No ComicInfo.xml to write")
@@ -113,11 +256,10 @@ func WriteChapterToCBZ(chapter *manga.Chapter, outputFilePath string) error {
 		err = zipWriter.SetComment(convertedString)
 		if err != nil {
 			log.Error().Str("output_path", outputFilePath).Err(err).Msg("Failed to write CBZ comment")
-			return fmt.Errorf("failed to write comment: %w", err)
+			return entries, fmt.Errorf("failed to write comment: %w", err)
 		}
 		log.Debug().Str("output_path", outputFilePath).Msg("CBZ comment set successfully")
 	}
 
-	log.Debug().Str("output_path", outputFilePath).Msg("CBZ file creation completed successfully")
-	return nil
+	return entries, nil
 }
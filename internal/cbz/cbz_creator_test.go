@@ -3,8 +3,10 @@ package cbz
 import (
 	"archive/zip"
 	"bytes"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -19,6 +21,7 @@ func TestWriteChapterToCBZ(t *testing.T) {
 	testCases := []struct {
 		name            string
 		chapter         *manga.Chapter
+		naming          PageNaming
 		expectedFiles   []string
 		expectedComment string
 	}{
@@ -88,6 +91,62 @@ func TestWriteChapterToCBZ(t *testing.T) {
 			},
 			expectedFiles: []string{"0000-01.jpg"},
 		},
+		{
+			name: "Other files kept under their path",
+			chapter: &manga.Chapter{
+				Pages: []*manga.Page{
+					{
+						Index:     0,
+						Extension: ".jpg",
+						Contents:  bytes.NewBuffer([]byte("image data")),
+					},
+				},
+				OtherFiles: []*manga.File{
+					{Path: "release.nfo", Contents: []byte("release notes")},
+					{Path: "extras/credits.txt", Contents: []byte("credits")},
+				},
+			},
+			expectedFiles: []string{"0000.jpg", "release.nfo", "extras/credits.txt"},
+		},
+		{
+			name: "Original names",
+			chapter: &manga.Chapter{
+				Pages: []*manga.Page{
+					{Index: 0, Path: "cover.jpg", Extension: ".webp", Contents: bytes.NewBuffer([]byte("cover"))},
+					{Index: 1, Path: "scans/c012_p003.png", Extension: ".webp", Contents: bytes.NewBuffer([]byte("page"))},
+					{Index: 2, Path: "long.jpg", Extension: ".webp", Contents: bytes.NewBuffer([]byte("part 0")), IsSplitted: true, SplitPartIndex: 0},
+					{Index: 2, Path: "long.jpg", Extension: ".webp", Contents: bytes.NewBuffer([]byte("part 1")), IsSplitted: true, SplitPartIndex: 1},
+					{Index: 3, Extension: ".webp", Contents: bytes.NewBuffer([]byte("no original name"))},
+				},
+			},
+			naming:        NamingOriginal,
+			expectedFiles: []string{"cover.webp", "scans/c012_p003.webp", "long-00.webp", "long-01.webp", "0003.webp"},
+		},
+		{
+			name: "Original names colliding once converted",
+			chapter: &manga.Chapter{
+				Pages: []*manga.Page{
+					{Index: 0, Path: "001.jpg", Extension: ".webp", Contents: bytes.NewBuffer([]byte("jpeg"))},
+					{Index: 1, Path: "001.png", Extension: ".webp", Contents: bytes.NewBuffer([]byte("png"))},
+					{Index: 2, Path: "credits.png", Extension: ".txt", Contents: bytes.NewBuffer([]byte("page"))},
+				},
+				OtherFiles: []*manga.File{{Path: "credits.txt", Contents: []byte("credits")}},
+			},
+			naming:        NamingOriginal,
+			expectedFiles: []string{"001.webp", "001_2.webp", "credits_2.txt", "credits.txt"},
+		},
+		{
+			name: "Template",
+			chapter: &manga.Chapter{
+				FilePath: "/library/Chapter 12.cbz",
+				Pages: []*manga.Page{
+					{Index: 0, Path: "cover.jpg", Extension: ".webp", Contents: bytes.NewBuffer([]byte("cover"))},
+					{Index: 1, Path: "p1.jpg", Extension: ".webp", Contents: bytes.NewBuffer([]byte("part 0")), IsSplitted: true, SplitPartIndex: 0},
+				},
+			},
+			naming:        "{chapter}-{index:03}-{name}",
+			expectedFiles: []string{"Chapter 12-000-cover.webp", "Chapter 12-001-p1-00.webp"},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -100,7 +159,7 @@ func TestWriteChapterToCBZ(t *testing.T) {
 			defer errs.CaptureGeneric(&err, os.Remove, tempFile.Name(), "failed to remove temporary file")
 
 			// Write the chapter to the .cbz file
-			err = WriteChapterToCBZ(tc.chapter, tempFile.Name())
+			err = WriteChapterToCBZ(tc.chapter, tempFile.Name(), &WriteOptions{Naming: tc.naming})
 			if err != nil {
 				t.Fatalf("Failed to write chapter to CBZ: %v", err)
 			}
@@ -143,3 +202,125 @@ func TestWriteChapterToCBZ(t *testing.T) {
 		})
 	}
 }
+
+func TestWriteChapterToCBZ_Failures(t *testing.T) {
+	chapter := &manga.Chapter{
+		Pages: []*manga.Page{
+			{
+				Index:     0,
+				Extension: ".webp",
+				Contents:  bytes.NewBuffer([]byte("converted image data")),
+			},
+		},
+		ComicInfoXml: "<Series>Boundless Necromancer</Series>",
+	}
+
+	testCases := []struct {
+		name  string
+		setup func()
+	}{
+		{
+			name: "Write failure",
+			setup: func() {
+				// A file opened read only fails every write, like a full disk
+				createTemp = func(dir, pattern string) (*os.File, error) {
+					file, err := os.CreateTemp(dir, pattern)
+					if err != nil {
+						return nil, err
+					}
+					if err := file.Close(); err != nil {
+						return nil, err
+					}
+					return os.Open(file.Name())
+				}
+			},
+		},
+		{
+			name: "Sync failure",
+			setup: func() {
+				syncFile = func(*os.File) error {
+					return errors.New("input/output error")
+				}
+			},
+		},
+		{
+			name: "Rename failure",
+			setup: func() {
+				renameFile = func(string, string) error {
+					return errors.New("killed")
+				}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Cleanup(func() {
+				createTemp = os.CreateTemp
+				syncFile = (*os.File).Sync
+				renameFile = os.Rename
+			})
+			dir := t.TempDir()
+			outputPath := filepath.Join(dir, "Chapter 1.cbz")
+			if err := os.WriteFile(outputPath, []byte("original archive"), 0644); err != nil {
+				t.Fatalf("Failed to write original archive: %v", err)
+			}
+
+			tc.setup()
+			if err := WriteChapterToCBZ(chapter, outputPath, nil); err == nil {
+				t.Fatalf("Expected the write to fail")
+			}
+
+			contents, err := os.ReadFile(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to read original archive: %v", err)
+			}
+			if string(contents) != "original archive" {
+				t.Errorf("Expected the original archive to be intact, but got %q", contents)
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatalf("Failed to list directory: %v", err)
+			}
+			if len(entries) != 1 {
+				t.Errorf("Expected the temporary file to be removed, but found %d files", len(entries))
+			}
+		})
+	}
+}
+
+func TestWriteChapterToCBZ_ReplacesAtomically(t *testing.T) {
+	dir := t.TempDir()
+	outputPath := filepath.Join(dir, "Chapter 1.cbz")
+	if err := os.WriteFile(outputPath, []byte("original archive"), 0600); err != nil {
+		t.Fatalf("Failed to write original archive: %v", err)
+	}
+
+	chapter := &manga.Chapter{Pages: []*manga.Page{{Index: 0, Extension: ".webp", Contents: bytes.NewBuffer([]byte("image data"))}}}
+	if err := WriteChapterToCBZ(chapter, outputPath, nil); err != nil {
+		t.Fatalf("Failed to write chapter to CBZ: %v", err)
+	}
+
+	info, err := os.Stat(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to stat CBZ file: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the permissions of the original to be kept, but got %v", info.Mode().Perm())
+	}
+	r, err := zip.OpenReader(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to open CBZ file: %v", err)
+	}
+	defer errs.Capture(&err, r.Close, "failed to close CBZ file")
+	if len(r.File) != 1 || r.File[0].Name != "0000.webp" {
+		t.Errorf("Expected the converted archive, but got %d files", len(r.File))
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to list directory: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected only the CBZ file in the directory, but found %d files", len(entries))
+	}
+}
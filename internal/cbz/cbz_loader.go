@@ -9,6 +9,7 @@ import (
 	"io"
 	"io/fs"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/araddon/dateparse"
@@ -18,9 +19,16 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-func LoadChapter(filePath string) (*manga.Chapter, error) {
+// LoadChapter loads the pages and the metadata of the archive. Files matching the ignore patterns of the options
+// are skipped, and the files that aren't images, whatever their extension, are kept aside or dropped following
+// their policy instead of becoming pages. Nil options are DefaultLoadOptions.
+func LoadChapter(filePath string, options *LoadOptions) (*manga.Chapter, error) {
 	log.Debug().Str("file_path", filePath).Msg("Starting chapter loading")
 
+	if options == nil {
+		options = DefaultLoadOptions()
+	}
+
 	ctx := context.Background()
 
 	chapter := &manga.Chapter{
@@ -68,16 +76,37 @@ func LoadChapter(filePath string) (*manga.Chapter, error) {
 
 	// Walk through all files in the filesystem
 	log.Debug().Str("file_path", filePath).Msg("Starting filesystem walk")
+	var paths []string
 	err = fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
-		if d.IsDir() {
-			return nil
+		if !d.IsDir() {
+			paths = append(paths, path)
 		}
+		return nil
+	})
+
+	if err != nil {
+		log.Error().Str("file_path", filePath).Err(err).Msg("Failed during filesystem walk")
+		return nil, err
+	}
 
-		return func() error {
+	// The walk is in lexical order, the pages are indexed in natural order so that page2 comes before page10
+	sort.SliceStable(paths, func(i, j int) bool {
+		return naturalLess(paths[i], paths[j])
+	})
+
+	ignored := 0
+	for _, path := range paths {
+		if options.isIgnored(path) {
+			log.Debug().Str("file_path", filePath).Str("archive_file", path).Msg("Ignoring archive file")
+			ignored++
+			continue
+		}
+
+		err = func() (err error) {
 			// Open the file
 			file, err := fsys.Open(path)
 			if err != nil {
@@ -120,7 +149,7 @@ func LoadChapter(filePath string) (*manga.Chapter, error) {
 				}
 			} else {
 				// Read the file contents for page
-				log.Debug().Str("file_path", filePath).Str("archive_file", path).Str("extension", ext).Msg("Processing page file")
+				log.Debug().Str("file_path", filePath).Str("archive_file", path).Str("extension", ext).Msg("Processing archive file")
 				buf := new(bytes.Buffer)
 				bytesCopied, err := io.Copy(buf, file)
 				if err != nil {
@@ -128,9 +157,21 @@ func LoadChapter(filePath string) (*manga.Chapter, error) {
 					return fmt.Errorf("failed to read file contents: %w", err)
 				}
 
+				// Files that aren't images would fail to decode and abort the conversion of the chapter
+				if !isImage(buf.Bytes()) {
+					if options.OtherFiles == OtherFilesDrop {
+						log.Info().Str("file_path", filePath).Str("archive_file", path).Msg("Dropping non-image file")
+						return nil
+					}
+					log.Info().Str("file_path", filePath).Str("archive_file", path).Msg("Keeping non-image file as is")
+					chapter.OtherFiles = append(chapter.OtherFiles, &manga.File{Path: path, Contents: buf.Bytes()})
+					return nil
+				}
+
 				// Create a new Page object
 				page := &manga.Page{
 					Index:      uint16(len(chapter.Pages)), // Simple index based on order
+					Path:       path,
 					Extension:  ext,
 					Size:       uint64(buf.Len()),
 					Contents:   buf,
@@ -148,16 +189,17 @@ func LoadChapter(filePath string) (*manga.Chapter, error) {
 			}
 			return nil
 		}()
-	})
-
-	if err != nil {
-		log.Error().Str("file_path", filePath).Err(err).Msg("Failed during filesystem walk")
-		return nil, err
+		if err != nil {
+			log.Error().Str("file_path", filePath).Str("archive_file", path).Err(err).Msg("Failed to load archive file")
+			return nil, err
+		}
 	}
 
 	log.Debug().
 		Str("file_path", filePath).
 		Int("pages_loaded", len(chapter.Pages)).
+		Int("other_files", len(chapter.OtherFiles)).
+		Int("ignored_files", ignored).
 		Bool("is_converted", chapter.IsConverted).
 		Bool("has_comic_info", chapter.ComicInfoXml != "").
 		Msg("Chapter loading completed successfully")
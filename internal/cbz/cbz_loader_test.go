@@ -1,6 +1,9 @@
 package cbz
 
 import (
+	"archive/zip"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -41,7 +44,7 @@ func TestLoadChapter(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			chapter, err := LoadChapter(tc.filePath)
+			chapter, err := LoadChapter(tc.filePath, nil)
 			if err != nil {
 				t.Fatalf("Failed to load chapter: %v", err)
 			}
@@ -61,3 +64,143 @@ func TestLoadChapter(t *testing.T) {
 		})
 	}
 }
+
+const jpegSignature = "\xFF\xD8\xFF"
+
+// writeArchive writes a CBZ with the entries, in that order, and returns its path.
+func writeArchive(t *testing.T, entries []string, contents map[string]string) string {
+	filePath := filepath.Join(t.TempDir(), "chapter.cbz")
+	file, err := os.Create(filePath)
+	if err != nil {
+		t.Fatalf("Failed to create archive: %v", err)
+	}
+	zipWriter := zip.NewWriter(file)
+	for _, entry := range entries {
+		writer, err := zipWriter.Create(entry)
+		if err != nil {
+			t.Fatalf("Failed to create archive entry: %v", err)
+		}
+		if _, err := writer.Write([]byte(contents[entry])); err != nil {
+			t.Fatalf("Failed to write archive entry: %v", err)
+		}
+	}
+	if err := zipWriter.Close(); err != nil {
+		t.Fatalf("Failed to close zip writer: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatalf("Failed to close archive: %v", err)
+	}
+	return filePath
+}
+
+func TestLoadChapter_NaturalOrder(t *testing.T) {
+	// The entries are written in lexical order, as most archivers do
+	entries := []string{"1.jpg", "10.jpg", "2.jpg", "ch1/p1.jpg", "ch1/p10.jpg", "ch1/p2.jpg"}
+	expected := []string{"1.jpg", "2.jpg", "10.jpg", "ch1/p1.jpg", "ch1/p2.jpg", "ch1/p10.jpg"}
+
+	contents := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		// The pages must look like images
+		contents[entry] = jpegSignature + entry
+	}
+
+	chapter, err := LoadChapter(writeArchive(t, entries, contents), nil)
+	if err != nil {
+		t.Fatalf("Failed to load chapter: %v", err)
+	}
+	if len(chapter.Pages) != len(expected) {
+		t.Fatalf("Expected %d pages, but got %d", len(expected), len(chapter.Pages))
+	}
+	for i, page := range chapter.Pages {
+		if int(page.Index) != i {
+			t.Errorf("Expected page %d to have index %d, but got %d", i, i, page.Index)
+		}
+		if page.Path != expected[i] {
+			t.Errorf("Expected page %d to have path %s, but got %s", i, expected[i], page.Path)
+		}
+		if page.Contents.String() != jpegSignature+expected[i] {
+			t.Errorf("Expected page %d to be %s, but got %s", i, expected[i], page.Contents.String()[len(jpegSignature):])
+		}
+	}
+}
+
+func TestLoadChapter_NonImageFiles(t *testing.T) {
+	contents := map[string]string{
+		"ComicInfo.xml":        "<Series>Boundless Necromancer</Series>",
+		"001.jpg":              jpegSignature + "page",
+		"002.png":              "\x89PNG\r\n\x1a\npage",
+		"Thumbs.db":            "thumbnails",
+		".DS_Store":            "finder",
+		"__MACOSX/._001.jpg":   "resource fork",
+		"release.nfo":          "release notes",
+		"release.sfv":          "001.jpg 12345678",
+		"site.url":             "[InternetShortcut]",
+		"misnamed.jpg":         "not an image",
+		"scans/credits.txt":    "credits",
+		"scans/Thumbs.db":      "thumbnails",
+		"scans/003.webp":       "RIFF\x00\x00\x00\x00WEBPVP8 ",
+		"__MACOSX/scans/._003": "resource fork",
+	}
+	var entries []string
+	for entry := range contents {
+		entries = append(entries, entry)
+	}
+	archive := writeArchive(t, entries, contents)
+
+	testCases := []struct {
+		name               string
+		options            *LoadOptions
+		expectedPages      []string
+		expectedOtherFiles []string
+	}{
+		{
+			name:               "Kept by default",
+			expectedPages:      []string{".jpg", ".png", ".webp"},
+			expectedOtherFiles: []string{"misnamed.jpg", "release.nfo", "release.sfv", "scans/credits.txt", "site.url"},
+		},
+		{
+			name:          "Dropped",
+			options:       &LoadOptions{Ignore: DefaultIgnorePatterns, OtherFiles: OtherFilesDrop},
+			expectedPages: []string{".jpg", ".png", ".webp"},
+		},
+		{
+			name:               "Custom ignore list",
+			options:            &LoadOptions{Ignore: []string{"*.SFV", "*.url", "scans"}, OtherFiles: OtherFilesKeep},
+			expectedPages:      []string{".jpg", ".png"},
+			expectedOtherFiles: []string{".DS_Store", "__MACOSX/._001.jpg", "misnamed.jpg", "release.nfo", "Thumbs.db"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			chapter, err := LoadChapter(archive, tc.options)
+			if err != nil {
+				t.Fatalf("Failed to load chapter: %v", err)
+			}
+
+			if len(chapter.Pages) != len(tc.expectedPages) {
+				t.Fatalf("Expected %d pages, but got %d", len(tc.expectedPages), len(chapter.Pages))
+			}
+			for i, page := range chapter.Pages {
+				if page.Extension != tc.expectedPages[i] {
+					t.Errorf("Expected page %d to be a %s, but got %s", i, tc.expectedPages[i], page.Extension)
+				}
+			}
+
+			var otherFiles []string
+			for _, file := range chapter.OtherFiles {
+				otherFiles = append(otherFiles, file.Path)
+				if string(file.Contents) != contents[file.Path] {
+					t.Errorf("Expected %s to be kept as is", file.Path)
+				}
+			}
+			if strings.Join(otherFiles, ",") != strings.Join(tc.expectedOtherFiles, ",") {
+				t.Errorf("Expected other files %v, but got %v", tc.expectedOtherFiles, otherFiles)
+			}
+
+			if !strings.Contains(chapter.ComicInfoXml, "Boundless Necromancer") {
+				t.Errorf("ComicInfo.xml isn't loaded")
+			}
+		})
+	}
+}
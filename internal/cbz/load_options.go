@@ -0,0 +1,70 @@
+package cbz
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// OtherFilesPolicy tells what happens to the files of the archive that aren't pages, like .nfo or .sfv files.
+type OtherFilesPolicy string
+
+const (
+	// OtherFilesKeep writes them back as they are in the converted archive.
+	OtherFilesKeep OtherFilesPolicy = "keep"
+	// OtherFilesDrop leaves them out of the converted archive.
+	OtherFilesDrop OtherFilesPolicy = "drop"
+)
+
+// OtherFilesPolicies lists the supported policies.
+var OtherFilesPolicies = []OtherFilesPolicy{OtherFilesKeep, OtherFilesDrop}
+
+// DefaultIgnorePatterns are the files left behind by the operating systems, which are never worth keeping.
+var DefaultIgnorePatterns = []string{"__MACOSX", ".DS_Store", "._*", "Thumbs.db", "desktop.ini"}
+
+// LoadOptions tells LoadChapter which files of the archive are loaded.
+type LoadOptions struct {
+	// Ignore are the glob patterns of the files that are always dropped. A pattern matches the path of the file
+	// in the archive or any of its elements, so a folder name drops the whole folder. The case is ignored.
+	Ignore []string
+	// OtherFiles is what happens to the files that aren't pages, ComicInfo.xml aside. Empty means OtherFilesKeep.
+	OtherFiles OtherFilesPolicy
+}
+
+// DefaultLoadOptions ignores the DefaultIgnorePatterns and keeps the other files.
+func DefaultLoadOptions() *LoadOptions {
+	return &LoadOptions{Ignore: slices.Clone(DefaultIgnorePatterns), OtherFiles: OtherFilesKeep}
+}
+
+// Validate checks the policy and the syntax of the patterns.
+func (o *LoadOptions) Validate() error {
+	if o.OtherFiles != "" && !slices.Contains(OtherFilesPolicies, o.OtherFiles) {
+		names := make([]string, len(OtherFilesPolicies))
+		for i, policy := range OtherFilesPolicies {
+			names[i] = string(policy)
+		}
+		return fmt.Errorf("invalid other files policy \"%s\", available options are %s", o.OtherFiles, strings.Join(names, ", "))
+	}
+	for _, pattern := range o.Ignore {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid ignore pattern \"%s\": %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// isIgnored tells whether the file at the given path of the archive matches one of the ignore patterns.
+func (o *LoadOptions) isIgnored(filePath string) bool {
+	filePath = strings.ToLower(filePath)
+	candidates := append([]string{filePath}, strings.Split(filePath, "/")...)
+	for _, pattern := range o.Ignore {
+		pattern = strings.ToLower(pattern)
+		for _, candidate := range candidates {
+			if matched, _ := path.Match(pattern, candidate); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
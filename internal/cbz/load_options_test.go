@@ -0,0 +1,57 @@
+package cbz
+
+import (
+	"testing"
+)
+
+func TestLoadOptions_Validate(t *testing.T) {
+	testCases := []struct {
+		name        string
+		options     LoadOptions
+		expectError bool
+	}{
+		{name: "Defaults", options: *DefaultLoadOptions()},
+		{name: "Empty", options: LoadOptions{}},
+		{name: "Drop", options: LoadOptions{OtherFiles: OtherFilesDrop}},
+		{name: "Unknown policy", options: LoadOptions{OtherFiles: "delete"}, expectError: true},
+		{name: "Invalid pattern", options: LoadOptions{Ignore: []string{"[a-"}}, expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.options.Validate()
+			if tc.expectError && err == nil {
+				t.Errorf("Expected an error")
+			}
+			if !tc.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadOptions_IsIgnored(t *testing.T) {
+	options := DefaultLoadOptions()
+	testCases := []struct {
+		path     string
+		expected bool
+	}{
+		{path: "Thumbs.db", expected: true},
+		{path: "scans/thumbs.db", expected: true},
+		{path: ".DS_Store", expected: true},
+		{path: "__MACOSX/._001.jpg", expected: true},
+		{path: "__MACOSX/scans/001.jpg", expected: true},
+		{path: "scans/._001.jpg", expected: true},
+		{path: "001.jpg", expected: false},
+		{path: "release.nfo", expected: false},
+		{path: "macosx/001.jpg", expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			if actual := options.isIgnored(tc.path); actual != tc.expected {
+				t.Errorf("Expected %s to be ignored: %t, but got %t", tc.path, tc.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package cbz
+
+import (
+	"cmp"
+	"strings"
+)
+
+// naturalLess reports whether path a sorts before path b in natural order: the folders are compared one by one
+// and the runs of digits are compared by their numeric value, so "page2.jpg" comes before "page10.jpg" and
+// "ch2/p1.jpg" before "ch10/p1.jpg". Letters are compared case-insensitively, ties are broken by the raw path.
+func naturalLess(a, b string) bool {
+	aParts, bParts := strings.Split(a, "/"), strings.Split(b, "/")
+	for i := 0; i < len(aParts) && i < len(bParts); i++ {
+		if c := naturalCompare(aParts[i], bParts[i]); c != 0 {
+			return c < 0
+		}
+	}
+	if len(aParts) != len(bParts) {
+		return len(aParts) < len(bParts)
+	}
+	return a < b
+}
+
+// naturalCompare compares two names in natural order, returning -1, 0 or 1.
+// Numbers differing only by their leading zeros, like "01" and "1", are equal.
+func naturalCompare(a, b string) int {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if isDigit(a[i]) && isDigit(b[j]) {
+			aStart, bStart := i, j
+			for i < len(a) && isDigit(a[i]) {
+				i++
+			}
+			for j < len(b) && isDigit(b[j]) {
+				j++
+			}
+			aNumber := strings.TrimLeft(a[aStart:i], "0")
+			bNumber := strings.TrimLeft(b[bStart:j], "0")
+			// Without the leading zeros, the longest number is the biggest
+			if len(aNumber) != len(bNumber) {
+				return cmp.Compare(len(aNumber), len(bNumber))
+			}
+			if c := strings.Compare(aNumber, bNumber); c != 0 {
+				return c
+			}
+			continue
+		}
+
+		aChar, bChar := toLower(a[i]), toLower(b[j])
+		if aChar != bChar {
+			return cmp.Compare(aChar, bChar)
+		}
+		i++
+		j++
+	}
+	return cmp.Compare(len(a)-i, len(b)-j)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func toLower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
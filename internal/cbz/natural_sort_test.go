@@ -0,0 +1,49 @@
+package cbz
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestNaturalLess(t *testing.T) {
+	testCases := []struct {
+		name     string
+		paths    []string
+		expected []string
+	}{
+		{
+			name:     "Numbers without padding",
+			paths:    []string{"10.jpg", "2.jpg", "1.jpg"},
+			expected: []string{"1.jpg", "2.jpg", "10.jpg"},
+		},
+		{
+			name:     "Mixed padding",
+			paths:    []string{"page10.jpg", "page002.jpg", "page1.jpg", "page01.jpg"},
+			expected: []string{"page01.jpg", "page1.jpg", "page002.jpg", "page10.jpg"},
+		},
+		{
+			name:     "Nested folders",
+			paths:    []string{"ch10/p1.jpg", "ch1/p10.jpg", "ch2/p1.jpg", "ch1/p2.jpg", "ch1/p1.jpg"},
+			expected: []string{"ch1/p1.jpg", "ch1/p2.jpg", "ch1/p10.jpg", "ch2/p1.jpg", "ch10/p1.jpg"},
+		},
+		{
+			name:     "Case insensitive",
+			paths:    []string{"b.jpg", "Page 2.jpg", "a.jpg", "page 1.jpg"},
+			expected: []string{"a.jpg", "b.jpg", "page 1.jpg", "Page 2.jpg"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			paths := append([]string{}, tc.paths...)
+			sort.SliceStable(paths, func(i, j int) bool {
+				return naturalLess(paths[i], paths[j])
+			})
+			for i := range tc.expected {
+				if paths[i] != tc.expected[i] {
+					t.Fatalf("Expected order %v, but got %v", tc.expected, paths)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package cbz
+
+import (
+	"bytes"
+)
+
+// imageSignatures are the magic bytes of the image formats a page can be in, the ones with a registered decoder.
+var imageSignatures = [][]byte{
+	[]byte("\xFF\xD8\xFF"),                   // JPEG
+	[]byte("\x89PNG\r\n\x1a\n"),              // PNG
+	[]byte("GIF87a"),                         // GIF
+	[]byte("GIF89a"),                         // GIF
+	[]byte("II*\x00"),                        // TIFF, little endian
+	[]byte("MM\x00*"),                        // TIFF, big endian
+	[]byte("\xFF\x0A"),                       // JPEG XL codestream
+	[]byte("\x00\x00\x00\x0CJXL \r\n\x87\n"), // JPEG XL container
+}
+
+// isImage tells from its contents whether a file is an image, whatever its name says.
+func isImage(data []byte) bool {
+	for _, signature := range imageSignatures {
+		if bytes.HasPrefix(data, signature) {
+			return true
+		}
+	}
+	// The two letters of the BMP signature are too common in text, its reserved bytes must be zero as well
+	if len(data) >= 14 && string(data[:2]) == "BM" && bytes.Equal(data[6:10], []byte{0, 0, 0, 0}) {
+		return true
+	}
+	if len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP" {
+		return true
+	}
+	// ISO base media file, the brand tells AVIF images from videos. HEIC images can't be decoded, they aren't pages.
+	if len(data) >= 12 && string(data[4:8]) == "ftyp" {
+		switch string(data[8:12]) {
+		case "avif", "avis":
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package cbz
+
+import (
+	"testing"
+)
+
+func TestIsImage(t *testing.T) {
+	testCases := []struct {
+		name     string
+		data     string
+		expected bool
+	}{
+		{name: "JPEG", data: "\xFF\xD8\xFF\xE0\x00\x10JFIF", expected: true},
+		{name: "PNG", data: "\x89PNG\r\n\x1a\n\x00\x00\x00\x0DIHDR", expected: true},
+		{name: "GIF", data: "GIF89a\x01\x00\x01\x00", expected: true},
+		{name: "WebP", data: "RIFF\x24\x00\x00\x00WEBPVP8 ", expected: true},
+		{name: "AVIF", data: "\x00\x00\x00\x1CftypavifXXXX", expected: true},
+		{name: "HEIC", data: "\x00\x00\x00\x18ftypheic\x00\x00\x00\x00", expected: false},
+		{name: "JPEG XL", data: "\xFF\x0A\xFA\x7F", expected: true},
+		{name: "BMP", data: "BM\x36\x00\x0C\x00\x00\x00\x00\x00\x36\x00\x00\x00", expected: true},
+		{name: "TIFF", data: "II*\x00\x08\x00\x00\x00", expected: true},
+		{name: "Text starting like a BMP", data: "BMW owners club release", expected: false},
+		{name: "WAV", data: "RIFF\x24\x00\x00\x00WAVEfmt ", expected: false},
+		{name: "MP4", data: "\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00", expected: false},
+		{name: "NFO", data: "Release notes", expected: false},
+		{name: "Thumbs.db", data: "\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1", expected: false},
+		{name: "Empty", data: "", expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := isImage([]byte(tc.data)); actual != tc.expected {
+				t.Errorf("Expected isImage to be %t, but got %t", tc.expected, actual)
+			}
+		})
+	}
+}
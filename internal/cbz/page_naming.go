@@ -0,0 +1,110 @@
+package cbz
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+)
+
+// PageNaming tells how WriteChapterToCBZ names the pages: NamingOriginal, NamingSequential or a template.
+//
+// A template is made of text and placeholders: {chapter} is the name of the chapter file without its extension,
+// {name} the original name of the page without its folders and extension, and {index} the index of the page,
+// zero padded to a width with {index:03}. It must contain {index} or {name}, e.g. "{chapter}-{index:03}".
+type PageNaming string
+
+const (
+	// NamingOriginal keeps the path of the page in the original archive, with the extension of its new format.
+	NamingOriginal PageNaming = "original"
+	// NamingSequential names the pages after their index, 0000, 0001 and so on.
+	NamingSequential PageNaming = "sequential"
+)
+
+var placeholderRegex = regexp.MustCompile(`\{([a-z]+)(?::(\d+))?\}`)
+
+// Validate checks that the naming is a policy or a template with known placeholders only.
+func (n PageNaming) Validate() error {
+	if n == "" || n == NamingOriginal || n == NamingSequential {
+		return nil
+	}
+	unique := false
+	for _, match := range placeholderRegex.FindAllStringSubmatch(string(n), -1) {
+		switch match[1] {
+		case "index":
+			unique = true
+		case "name":
+			unique = true
+			if match[2] != "" {
+				return fmt.Errorf("invalid page naming \"%s\", only {index} takes a width", n)
+			}
+		case "chapter":
+			if match[2] != "" {
+				return fmt.Errorf("invalid page naming \"%s\", only {index} takes a width", n)
+			}
+		default:
+			return fmt.Errorf("invalid page naming \"%s\", unknown placeholder {%s}, available ones are {chapter}, {name} and {index}", n, match[1])
+		}
+	}
+	if !unique {
+		return fmt.Errorf("invalid page naming \"%s\", it must be %s, %s or a template with {index} or {name}", n, NamingOriginal, NamingSequential)
+	}
+	if strings.ContainsAny(placeholderRegex.ReplaceAllString(string(n), ""), "{}/\\") {
+		return fmt.Errorf("invalid page naming \"%s\", a template can't contain folders or unmatched braces", n)
+	}
+	return nil
+}
+
+// pageStem returns the name of the page in the archive, without the split part suffix and the extension.
+func (n PageNaming) pageStem(chapter *manga.Chapter, page *manga.Page) string {
+	sequential := fmt.Sprintf("%04d", page.Index)
+	original := strings.TrimSuffix(page.Path, path.Ext(page.Path))
+	switch n {
+	case "", NamingSequential:
+		return sequential
+	case NamingOriginal:
+		// Pages that weren't loaded from an archive have no original name
+		if original == "" {
+			return sequential
+		}
+		return original
+	}
+
+	chapterName := filepath.Base(chapter.FilePath)
+	chapterName = strings.TrimSuffix(chapterName, filepath.Ext(chapterName))
+	return placeholderRegex.ReplaceAllStringFunc(string(n), func(placeholder string) string {
+		match := placeholderRegex.FindStringSubmatch(placeholder)
+		switch match[1] {
+		case "chapter":
+			return chapterName
+		case "name":
+			if original == "" {
+				return sequential
+			}
+			return path.Base(original)
+		default:
+			width, _ := strconv.Atoi(match[2])
+			return fmt.Sprintf("%0*d", width, page.Index)
+		}
+	})
+}
+
+// pageFileName returns the name of the page in the archive following the naming, with the split part suffix of
+// the split pages and the extension of the page. A name already used, compared case-insensitively, gets a number.
+func (n PageNaming) pageFileName(chapter *manga.Chapter, page *manga.Page, used map[string]bool) string {
+	stem := n.pageStem(chapter, page)
+	if page.IsSplitted {
+		stem = fmt.Sprintf("%s-%02d", stem, page.SplitPartIndex)
+	}
+
+	fileName := stem + page.Extension
+	for i := 2; used[strings.ToLower(fileName)]; i++ {
+		fileName = fmt.Sprintf("%s_%d%s", stem, i, page.Extension)
+	}
+	used[strings.ToLower(fileName)] = true
+	return fileName
+}
@@ -0,0 +1,37 @@
+package cbz
+
+import (
+	"testing"
+)
+
+func TestPageNaming_Validate(t *testing.T) {
+	testCases := []struct {
+		naming      PageNaming
+		expectError bool
+	}{
+		{naming: ""},
+		{naming: NamingOriginal},
+		{naming: NamingSequential},
+		{naming: "{chapter}-{index:03}"},
+		{naming: "{index}"},
+		{naming: "{name}"},
+		{naming: "page", expectError: true},
+		{naming: "{chapter}", expectError: true},
+		{naming: "{chapter}-{page}", expectError: true},
+		{naming: "{name:03}", expectError: true},
+		{naming: "{index:03", expectError: true},
+		{naming: "pages/{index}", expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.naming), func(t *testing.T) {
+			err := tc.naming.Validate()
+			if tc.expectError && err == nil {
+				t.Errorf("Expected an error")
+			}
+			if !tc.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
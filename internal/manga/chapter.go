@@ -7,6 +7,8 @@ type Chapter struct {
 	FilePath string
 	// Pages is a slice of pointers to Page objects.
 	Pages []*Page
+	// OtherFiles are the files of the archive that aren't pages, written back as they are.
+	OtherFiles []*File
 	// ComicInfo is a string containing information about the chapter.
 	ComicInfoXml string
 	// IsConverted is a boolean that indicates whether the chapter has been converted.
@@ -20,3 +22,9 @@ func (chapter *Chapter) SetConverted() {
 	chapter.IsConverted = true
 	chapter.ConvertedTime = time.Now()
 }
+
+// File is a file of the archive kept as it is, under its path in the archive.
+type File struct {
+	Path     string
+	Contents []byte
+}
@@ -0,0 +1,110 @@
+package manga
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const emptyComicInfo = `<?xml version="1.0" encoding="utf-8"?>
+<ComicInfo xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+</ComicInfo>`
+
+var (
+	doublePageAttribute = regexp.MustCompile(`\sDoublePage="[^"]*"`)
+	emptyPagesElement   = regexp.MustCompile(`<Pages\s*/>`)
+	pagesElement        = regexp.MustCompile(`(?s)<Pages>.*?</Pages>`)
+	pageElement         = regexp.MustCompile(`(?s)<Page\s[^>]*?(?:/>|>.*?</Page>)`)
+	imageAttribute      = regexp.MustCompile(`\bImage="(\d+)"`)
+)
+
+// RenumberPages rebuilds the pages of the ComicInfo from the final order of the pages of the chapter, once they
+// were split or stitched: each page takes the entry of the original page it was cut from, with its new position as
+// Image. The parts after the first of a page have no entry, nor do they inherit its DoublePage, and the entries of
+// the pages that are gone are dropped.
+func (chapter *Chapter) RenumberPages() {
+	location := pagesElement.FindStringIndex(chapter.ComicInfoXml)
+	if location == nil {
+		return
+	}
+	pagesXml := chapter.ComicInfoXml[location[0]:location[1]]
+
+	entries := make(map[int]string)
+	for _, element := range pageElement.FindAllString(pagesXml, -1) {
+		match := imageAttribute.FindStringSubmatch(element)
+		if match == nil {
+			continue
+		}
+		image, err := strconv.Atoi(match[1])
+		if err != nil {
+			continue
+		}
+		entries[image] = element
+	}
+
+	var elements []string
+	for i, page := range chapter.Pages {
+		if page.IsSplitted && page.SplitPartIndex > 0 {
+			continue
+		}
+		element, ok := entries[int(page.Index)]
+		if !ok {
+			continue
+		}
+		element = imageAttribute.ReplaceAllString(element, fmt.Sprintf(`Image="%d"`, i))
+		if page.IsSplitted {
+			element = doublePageAttribute.ReplaceAllString(element, "")
+		}
+		elements = append(elements, "    "+element)
+	}
+
+	pages := "<Pages />"
+	if len(elements) > 0 {
+		pages = "<Pages>\n" + strings.Join(elements, "\n") + "\n  </Pages>"
+	}
+	chapter.ComicInfoXml = chapter.ComicInfoXml[:location[0]] + pages + chapter.ComicInfoXml[location[1]:]
+}
+
+// SetDoublePages sets DoublePage="true" on the pages at the given positions in the archive, the Image attribute of
+// the ComicInfo pages, which must follow the final order of the pages, see RenumberPages. The ComicInfo is edited
+// in place to keep the fields this module doesn't know about, a minimal one is created when the chapter has none.
+func (chapter *Chapter) SetDoublePages(images []int) {
+	comicInfo := chapter.ComicInfoXml
+	if strings.TrimSpace(comicInfo) == "" {
+		comicInfo = emptyComicInfo
+	}
+
+	var missing []string
+	for _, image := range images {
+		pageElement := regexp.MustCompile(fmt.Sprintf(`<Page\s[^>]*\bImage="%d"[^>]*>`, image))
+		location := pageElement.FindStringIndex(comicInfo)
+		if location == nil {
+			missing = append(missing, fmt.Sprintf(`    <Page Image="%d" DoublePage="true" />`, image))
+			continue
+		}
+
+		element := comicInfo[location[0]:location[1]]
+		if doublePageAttribute.MatchString(element) {
+			element = doublePageAttribute.ReplaceAllString(element, ` DoublePage="true"`)
+		} else {
+			element = strings.Replace(element, "<Page", `<Page DoublePage="true"`, 1)
+		}
+		comicInfo = comicInfo[:location[0]] + element + comicInfo[location[1]:]
+	}
+
+	if len(missing) > 0 {
+		pages := strings.Join(missing, "\n") + "\n"
+		switch {
+		case strings.Contains(comicInfo, "</Pages>"):
+			comicInfo = strings.Replace(comicInfo, "</Pages>", pages+"  </Pages>", 1)
+		case emptyPagesElement.MatchString(comicInfo):
+			location := emptyPagesElement.FindStringIndex(comicInfo)
+			comicInfo = comicInfo[:location[0]] + "<Pages>\n" + pages + "  </Pages>" + comicInfo[location[1]:]
+		default:
+			comicInfo = strings.Replace(comicInfo, "</ComicInfo>", "  <Pages>\n"+pages+"  </Pages>\n</ComicInfo>", 1)
+		}
+	}
+
+	chapter.ComicInfoXml = comicInfo
+}
@@ -0,0 +1,134 @@
+package manga
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testComicInfo struct {
+	Series string `xml:"Series"`
+	Pages  []struct {
+		Image      int    `xml:"Image,attr"`
+		Type       string `xml:"Type,attr"`
+		DoublePage string `xml:"DoublePage,attr"`
+	} `xml:"Pages>Page"`
+}
+
+func parseComicInfo(t *testing.T, comicInfo string) map[int]string {
+	var info testComicInfo
+	require.NoError(t, xml.Unmarshal([]byte(comicInfo), &info))
+	doublePages := make(map[int]string)
+	for _, page := range info.Pages {
+		doublePages[page.Image] = page.DoublePage
+	}
+	return doublePages
+}
+
+func TestChapter_SetDoublePages(t *testing.T) {
+	tests := []struct {
+		name      string
+		comicInfo string
+	}{
+		{
+			name: "No ComicInfo",
+		},
+		{
+			name:      "ComicInfo without pages",
+			comicInfo: `<?xml version="1.0"?><ComicInfo><Series>Test</Series></ComicInfo>`,
+		},
+		{
+			name:      "Empty pages element",
+			comicInfo: `<?xml version="1.0"?><ComicInfo><Series>Test</Series><Pages /></ComicInfo>`,
+		},
+		{
+			name: "Existing pages",
+			comicInfo: `<?xml version="1.0"?>
+<ComicInfo>
+  <Series>Test</Series>
+  <Pages>
+    <Page Image="0" Type="FrontCover" />
+    <Page Image="2" DoublePage="false" />
+    <Page Image="20" />
+  </Pages>
+</ComicInfo>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chapter := &Chapter{ComicInfoXml: tt.comicInfo}
+			chapter.SetDoublePages([]int{0, 2, 5})
+
+			doublePages := parseComicInfo(t, chapter.ComicInfoXml)
+			assert.Equal(t, "true", doublePages[0])
+			assert.Equal(t, "true", doublePages[2])
+			assert.Equal(t, "true", doublePages[5])
+			if _, ok := doublePages[20]; ok {
+				assert.Empty(t, doublePages[20], "other pages are left alone")
+			}
+		})
+	}
+}
+
+func TestChapter_SetDoublePages_KeepsOtherFields(t *testing.T) {
+	chapter := &Chapter{ComicInfoXml: `<?xml version="1.0"?><ComicInfo><Series>Test</Series><Pages><Page Image="0" Type="FrontCover" /></Pages></ComicInfo>`}
+	chapter.SetDoublePages([]int{0})
+
+	var info testComicInfo
+	require.NoError(t, xml.Unmarshal([]byte(chapter.ComicInfoXml), &info))
+	assert.Equal(t, "Test", info.Series)
+	require.Len(t, info.Pages, 1)
+	assert.Equal(t, "FrontCover", info.Pages[0].Type)
+	assert.Equal(t, "true", info.Pages[0].DoublePage)
+}
+
+func TestChapter_RenumberPages(t *testing.T) {
+	chapter := &Chapter{
+		ComicInfoXml: `<?xml version="1.0"?>
+<ComicInfo>
+  <Series>Test</Series>
+  <Pages>
+    <Page Image="0" Type="FrontCover" />
+    <Page Image="1" DoublePage="true" ImageWidth="300" />
+    <Page Image="2" Type="Story"></Page>
+    <Page Image="3" Type="Deleted" />
+  </Pages>
+</ComicInfo>`,
+		// Page 0 split in two, the spread 1 split in two, page 3 gone
+		Pages: []*Page{
+			{Index: 0, IsSplitted: true, SplitPartIndex: 0},
+			{Index: 0, IsSplitted: true, SplitPartIndex: 1},
+			{Index: 1, IsSplitted: true, SplitPartIndex: 0},
+			{Index: 1, IsSplitted: true, SplitPartIndex: 1},
+			{Index: 2},
+		},
+	}
+	chapter.RenumberPages()
+
+	var info struct {
+		Series string `xml:"Series"`
+		Pages  []struct {
+			Image      int    `xml:"Image,attr"`
+			Type       string `xml:"Type,attr"`
+			DoublePage string `xml:"DoublePage,attr"`
+			ImageWidth string `xml:"ImageWidth,attr"`
+		} `xml:"Pages>Page"`
+	}
+	require.NoError(t, xml.Unmarshal([]byte(chapter.ComicInfoXml), &info))
+	assert.Equal(t, "Test", info.Series)
+	require.Len(t, info.Pages, 3)
+	assert.Equal(t, 0, info.Pages[0].Image)
+	assert.Equal(t, "FrontCover", info.Pages[0].Type)
+	assert.Equal(t, 2, info.Pages[1].Image, "the first part of the spread takes its entry")
+	assert.Empty(t, info.Pages[1].DoublePage, "the halves of a spread aren't double pages")
+	assert.Equal(t, "300", info.Pages[1].ImageWidth)
+	assert.Equal(t, 4, info.Pages[2].Image)
+	assert.Equal(t, "Story", info.Pages[2].Type)
+
+	withoutPages := &Chapter{ComicInfoXml: `<ComicInfo><Series>Test</Series></ComicInfo>`, Pages: chapter.Pages}
+	withoutPages.RenumberPages()
+	assert.Equal(t, `<ComicInfo><Series>Test</Series></ComicInfo>`, withoutPages.ComicInfoXml)
+}
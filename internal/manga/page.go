@@ -7,6 +7,8 @@ type Page struct {
 	Index uint16 `json:"index" jsonschema:"description=Index of the page in the chapter."`
 	// Extension of the page image.
 	Extension string `json:"extension" jsonschema:"description=Extension of the page image."`
+	// Path of the page in the original archive, empty when it wasn't loaded from one.
+	Path string `json:"path" jsonschema:"description=Path of the page in the original archive."`
 	// Size of the page in bytes
 	Size uint64 `json:"-"`
 	// Contents of the page
@@ -15,4 +17,8 @@ type Page struct {
 	IsSplitted bool `json:"is_cropped" jsonschema:"description=Was this page cropped."`
 	// SplitPartIndex represent the index of the crop if the page was cropped
 	SplitPartIndex uint16 `json:"crop_part_index" jsonschema:"description=Index of the crop if the image was cropped."`
+	// IsModified tell us if the image was transformed (e.g. rotated), so the original contents can't replace it
+	IsModified bool `json:"is_modified" jsonschema:"description=Was the image of this page transformed."`
+	// IsDoublePage tell us if the page is a double page spread, to be marked as such in the ComicInfo
+	IsDoublePage bool `json:"is_double_page" jsonschema:"description=Is this page a double page spread."`
 }
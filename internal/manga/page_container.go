@@ -17,6 +17,18 @@ type PageContainer struct {
 	IsToBeConverted bool
 	// HasBeenConverted is a boolean flag indicating whether the image has been converted to another format.
 	HasBeenConverted bool
+	// Animation holds the frames of an animated page to encode as an animation, Image is nil then.
+	Animation *Animation
+}
+
+// Animation is a decoded animated image.
+type Animation struct {
+	// Frames are the full size images of the animation, in display order.
+	Frames []image.Image
+	// Delays are how long each frame is shown, in milliseconds.
+	Delays []int
+	// LoopCount is the number of times the animation is played, 0 meaning forever.
+	LoopCount int
 }
 
 func NewContainer(Page *Page, img image.Image, format string, isToBeConverted bool) *PageContainer {
@@ -0,0 +1,61 @@
+package fsutil
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/utils/errs"
+)
+
+// CopyOptions tells how CopyFile copies a file.
+type CopyOptions struct {
+	// KeepModTime gives the copy the modification time of the source, instead of the time it was written.
+	KeepModTime bool
+}
+
+// CopyFile copies src to dst with the permissions of src, creating the folders of dst when needed. The copy is
+// written to a temporary file next to dst, synced and renamed over dst, so that dst is never left half written.
+func CopyFile(src string, dst string, options CopyOptions) (err error) {
+	source, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer errs.Capture(&err, source.Close, "failed to close source file")
+	info, err := source.Stat()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = temp.Close()
+			_ = os.Remove(temp.Name())
+		}
+	}()
+	if _, err = io.Copy(temp, source); err != nil {
+		return err
+	}
+	if err = temp.Sync(); err != nil {
+		return err
+	}
+	if err = temp.Chmod(info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err = temp.Close(); err != nil {
+		return err
+	}
+	if options.KeepModTime {
+		if err = os.Chtimes(temp.Name(), info.ModTime(), info.ModTime()); err != nil {
+			return err
+		}
+	}
+	return os.Rename(temp.Name(), dst)
+}
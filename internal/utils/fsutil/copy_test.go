@@ -0,0 +1,75 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCopyFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "source.cbz")
+	if err := os.WriteFile(src, []byte("chapter"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	modified := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(src, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		options     CopyOptions
+		keepModTime bool
+	}{
+		{name: "Default", options: CopyOptions{}},
+		{name: "Keep modification time", options: CopyOptions{KeepModTime: true}, keepModTime: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := filepath.Join(t.TempDir(), "nested", "copy.cbz")
+			// An existing file is replaced
+			if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(dst, []byte("previous contents"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := CopyFile(src, dst, tt.options); err != nil {
+				t.Fatalf("CopyFile() error = %v", err)
+			}
+
+			contents, err := os.ReadFile(dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(contents) != "chapter" {
+				t.Errorf("CopyFile() contents = %q, want %q", contents, "chapter")
+			}
+			info, err := os.Stat(dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != 0600 {
+				t.Errorf("CopyFile() mode = %v, want %v", info.Mode().Perm(), os.FileMode(0600))
+			}
+			if got := info.ModTime().Equal(modified); got != tt.keepModTime {
+				t.Errorf("CopyFile() kept modification time = %v, want %v", got, tt.keepModTime)
+			}
+			entries, err := os.ReadDir(filepath.Dir(dst))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 {
+				t.Errorf("CopyFile() left %d files, want 1", len(entries))
+			}
+		})
+	}
+
+	if err := CopyFile(filepath.Join(dir, "missing.cbz"), filepath.Join(dir, "copy.cbz"), CopyOptions{}); err == nil {
+		t.Error("CopyFile() of a missing file should fail")
+	}
+}
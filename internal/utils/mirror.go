@@ -0,0 +1,191 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/utils/fsutil"
+	"github.com/rs/zerolog/log"
+)
+
+// SidecarMode tells how the files next to the chapters, like cover.jpg or series.json, get into the output directory.
+type SidecarMode string
+
+const (
+	// SidecarCopy copies them.
+	SidecarCopy SidecarMode = "copy"
+	// SidecarLink hard links them, copying them when the output directory is on another file system.
+	SidecarLink SidecarMode = "link"
+	// SidecarSkip leaves them out.
+	SidecarSkip SidecarMode = "skip"
+)
+
+// SidecarModes lists the supported modes.
+var SidecarModes = []SidecarMode{SidecarCopy, SidecarLink, SidecarSkip}
+
+// Mirror reproduces the tree of a root folder in an output directory: the converted chapters are written under
+// their path relative to the root, so that the root itself is never written to.
+type Mirror struct {
+	root      string
+	outputDir string
+	sidecars  SidecarMode
+}
+
+// NewMirror returns the mirror of root into outputDir, creating outputDir when needed. An empty sidecar mode means
+// SidecarCopy.
+func NewMirror(root string, outputDir string, sidecars SidecarMode) (*Mirror, error) {
+	if sidecars == "" {
+		sidecars = SidecarCopy
+	}
+	if !slices.Contains(SidecarModes, sidecars) {
+		names := make([]string, len(SidecarModes))
+		for i, mode := range SidecarModes {
+			names[i] = string(mode)
+		}
+		return nil, fmt.Errorf("invalid sidecar mode \"%s\", available options are %s", sidecars, strings.Join(names, ", "))
+	}
+	if outputDir == "" {
+		return nil, fmt.Errorf("output directory is required")
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("invalid root folder: %w", err)
+	}
+	absOutputDir, err := filepath.Abs(outputDir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output directory: %w", err)
+	}
+	if absRoot == absOutputDir {
+		return nil, fmt.Errorf("the output directory can't be the folder being converted")
+	}
+	if err := os.MkdirAll(absOutputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	return &Mirror{root: absRoot, outputDir: absOutputDir, sidecars: sidecars}, nil
+}
+
+// OutputDir returns the absolute path of the output directory.
+func (m *Mirror) OutputDir() string {
+	return m.outputDir
+}
+
+// Contains tells whether the path is in the output directory, whose files must not be converted again.
+func (m *Mirror) Contains(path string) bool {
+	return isWithin(m.outputDir, path)
+}
+
+// Path returns where the file at the given path, under the root, is mirrored.
+func (m *Mirror) Path(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if !isWithin(m.root, absPath) {
+		return "", fmt.Errorf("%s isn't in %s", path, m.root)
+	}
+	relative, err := filepath.Rel(m.root, absPath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(m.outputDir, relative), nil
+}
+
+// ChapterPath returns where the chapter at the given path is written once converted, a CBR becoming a CBZ.
+func (m *Mirror) ChapterPath(path string) (string, error) {
+	mirrored, err := m.Path(path)
+	if err != nil {
+		return "", err
+	}
+	if strings.EqualFold(filepath.Ext(mirrored), ".cbr") {
+		mirrored = strings.TrimSuffix(mirrored, filepath.Ext(mirrored)) + ".cbz"
+	}
+	return mirrored, nil
+}
+
+// CopySidecar puts the file at the given path, which isn't a chapter, in the output directory following the sidecar
+// mode. A mirrored file of the same size, not older than the original, is up to date and left alone. Folders are
+// created along with the files they hold, they are left alone too.
+func (m *Mirror) CopySidecar(path string) error {
+	if m.sidecars == SidecarSkip {
+		return nil
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return nil
+	}
+	mirrored, err := m.Path(path)
+	if err != nil {
+		return err
+	}
+	if upToDate(path, mirrored) {
+		log.Debug().Str("file", path).Str("output", mirrored).Msg("Mirrored file up to date")
+		return nil
+	}
+	if err := m.place(path, mirrored); err != nil {
+		return fmt.Errorf("failed to mirror %s: %w", path, err)
+	}
+	log.Info().Str("file", path).Str("output", mirrored).Str("mode", string(m.sidecars)).Msg("File mirrored")
+	return nil
+}
+
+// copyChapter puts the chapter at the given path in the output directory as it is, linked or copied like the
+// sidecars, for the chapters that aren't rewritten so that the mirror still holds them.
+func (m *Mirror) copyChapter(path string) error {
+	mirrored, err := m.Path(path)
+	if err != nil {
+		return err
+	}
+	if upToDate(path, mirrored) {
+		return nil
+	}
+	if err := m.place(path, mirrored); err != nil {
+		return fmt.Errorf("failed to mirror %s: %w", path, err)
+	}
+	log.Info().Str("file", path).Str("output", mirrored).Msg("Chapter mirrored as is")
+	return nil
+}
+
+// place links or copies src to dst, replacing dst.
+func (m *Mirror) place(src string, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if m.sidecars == SidecarLink {
+		if err := os.Remove(dst); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		err := os.Link(src, dst)
+		if err == nil {
+			return nil
+		}
+		log.Debug().Str("file", src).Err(err).Msg("Failed to hard link the file, copying it")
+	}
+	return fsutil.CopyFile(src, dst, fsutil.CopyOptions{KeepModTime: true})
+}
+
+// upToDate tells whether dst has the size of src and isn't older.
+func upToDate(src string, dst string) bool {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return false
+	}
+	dstInfo, err := os.Stat(dst)
+	if err != nil {
+		return false
+	}
+	return srcInfo.Size() == dstInfo.Size() && !dstInfo.ModTime().Before(srcInfo.ModTime())
+}
+
+// isWithin tells whether path is dir or is under it.
+func isWithin(dir string, path string) bool {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	relative, err := filepath.Rel(dir, absPath)
+	return err == nil && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator))
+}
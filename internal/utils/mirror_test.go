@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/cbz"
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMirror(t *testing.T) {
+	root := t.TempDir()
+
+	_, err := NewMirror(root, filepath.Join(t.TempDir(), "out"), "hardlink")
+	assert.ErrorContains(t, err, "invalid sidecar mode")
+	_, err = NewMirror(root, "", SidecarCopy)
+	assert.Error(t, err)
+	_, err = NewMirror(root, root, SidecarCopy)
+	assert.ErrorContains(t, err, "can't be the folder being converted")
+
+	outputDir := filepath.Join(t.TempDir(), "out", "nested")
+	mirror, err := NewMirror(root, outputDir, "")
+	require.NoError(t, err)
+	assert.DirExists(t, outputDir)
+	assert.Equal(t, SidecarCopy, mirror.sidecars)
+}
+
+func TestMirror_Paths(t *testing.T) {
+	root := t.TempDir()
+	outputDir := filepath.Join(root, "optimized")
+	mirror, err := NewMirror(root, outputDir, SidecarCopy)
+	require.NoError(t, err)
+
+	mirrored, err := mirror.Path(filepath.Join(root, "Series", "cover.jpg"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(outputDir, "Series", "cover.jpg"), mirrored)
+
+	mirrored, err = mirror.ChapterPath(filepath.Join(root, "Series", "Chapter 1.CBR"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(outputDir, "Series", "Chapter 1.cbz"), mirrored, "a CBR becomes a CBZ")
+	mirrored, err = mirror.ChapterPath(filepath.Join(root, "Series", "Chapter 2.cbz"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(outputDir, "Series", "Chapter 2.cbz"), mirrored, "the name is kept")
+
+	_, err = mirror.Path(filepath.Join(t.TempDir(), "Chapter 1.cbz"))
+	assert.Error(t, err, "files outside of the root can't be mirrored")
+
+	assert.True(t, mirror.Contains(filepath.Join(outputDir, "Series", "Chapter 1.cbz")))
+	assert.False(t, mirror.Contains(filepath.Join(root, "Series", "Chapter 1.cbz")))
+}
+
+func TestMirror_CopySidecar(t *testing.T) {
+	for _, mode := range SidecarModes {
+		t.Run(string(mode), func(t *testing.T) {
+			root := t.TempDir()
+			outputDir := t.TempDir()
+			mirror, err := NewMirror(root, outputDir, mode)
+			require.NoError(t, err)
+
+			sidecar := filepath.Join(root, "Series", "series.json")
+			require.NoError(t, os.MkdirAll(filepath.Dir(sidecar), 0755))
+			require.NoError(t, os.WriteFile(sidecar, []byte(`{"name":"Boundless Necromancer"}`), 0644))
+			require.NoError(t, mirror.CopySidecar(sidecar))
+			require.NoError(t, mirror.CopySidecar(filepath.Dir(sidecar)), "folders are left alone")
+
+			mirrored := filepath.Join(outputDir, "Series", "series.json")
+			if mode == SidecarSkip {
+				assert.NoFileExists(t, mirrored)
+				return
+			}
+			contents, err := os.ReadFile(mirrored)
+			require.NoError(t, err)
+			assert.Equal(t, `{"name":"Boundless Necromancer"}`, string(contents))
+			assert.True(t, upToDate(sidecar, mirrored))
+
+			// An updated sidecar is mirrored again
+			require.NoError(t, os.WriteFile(sidecar, []byte(`{"name":"Boundless Necromancer","volume":2}`), 0644))
+			require.NoError(t, mirror.CopySidecar(sidecar))
+			contents, err = os.ReadFile(mirrored)
+			require.NoError(t, err)
+			assert.Equal(t, `{"name":"Boundless Necromancer","volume":2}`, string(contents))
+		})
+	}
+}
+
+func TestOptimize_Mirror(t *testing.T) {
+	root := t.TempDir()
+	outputDir := filepath.Join(t.TempDir(), "optimized")
+	mirror, err := NewMirror(root, outputDir, SidecarCopy)
+	require.NoError(t, err)
+
+	path := filepath.Join(root, "Series", "Chapter 1.cbz")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	chapter := &manga.Chapter{FilePath: path, Pages: []*manga.Page{newSizedPage(0, 1000), newSizedPage(1, 1000)}}
+	require.NoError(t, cbz.WriteChapterToCBZ(chapter, path, nil))
+	original, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	err = Optimize(&OptimizeOptions{
+		ChapterConverter: &resizingConverter{sizes: []int{500, 500}},
+		Path:             path,
+		ConvertOptions:   converter.ConvertOptions{Quality: 80},
+		Override:         true,
+		Mirror:           mirror,
+	})
+	require.NoError(t, err)
+
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, original, contents, "the original is never written to, even with override")
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "nothing is written next to the original")
+
+	mirrored := filepath.Join(outputDir, "Series", "Chapter 1.cbz")
+	written, err := cbz.LoadChapter(mirrored, nil)
+	require.NoError(t, err)
+	assert.True(t, written.IsConverted)
+	assert.Len(t, written.Pages, 2)
+
+	// A chapter that isn't rewritten is mirrored as it is
+	skipped := filepath.Join(root, "Series", "Chapter 2.cbz")
+	require.NoError(t, os.WriteFile(skipped, original, 0644))
+	err = Optimize(&OptimizeOptions{
+		ChapterConverter:  &resizingConverter{sizes: []int{900, 950}},
+		Path:              skipped,
+		ConvertOptions:    converter.ConvertOptions{Quality: 80},
+		MinChapterSavings: 0.2,
+		Mirror:            mirror,
+	})
+	require.NoError(t, err)
+	contents, err = os.ReadFile(filepath.Join(outputDir, "Series", "Chapter 2.cbz"))
+	require.NoError(t, err)
+	assert.Equal(t, original, contents)
+}
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/backup"
 	"github.com/danielkitchener/CBZOptimizer/v2/internal/cbz"
 	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter"
 	errors2 "github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/errors"
@@ -18,11 +19,25 @@ import (
 type OptimizeOptions struct {
 	ChapterConverter converter.Converter
 	Path             string
-	Quality          uint8
-	Lossless				 bool
-	Override         bool
-	Split            bool
-	Timeout          time.Duration
+	// LoadOptions tells which files of the archive are loaded, nil for cbz.DefaultLoadOptions.
+	LoadOptions *cbz.LoadOptions
+	// PageNaming tells how the pages of the converted archive are named, empty for cbz.NamingSequential.
+	PageNaming cbz.PageNaming
+	// ConvertOptions are given to the converter as is.
+	ConvertOptions converter.ConvertOptions
+	Override       bool
+	Timeout        time.Duration
+	// MinPageSavings is the ratio (0 to 1) a converted page must be smaller than its original to be kept.
+	MinPageSavings float64
+	// MinChapterSavings is the ratio (0 to 1) the whole chapter must shrink to be written.
+	MinChapterSavings float64
+	// Backup keeps the originals replaced or deleted by the conversion, nil to not keep them.
+	Backup *backup.Store
+	// Mirror writes the converted chapter into its output directory instead of next to the original, nil to not
+	// mirror. Override is ignored then, the original is never written to.
+	Mirror *Mirror
+	// Stats counts the size guard decisions, optional.
+	Stats *SavingsStats
 }
 
 // Optimize optimizes a CBZ/CBR file using the specified converter.
@@ -30,14 +45,15 @@ func Optimize(options *OptimizeOptions) error {
 	log.Info().Str("file", options.Path).Msg("Processing file")
 	log.Debug().
 		Str("file", options.Path).
-		Uint8("quality", options.Quality).
+		Uint8("quality", options.ConvertOptions.Quality).
+		Bool("lossless", options.ConvertOptions.Lossless).
 		Bool("override", options.Override).
-		Bool("split", options.Split).
+		Bool("split", options.ConvertOptions.Split).
 		Msg("Optimization parameters")
 
 	// Load the chapter
 	log.Debug().Str("file", options.Path).Msg("Loading chapter")
-	chapter, err := cbz.LoadChapter(options.Path)
+	chapter, err := cbz.LoadChapter(options.Path, options.LoadOptions)
 	if err != nil {
 		log.Error().Str("file", options.Path).Err(err).Msg("Failed to load chapter")
 		return fmt.Errorf("failed to load chapter: %v", err)
@@ -50,6 +66,9 @@ func Optimize(options *OptimizeOptions) error {
 
 	if chapter.IsConverted {
 		log.Info().Str("file", options.Path).Msg("Chapter already converted")
+		if options.Mirror != nil {
+			return options.Mirror.copyChapter(options.Path)
+		}
 		return nil
 	}
 
@@ -57,8 +76,8 @@ func Optimize(options *OptimizeOptions) error {
 	log.Debug().
 		Str("file", chapter.FilePath).
 		Int("pages", len(chapter.Pages)).
-		Uint8("quality", options.Quality).
-		Bool("split", options.Split).
+		Uint8("quality", options.ConvertOptions.Quality).
+		Bool("split", options.ConvertOptions.Split).
 		Msg("Starting chapter conversion")
 
 	var ctx context.Context
@@ -71,7 +90,9 @@ func Optimize(options *OptimizeOptions) error {
 		ctx = context.Background()
 	}
 
-	convertedChapter, err := options.ChapterConverter.ConvertChapter(ctx, chapter, options.Quality, options.Lossless, options.Split, func(msg string, current uint32, total uint32) {
+	originals, originalSize := snapshotPages(chapter.Pages)
+
+	convertedChapter, err := options.ChapterConverter.ConvertChapter(ctx, chapter, &options.ConvertOptions, func(msg string, current uint32, total uint32) {
 		if current%10 == 0 || current == total {
 			log.Info().Str("file", chapter.FilePath).Uint32("current", current).Uint32("total", total).Msg("Converting")
 		} else {
@@ -98,6 +119,43 @@ func Optimize(options *OptimizeOptions) error {
 		Int("converted_pages", len(convertedChapter.Pages)).
 		Msg("Chapter conversion completed")
 
+	pagesKept := keepSmallerPages(convertedChapter, originals, options.MinPageSavings)
+	if pagesKept > 0 {
+		log.Info().
+			Str("file", chapter.FilePath).
+			Int("pages_kept", pagesKept).
+			Float64("min_page_savings", options.MinPageSavings).
+			Msg("Kept original pages that didn't get smaller")
+		if options.Stats != nil {
+			options.Stats.PagesKept.Add(uint64(pagesKept))
+		}
+	}
+
+	convertedSize := chapterSize(convertedChapter)
+	savings := savingsRatio(originalSize, convertedSize)
+	if savings < options.MinChapterSavings {
+		log.Info().
+			Str("file", chapter.FilePath).
+			Uint64("original_size", originalSize).
+			Uint64("converted_size", convertedSize).
+			Float64("savings", savings).
+			Float64("min_chapter_savings", options.MinChapterSavings).
+			Msg("Chapter savings below threshold, not rewriting it")
+		if options.Stats != nil {
+			options.Stats.ChaptersSkipped.Add(1)
+		}
+		if options.Mirror != nil {
+			return options.Mirror.copyChapter(options.Path)
+		}
+		return nil
+	}
+	log.Debug().
+		Str("file", chapter.FilePath).
+		Uint64("original_size", originalSize).
+		Uint64("converted_size", convertedSize).
+		Float64("savings", savings).
+		Msg("Chapter savings computed")
+
 	convertedChapter.SetConverted()
 
 	// Determine output path and handle CBR override logic
@@ -110,7 +168,20 @@ func Optimize(options *OptimizeOptions) error {
 	originalPath := options.Path
 	isCbrOverride := false
 
-	if options.Override {
+	if options.Mirror != nil {
+		outputPath, err = options.Mirror.ChapterPath(options.Path)
+		if err != nil {
+			log.Error().Str("file", options.Path).Err(err).Msg("Failed to locate the mirrored chapter")
+			return fmt.Errorf("failed to locate the mirrored chapter: %v", err)
+		}
+		if err = os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+			return fmt.Errorf("failed to create the mirrored folder: %v", err)
+		}
+		log.Debug().
+			Str("original_path", originalPath).
+			Str("output_path", outputPath).
+			Msg("Mirror mode: creating converted file in the output directory")
+	} else if options.Override {
 		// For override mode, check if it's a CBR file that needs to be converted to CBZ
 		pathLower := strings.ToLower(options.Path)
 		if strings.HasSuffix(pathLower, ".cbr") {
@@ -146,7 +217,21 @@ func Optimize(options *OptimizeOptions) error {
 
 	// Write the converted chapter to CBZ file
 	log.Debug().Str("output_path", outputPath).Msg("Writing converted chapter to CBZ file")
-	err = cbz.WriteChapterToCBZ(convertedChapter, outputPath)
+	// The written archive replaces the output, and the source CBR is deleted, only once it reads back as the
+	// converted chapter
+	err = cbz.WriteChapterToCBZ(convertedChapter, outputPath, &cbz.WriteOptions{
+		Naming: options.PageNaming,
+		Verify: func(path string) error {
+			return verifyChapter(path, convertedChapter)
+		},
+		BeforeReplace: func() error {
+			// The files of the output directory are no originals
+			if options.Mirror != nil {
+				return nil
+			}
+			return backupReplaced(options.Backup, outputPath, isCbrOverride, originalPath)
+		},
+	})
 	if err != nil {
 		log.Error().Str("output_path", outputPath).Err(err).Msg("Failed to write converted chapter")
 		return fmt.Errorf("failed to write converted chapter: %v", err)
@@ -169,3 +254,20 @@ func Optimize(options *OptimizeOptions) error {
 	return nil
 
 }
+
+// backupReplaced saves the files about to be lost into the backup: the output when it exists, and the source CBR
+// deleted once converted. Nothing is saved without a backup.
+func backupReplaced(store *backup.Store, outputPath string, isCbrOverride bool, originalPath string) error {
+	if store == nil {
+		return nil
+	}
+	if _, err := os.Stat(outputPath); err == nil {
+		if err := store.Save(outputPath); err != nil {
+			return err
+		}
+	}
+	if isCbrOverride {
+		return store.Save(originalPath)
+	}
+	return nil
+}
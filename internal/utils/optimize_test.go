@@ -9,9 +9,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/backup"
 	"github.com/danielkitchener/CBZOptimizer/v2/internal/cbz"
 	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
 	"github.com/danielkitchener/CBZOptimizer/v2/internal/utils/errs"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter"
 	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/constant"
 )
 
@@ -20,7 +22,7 @@ type MockConverter struct {
 	shouldFail bool
 }
 
-func (m *MockConverter) ConvertChapter(ctx context.Context, chapter *manga.Chapter, quality uint8, lossless bool, split bool, progress func(message string, current uint32, total uint32)) (*manga.Chapter, error) {
+func (m *MockConverter) ConvertChapter(ctx context.Context, chapter *manga.Chapter, opts *converter.ConvertOptions, progress func(message string, current uint32, total uint32)) (*manga.Chapter, error) {
 	if m.shouldFail {
 		return nil, &MockError{message: "mock conversion error"}
 	}
@@ -212,10 +214,8 @@ func TestOptimize(t *testing.T) {
 			options := &OptimizeOptions{
 				ChapterConverter: &MockConverter{shouldFail: tt.mockFail},
 				Path:             testFile,
-				Quality:          85,
-				Lossless: 			  false,
+				ConvertOptions:   converter.ConvertOptions{Quality: 85},
 				Override:         tt.override,
-				Split:            false,
 				Timeout:          0,
 			}
 
@@ -253,7 +253,7 @@ func TestOptimize(t *testing.T) {
 			}
 
 			// Verify output is a valid CBZ
-			chapter, err := cbz.LoadChapter(expectedOutput)
+			chapter, err := cbz.LoadChapter(expectedOutput, nil)
 			if err != nil {
 				t.Errorf("Failed to load converted chapter: %v", err)
 			}
@@ -327,9 +327,8 @@ func TestOptimize_AlreadyConverted(t *testing.T) {
 	options := &OptimizeOptions{
 		ChapterConverter: &MockConverter{},
 		Path:             convertedFile,
-		Quality:          85,
+		ConvertOptions:   converter.ConvertOptions{Quality: 85},
 		Override:         false,
-		Split:            false,
 		Timeout:          0,
 	}
 
@@ -349,9 +348,8 @@ func TestOptimize_InvalidFile(t *testing.T) {
 	options := &OptimizeOptions{
 		ChapterConverter: &MockConverter{},
 		Path:             "/nonexistent/file.cbz",
-		Quality:          85,
+		ConvertOptions:   converter.ConvertOptions{Quality: 85},
 		Override:         false,
-		Split:            false,
 		Timeout:          0,
 	}
 
@@ -407,9 +405,8 @@ func TestOptimize_Timeout(t *testing.T) {
 	options := &OptimizeOptions{
 		ChapterConverter: &MockConverter{},
 		Path:             cbzFile,
-		Quality:          85,
+		ConvertOptions:   converter.ConvertOptions{Quality: 85},
 		Override:         false,
-		Split:            false,
 		Timeout:          500 * time.Microsecond, // 500 microseconds - should timeout during page processing
 	}
 
@@ -423,3 +420,65 @@ func TestOptimize_Timeout(t *testing.T) {
 		t.Errorf("Expected timeout error message, got: %v", err)
 	}
 }
+
+func TestOptimize_Backup(t *testing.T) {
+	dir := t.TempDir()
+	store, err := backup.New(filepath.Join(t.TempDir(), "backups"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "chapter.cbz")
+	chapter := &manga.Chapter{FilePath: path, Pages: []*manga.Page{newSizedPage(0, 1000), newSizedPage(1, 1000)}}
+	if err := cbz.WriteChapterToCBZ(chapter, path, nil); err != nil {
+		t.Fatal(err)
+	}
+	original, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A failed conversion replaces nothing, so nothing is backed up
+	err = Optimize(&OptimizeOptions{
+		ChapterConverter: &corruptingConverter{},
+		Path:             path,
+		ConvertOptions:   converter.ConvertOptions{Quality: 80},
+		Override:         true,
+		Backup:           store,
+	})
+	if err == nil {
+		t.Fatal("Expected the verification to fail")
+	}
+	if _, err := store.Latest(path); !os.IsNotExist(err) {
+		t.Error("No backup should be made when the original isn't replaced")
+	}
+
+	err = Optimize(&OptimizeOptions{
+		ChapterConverter: &resizingConverter{sizes: []int{500, 500}},
+		Path:             path,
+		ConvertOptions:   converter.ConvertOptions{Quality: 80},
+		Override:         true,
+		Backup:           store,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	backupPath, err := store.Latest(path)
+	if err != nil {
+		t.Fatalf("Expected a backup of the original: %v", err)
+	}
+	backedUp, err := os.ReadFile(backupPath)
+	if err != nil {
+		t.Fatalf("Expected a backup of the original: %v", err)
+	}
+	if string(backedUp) != string(original) {
+		t.Error("The backup should hold the original archive")
+	}
+	converted, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(converted) == string(original) {
+		t.Error("The original should be replaced by the converted archive")
+	}
+}
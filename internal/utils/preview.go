@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/cbz"
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/utils/errs"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/pipeline"
+	"github.com/rs/zerolog/log"
+	_ "golang.org/x/image/webp"
+)
+
+// PreviewSamples is the number of pages of a chapter written by WritePreview.
+const PreviewSamples = 3
+
+// WritePreview writes before and after PNG samples of the image adjustments for a few pages spread over the chapter,
+// named after the chapter and the page. Returns the paths of the written files.
+func WritePreview(path string, dir string, adjust *options.Adjust) ([]string, error) {
+	chapter, err := cbz.LoadChapter(path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chapter: %v", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create preview directory: %w", err)
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	var written []string
+	for _, position := range previewPositions(len(chapter.Pages), PreviewSamples) {
+		page := chapter.Pages[position]
+		img, _, err := pipeline.DecodePage(page)
+		if err != nil {
+			log.Warn().Str("file", path).Uint16("page_index", page.Index).Err(err).Msg("Skipping undecodable page in preview")
+			continue
+		}
+
+		for suffix, sample := range map[string]image.Image{"before": img, "after": pipeline.AdjustImage(img, adjust)} {
+			samplePath := filepath.Join(dir, fmt.Sprintf("%s_page%03d_%s.png", name, page.Index, suffix))
+			if err := writePNG(samplePath, sample); err != nil {
+				return written, err
+			}
+			written = append(written, samplePath)
+		}
+	}
+
+	log.Info().Str("file", path).Str("preview_dir", dir).Int("samples", len(written)/2).Msg("Preview written")
+	return written, nil
+}
+
+// previewPositions spreads the samples over the pages, skipping the cover when there are enough pages.
+func previewPositions(pages int, samples int) []int {
+	if pages <= samples {
+		positions := make([]int, pages)
+		for i := range positions {
+			positions[i] = i
+		}
+		return positions
+	}
+	positions := make([]int, samples)
+	for i := range positions {
+		positions[i] = pages * (i + 1) / (samples + 1)
+	}
+	return positions
+}
+
+func writePNG(path string, img image.Image) (err error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create preview sample: %w", err)
+	}
+	defer errs.Capture(&err, file.Close, "failed to close preview sample")
+	if err := png.Encode(file, img); err != nil {
+		return fmt.Errorf("failed to encode preview sample %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/cbz"
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newPNGPage(t *testing.T, index uint16, level uint8) *manga.Page {
+	img := image.NewGray(image.Rect(0, 0, 20, 20))
+	for i := range img.Pix {
+		img.Pix[i] = level
+	}
+	// A line of faded ink
+	for x := 0; x < 20; x++ {
+		img.Pix[x] = 40
+	}
+	buf := new(bytes.Buffer)
+	require.NoError(t, png.Encode(buf, img))
+	return &manga.Page{Index: index, Contents: buf, Extension: ".png", Size: uint64(buf.Len())}
+}
+
+func TestWritePreview(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Chapter 1.cbz")
+	var pages []*manga.Page
+	for i := 0; i < 8; i++ {
+		pages = append(pages, newPNGPage(t, uint16(i), 200))
+	}
+	require.NoError(t, cbz.WriteChapterToCBZ(&manga.Chapter{FilePath: path, Pages: pages}, path, nil))
+
+	previewDir := filepath.Join(dir, "preview")
+	written, err := WritePreview(path, previewDir, &options.Adjust{AutoLevels: true})
+	require.NoError(t, err)
+	require.Len(t, written, 2*PreviewSamples)
+
+	before := decodePNG(t, filepath.Join(previewDir, "Chapter 1_page002_before.png"))
+	after := decodePNG(t, filepath.Join(previewDir, "Chapter 1_page002_after.png"))
+	assert.Equal(t, color.Gray{Y: 200}, color.GrayModel.Convert(before.At(10, 10)))
+	assert.Equal(t, color.Gray{Y: 255}, color.GrayModel.Convert(after.At(10, 10)), "the paper is whitened")
+}
+
+func TestPreviewPositions(t *testing.T) {
+	assert.Equal(t, []int{0, 1}, previewPositions(2, 3))
+	assert.Equal(t, []int{2, 5, 7}, previewPositions(10, 3))
+	assert.Empty(t, previewPositions(0, 3))
+}
+
+func decodePNG(t *testing.T, path string) image.Image {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	img, err := png.Decode(file)
+	require.NoError(t, err)
+	return img
+}
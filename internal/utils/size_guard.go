@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"bytes"
+	"sync/atomic"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+	"github.com/rs/zerolog/log"
+)
+
+// SavingsStats counts the decisions taken by the size guards, it can be shared between workers.
+type SavingsStats struct {
+	// PagesKept is the number of pages whose original was kept because the conversion didn't save enough.
+	PagesKept atomic.Uint64
+	// ChaptersSkipped is the number of chapters not rewritten because the conversion didn't save enough.
+	ChaptersSkipped atomic.Uint64
+}
+
+type originalPage struct {
+	contents  *bytes.Buffer
+	extension string
+	size      uint64
+}
+
+// snapshotPages remembers the contents of the pages before the converter replaces them.
+func snapshotPages(pages []*manga.Page) (map[uint16]originalPage, uint64) {
+	originals := make(map[uint16]originalPage, len(pages))
+	var total uint64
+	for _, page := range pages {
+		if page.Contents == nil {
+			continue
+		}
+		originals[page.Index] = originalPage{
+			contents:  page.Contents,
+			extension: page.Extension,
+			size:      uint64(page.Contents.Len()),
+		}
+		total += uint64(page.Contents.Len())
+	}
+	return originals, total
+}
+
+// keepSmallerPages restores the original of the pages that didn't get smaller by at least minSavings (0 to 1).
+// Split and modified pages are left alone as they can't be compared to the original.
+// Returns the number of restored pages.
+func keepSmallerPages(chapter *manga.Chapter, originals map[uint16]originalPage, minSavings float64) int {
+	restored := 0
+	for _, page := range chapter.Pages {
+		if page.IsSplitted || page.IsModified || page.Contents == nil {
+			continue
+		}
+		original, ok := originals[page.Index]
+		if !ok || original.contents == page.Contents {
+			continue
+		}
+
+		convertedSize := uint64(page.Contents.Len())
+		if float64(convertedSize) <= float64(original.size)*(1-minSavings) {
+			continue
+		}
+
+		log.Debug().
+			Str("chapter", chapter.FilePath).
+			Uint16("page_index", page.Index).
+			Uint64("original_size", original.size).
+			Uint64("converted_size", convertedSize).
+			Float64("min_savings", minSavings).
+			Msg("Converted page not small enough, keeping original")
+		page.Contents = original.contents
+		page.Extension = original.extension
+		page.Size = original.size
+		restored++
+	}
+	return restored
+}
+
+// chapterSize returns the total size of the pages of the chapter.
+func chapterSize(chapter *manga.Chapter) uint64 {
+	var total uint64
+	for _, page := range chapter.Pages {
+		if page.Contents != nil {
+			total += uint64(page.Contents.Len())
+		}
+	}
+	return total
+}
+
+// savingsRatio returns how much smaller converted is compared to original, negative when it grew.
+func savingsRatio(original, converted uint64) float64 {
+	if original == 0 {
+		return 0
+	}
+	return 1 - float64(converted)/float64(original)
+}
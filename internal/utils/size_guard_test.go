@@ -0,0 +1,186 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/cbz"
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/constant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// resizingConverter replaces each page by one of the given sizes, in page order.
+type resizingConverter struct {
+	sizes []int
+}
+
+func (r *resizingConverter) ConvertChapter(ctx context.Context, chapter *manga.Chapter, opts *converter.ConvertOptions, progress func(message string, current uint32, total uint32)) (*manga.Chapter, error) {
+	for i, page := range chapter.Pages {
+		container := manga.NewContainer(page, nil, "png", true)
+		container.SetConverted(bytes.NewBuffer(imageBytes(r.sizes[i])), ".webp")
+	}
+	return chapter, nil
+}
+
+func (r *resizingConverter) Format() constant.ConversionFormat {
+	return constant.WebP
+}
+
+func (r *resizingConverter) PrepareConverter() error {
+	return nil
+}
+
+// imageBytes returns a 1x1 PNG padded to the given size, which decoders ignore, to be loaded back as a page.
+func imageBytes(size int) []byte {
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		panic(err)
+	}
+	data := make([]byte, size)
+	copy(data, encoded.Bytes())
+	return data
+}
+
+func newSizedPage(index uint16, size int) *manga.Page {
+	return &manga.Page{Index: index, Contents: bytes.NewBuffer(imageBytes(size)), Extension: ".jpg", Size: uint64(size)}
+}
+
+func TestKeepSmallerPages(t *testing.T) {
+	tests := []struct {
+		name              string
+		convertedSizes    []int
+		minSavings        float64
+		expectedRestored  int
+		expectedExtension []string
+	}{
+		{
+			name:              "Smaller pages are kept",
+			convertedSizes:    []int{50, 99},
+			expectedRestored:  0,
+			expectedExtension: []string{".webp", ".webp"},
+		},
+		{
+			name:              "Larger page is restored",
+			convertedSizes:    []int{50, 120},
+			expectedRestored:  1,
+			expectedExtension: []string{".webp", ".jpg"},
+		},
+		{
+			name:              "Page not smaller by the ratio is restored",
+			convertedSizes:    []int{50, 95},
+			minSavings:        0.1,
+			expectedRestored:  1,
+			expectedExtension: []string{".webp", ".jpg"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chapter := &manga.Chapter{Pages: []*manga.Page{newSizedPage(0, 100), newSizedPage(1, 100)}}
+			originals, total := snapshotPages(chapter.Pages)
+			assert.Equal(t, uint64(200), total)
+
+			_, err := (&resizingConverter{sizes: tt.convertedSizes}).ConvertChapter(context.Background(), chapter, &converter.ConvertOptions{Quality: 80}, nil)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expectedRestored, keepSmallerPages(chapter, originals, tt.minSavings))
+			for i, page := range chapter.Pages {
+				assert.Equal(t, tt.expectedExtension[i], page.Extension)
+				assert.Equal(t, uint64(page.Contents.Len()), page.Size)
+			}
+		})
+	}
+}
+
+func TestKeepSmallerPages_IgnoresSplitPages(t *testing.T) {
+	originals, _ := snapshotPages([]*manga.Page{newSizedPage(0, 10)})
+	chapter := &manga.Chapter{Pages: []*manga.Page{
+		{Index: 0, IsSplitted: true, SplitPartIndex: 0, Contents: bytes.NewBuffer(make([]byte, 20)), Extension: ".webp"},
+		{Index: 0, IsSplitted: true, SplitPartIndex: 1, Contents: bytes.NewBuffer(make([]byte, 20)), Extension: ".webp"},
+	}}
+
+	assert.Equal(t, 0, keepSmallerPages(chapter, originals, 0))
+}
+
+func TestKeepSmallerPages_IgnoresModifiedPages(t *testing.T) {
+	originals, _ := snapshotPages([]*manga.Page{newSizedPage(0, 10)})
+	chapter := &manga.Chapter{Pages: []*manga.Page{
+		{Index: 0, IsModified: true, Contents: bytes.NewBuffer(make([]byte, 20)), Extension: ".webp"},
+	}}
+
+	assert.Equal(t, 0, keepSmallerPages(chapter, originals, 0))
+	assert.Equal(t, ".webp", chapter.Pages[0].Extension)
+}
+
+func TestOptimize_SizeGuards(t *testing.T) {
+	tests := []struct {
+		name              string
+		convertedSizes    []int
+		minChapterSavings float64
+		expectWritten     bool
+		expectedPagesKept uint64
+	}{
+		{
+			name:           "Chapter shrinks",
+			convertedSizes: []int{500, 500},
+			expectWritten:  true,
+		},
+		{
+			name:              "Grown pages are restored",
+			convertedSizes:    []int{500, 2000},
+			expectWritten:     true,
+			expectedPagesKept: 1,
+		},
+		{
+			name:              "Savings below threshold",
+			convertedSizes:    []int{900, 950},
+			minChapterSavings: 0.2,
+			expectWritten:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "chapter.cbz")
+			chapter := &manga.Chapter{FilePath: path, Pages: []*manga.Page{newSizedPage(0, 1000), newSizedPage(1, 1000)}}
+			require.NoError(t, cbz.WriteChapterToCBZ(chapter, path, nil))
+
+			var stats SavingsStats
+			err := Optimize(&OptimizeOptions{
+				ChapterConverter:  &resizingConverter{sizes: tt.convertedSizes},
+				Path:              path,
+				ConvertOptions:    converter.ConvertOptions{Quality: 80},
+				MinChapterSavings: tt.minChapterSavings,
+				Stats:             &stats,
+			})
+			require.NoError(t, err)
+
+			outputPath := filepath.Join(dir, "chapter_converted.cbz")
+			_, err = os.Stat(outputPath)
+			if !tt.expectWritten {
+				assert.True(t, os.IsNotExist(err), "chapter shouldn't be written")
+				assert.Equal(t, uint64(1), stats.ChaptersSkipped.Load())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, uint64(0), stats.ChaptersSkipped.Load())
+			assert.Equal(t, tt.expectedPagesKept, stats.PagesKept.Load())
+
+			written, err := cbz.LoadChapter(outputPath, nil)
+			require.NoError(t, err)
+			require.Len(t, written.Pages, 2)
+			for _, page := range written.Pages {
+				assert.LessOrEqual(t, page.Contents.Len(), 1000, "no page should be bigger than its original")
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/cbz"
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+	gowebp "github.com/gen2brain/webp"
+	"github.com/rs/zerolog/log"
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+)
+
+// verifyChapter loads the archive written at path back and checks that it holds the chapter: the same number of
+// pages, each of them decoding, and the same ComicInfo.xml.
+func verifyChapter(path string, chapter *manga.Chapter) error {
+	// Nothing is ignored, a page written as garbage shows up as a missing page
+	written, err := cbz.LoadChapter(path, &cbz.LoadOptions{OtherFiles: cbz.OtherFilesKeep})
+	if err != nil {
+		return fmt.Errorf("failed to load written chapter: %w", err)
+	}
+
+	if len(written.Pages) != len(chapter.Pages) {
+		return fmt.Errorf("expected %d pages, found %d", len(chapter.Pages), len(written.Pages))
+	}
+	for _, page := range written.Pages {
+		if err := decodeWrittenPage(page.Contents.Bytes()); err != nil {
+			return fmt.Errorf("page %s can't be decoded: %w", page.Path, err)
+		}
+	}
+	if written.ComicInfoXml != chapter.ComicInfoXml {
+		return fmt.Errorf("ComicInfo.xml doesn't match the converted chapter")
+	}
+
+	log.Debug().Str("file", path).Int("pages", len(written.Pages)).Msg("Written chapter verified")
+	return nil
+}
+
+// decodeWrittenPage decodes the image of a page. WebP pages are decoded with libwebp, which also reads the
+// animated ones.
+func decodeWrittenPage(data []byte) error {
+	if len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP" {
+		_, err := gowebp.Decode(bytes.NewReader(data))
+		return err
+	}
+	_, _, err := image.Decode(bytes.NewReader(data))
+	return err
+}
@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/cbz"
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/constant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// corruptPNG has the signature of a PNG, so it is loaded as a page, but can't be decoded.
+const corruptPNG = "\x89PNG\r\n\x1a\ntruncated"
+
+// corruptingConverter replaces every page by a page that can't be decoded.
+type corruptingConverter struct{}
+
+func (c *corruptingConverter) ConvertChapter(ctx context.Context, chapter *manga.Chapter, opts *converter.ConvertOptions, progress func(message string, current uint32, total uint32)) (*manga.Chapter, error) {
+	for _, page := range chapter.Pages {
+		container := manga.NewContainer(page, nil, "png", true)
+		container.SetConverted(bytes.NewBufferString(corruptPNG), ".webp")
+	}
+	return chapter, nil
+}
+
+func (c *corruptingConverter) Format() constant.ConversionFormat {
+	return constant.WebP
+}
+
+func (c *corruptingConverter) PrepareConverter() error {
+	return nil
+}
+
+func TestVerifyChapter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Chapter 1.cbz")
+	chapter := &manga.Chapter{
+		FilePath:     path,
+		Pages:        []*manga.Page{newPNGPage(t, 0, 200), newPNGPage(t, 1, 100)},
+		ComicInfoXml: "<Series>Boundless Necromancer</Series>",
+	}
+	require.NoError(t, cbz.WriteChapterToCBZ(chapter, path, nil))
+	assert.NoError(t, verifyChapter(path, chapter))
+
+	missingPage := *chapter
+	missingPage.Pages = append(missingPage.Pages, newPNGPage(t, 2, 50))
+	assert.ErrorContains(t, verifyChapter(path, &missingPage), "expected 3 pages, found 2")
+
+	otherComicInfo := *chapter
+	otherComicInfo.ComicInfoXml = "<Series>Another Series</Series>"
+	assert.ErrorContains(t, verifyChapter(path, &otherComicInfo), "ComicInfo.xml")
+
+	corrupt := &manga.Chapter{
+		FilePath: path,
+		Pages:    []*manga.Page{newPNGPage(t, 0, 200), {Index: 1, Extension: ".png", Contents: bytes.NewBufferString(corruptPNG)}},
+	}
+	require.NoError(t, cbz.WriteChapterToCBZ(corrupt, path, nil))
+	assert.ErrorContains(t, verifyChapter(path, corrupt), "can't be decoded")
+
+	assert.Error(t, verifyChapter(filepath.Join(t.TempDir(), "missing.cbz"), chapter))
+}
+
+func TestOptimize_VerificationFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Chapter 1.cbz")
+	chapter := &manga.Chapter{FilePath: path, Pages: []*manga.Page{newPNGPage(t, 0, 200), newPNGPage(t, 1, 100)}}
+	require.NoError(t, cbz.WriteChapterToCBZ(chapter, path, nil))
+	original, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	err = Optimize(&OptimizeOptions{
+		ChapterConverter: &corruptingConverter{},
+		Path:             path,
+		ConvertOptions:   converter.ConvertOptions{Quality: 80},
+		Override:         true,
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed verification")
+
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, original, contents, "the original archive is left untouched")
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "the written archive is removed")
+}
@@ -0,0 +1,366 @@
+package auto
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"runtime"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/avif"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/constant"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/jxl"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/pipeline"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/webp"
+	"github.com/rs/zerolog/log"
+	_ "golang.org/x/image/webp"
+)
+
+// Candidate is one of the encodings tried on each page.
+type Candidate struct {
+	// Name identifies the candidate in the logs.
+	Name string
+	// Extension given to the page when the candidate is kept.
+	Extension string
+	// Lossless candidates are the only ones tried when lossless conversion is requested.
+	Lossless bool
+	// MaxHeight is the tallest page the candidate can encode, 0 when there is no limit.
+	MaxHeight int
+	// Prepare is called once before the first conversion.
+	Prepare func() error
+	// Encode receives the effort of the options, 0 when the encoder default should be used.
+	Encode func(w io.Writer, img image.Image, quality uint, effort int) error
+}
+
+// DefaultCandidates are the encodings compared by New, lossy and lossless for each format.
+func DefaultCandidates() []Candidate {
+	return []Candidate{
+		{
+			Name:      "webp-lossy",
+			Extension: ".webp",
+			MaxHeight: 16383,
+			Prepare:   webp.PrepareEncoder,
+			Encode: func(w io.Writer, img image.Image, quality uint, effort int) error {
+				return webp.EncodeWithOptions(w, img, webp.EncodeOptions{
+					Quality:  quality,
+					Lossless: false,
+					Method:   options.ScaleEffort(effort, 0, 6, webp.DefaultMethod),
+				})
+			},
+		},
+		{
+			Name:      "webp-lossless",
+			Extension: ".webp",
+			Lossless:  true,
+			MaxHeight: 16383,
+			Prepare:   webp.PrepareEncoder,
+			Encode: func(w io.Writer, img image.Image, quality uint, effort int) error {
+				return webp.EncodeWithOptions(w, img, webp.EncodeOptions{
+					Quality:  quality,
+					Lossless: true,
+					Method:   options.ScaleEffort(effort, 0, 6, webp.DefaultMethod),
+				})
+			},
+		},
+		{
+			Name:      "avif-lossy",
+			Extension: ".avif",
+			MaxHeight: 65536,
+			Prepare:   avif.PrepareEncoder,
+			Encode: func(w io.Writer, img image.Image, quality uint, effort int) error {
+				return avif.EncodeWithOptions(w, img, avif.EncodeOptions{
+					Quality:  quality,
+					Lossless: false,
+					Speed:    options.ScaleEffort(effort, 10, 0, avif.DefaultSpeed),
+				})
+			},
+		},
+		{
+			Name:      "avif-lossless",
+			Extension: ".avif",
+			Lossless:  true,
+			MaxHeight: 65536,
+			Prepare:   avif.PrepareEncoder,
+			Encode: func(w io.Writer, img image.Image, quality uint, effort int) error {
+				return avif.EncodeWithOptions(w, img, avif.EncodeOptions{
+					Quality:  quality,
+					Lossless: true,
+					Speed:    options.ScaleEffort(effort, 10, 0, avif.DefaultSpeed),
+				})
+			},
+		},
+		{
+			Name:      "jxl-lossy",
+			Extension: ".jxl",
+			Prepare:   jxl.PrepareEncoder,
+			Encode: func(w io.Writer, img image.Image, quality uint, effort int) error {
+				return jxl.EncodeWithOptions(w, img, jxl.EncodeOptions{
+					Quality:  quality,
+					Lossless: false,
+					Effort:   options.ScaleEffort(effort, 1, 9, jxl.DefaultEffort),
+				})
+			},
+		},
+		{
+			Name:      "jxl-lossless",
+			Extension: ".jxl",
+			Lossless:  true,
+			Prepare:   jxl.PrepareEncoder,
+			Encode: func(w io.Writer, img image.Image, quality uint, effort int) error {
+				return jxl.EncodeWithOptions(w, img, jxl.EncodeOptions{
+					Quality:  quality,
+					Lossless: true,
+					Effort:   options.ScaleEffort(effort, 1, 9, jxl.DefaultEffort),
+				})
+			},
+		},
+	}
+}
+
+// Converter encodes each page with every candidate and keeps the smallest result,
+// the original page included.
+type Converter struct {
+	maxHeight  int
+	cropHeight int
+	splitMode  options.SplitMode
+	effort     int
+	candidates []Candidate
+	isPrepared bool
+}
+
+func (converter *Converter) Format() (format constant.ConversionFormat) {
+	return constant.Auto
+}
+
+func New() *Converter {
+	return &Converter{
+		maxHeight:  4000,
+		cropHeight: 2000,
+		candidates: DefaultCandidates(),
+		isPrepared: false,
+	}
+}
+
+func (converter *Converter) PrepareConverter() error {
+	if converter.isPrepared {
+		return nil
+	}
+	for _, candidate := range converter.candidates {
+		if candidate.Prepare == nil {
+			continue
+		}
+		if err := candidate.Prepare(); err != nil {
+			return fmt.Errorf("failed to prepare %s encoder: %w", candidate.Name, err)
+		}
+	}
+	converter.isPrepared = true
+	return nil
+}
+
+func (converter *Converter) ConvertChapter(ctx context.Context, chapter *manga.Chapter, opts *options.ConvertOptions, progress func(message string, current uint32, total uint32)) (*manga.Chapter, error) {
+	err := opts.Validate()
+	if err != nil {
+		return nil, err
+	}
+	converter = converter.withOptions(opts)
+
+	log.Debug().
+		Str("chapter", chapter.FilePath).
+		Int("pages", len(chapter.Pages)).
+		Uint8("quality", opts.Quality).
+		Bool("lossless", opts.Lossless).
+		Bool("split", opts.Split).
+		Str("split_mode", string(converter.splitMode)).
+		Str("spreads", string(opts.Spreads)).
+		Int("max_height", converter.maxHeight).
+		Int("crop_height", converter.cropHeight).
+		Int("effort", converter.effort).
+		Int("candidates", len(converter.candidates)).
+		Int("max_goroutines", runtime.NumCPU()).
+		Msg("Starting chapter conversion")
+
+	err = converter.PrepareConverter()
+	if err != nil {
+		log.Error().Str("chapter", chapter.FilePath).Err(err).Msg("Failed to prepare converter")
+		return nil, err
+	}
+
+	return pipeline.Run(ctx, chapter, opts, &pipeline.Stages{
+		Format:              converter.Format(),
+		CheckPageNeedsSplit: converter.checkPageNeedsSplit,
+		CropImage:           converter.cropImage,
+		ConvertPage: func(container *manga.PageContainer) (*manga.PageContainer, error) {
+			return converter.convertPage(container, opts.Quality, opts.Lossless)
+		},
+		ConvertAnimation: func(container *manga.PageContainer) (*manga.PageContainer, error) {
+			return converter.convertAnimation(container, opts.Quality, opts.Lossless)
+		},
+	}, progress)
+}
+
+// withOptions returns a copy of the converter using the heights, split mode and effort of the options.
+func (converter *Converter) withOptions(opts *options.ConvertOptions) *Converter {
+	configured := *converter
+	configured.maxHeight, configured.cropHeight = opts.Heights(converter.maxHeight, converter.cropHeight)
+	configured.splitMode = opts.SplitMode
+	configured.effort = opts.Effort
+	return &configured
+}
+
+func (converter *Converter) cropImage(img image.Image) ([]image.Image, error) {
+	// Parts fit the candidate with the lowest height limit
+	maxPartHeight := 0
+	for _, candidate := range converter.candidates {
+		if candidate.MaxHeight > 0 && (maxPartHeight == 0 || candidate.MaxHeight < maxPartHeight) {
+			maxPartHeight = candidate.MaxHeight
+		}
+	}
+	return pipeline.SplitImage(img, converter.splitMode, converter.cropHeight, maxPartHeight)
+}
+
+// checkPageNeedsSplit never ignores a page: when it is too tall for every candidate, the original is kept.
+func (converter *Converter) checkPageNeedsSplit(page *manga.Page, splitRequested bool) (bool, image.Image, string, error) {
+	log.Debug().
+		Uint16("page_index", page.Index).
+		Bool("split_requested", splitRequested).
+		Int("page_size", len(page.Contents.Bytes())).
+		Msg("Analyzing page for splitting")
+
+	img, format, err := pipeline.DecodePage(page)
+	if err != nil {
+		log.Debug().Uint16("page_index", page.Index).Err(err).Msg("Failed to decode page image")
+		return false, nil, format, err
+	}
+
+	height := img.Bounds().Dy()
+	needsSplit := height >= converter.maxHeight && splitRequested
+	log.Debug().
+		Uint16("page_index", page.Index).
+		Int("width", img.Bounds().Dx()).
+		Int("height", height).
+		Str("format", format).
+		Int("max_height", converter.maxHeight).
+		Bool("needs_split", needsSplit).
+		Msg("Page splitting decision made")
+
+	return needsSplit, img, format, nil
+}
+
+func (converter *Converter) convertPage(container *manga.PageContainer, quality uint8, lossless bool) (*manga.PageContainer, error) {
+	log.Debug().
+		Uint16("page_index", container.Page.Index).
+		Str("format", container.Format).
+		Bool("to_be_converted", container.IsToBeConverted).
+		Uint8("quality", quality).
+		Bool("lossless", lossless).
+		Msg("Converting page")
+
+	if !container.IsToBeConverted {
+		log.Debug().
+			Uint16("page_index", container.Page.Index).
+			Msg("Page marked as not to be converted, skipping")
+		return container, nil
+	}
+
+	// Split pages don't have contents, they have to be encoded by one of the candidates.
+	bestName := "original"
+	bestSize := -1
+	if container.Page.Contents != nil {
+		bestSize = container.Page.Contents.Len()
+	}
+	var best *Candidate
+	var bestBuffer *bytes.Buffer
+	var errList []error
+
+	height := container.Image.Bounds().Dy()
+	for i := range converter.candidates {
+		candidate := &converter.candidates[i]
+		if lossless && !candidate.Lossless {
+			continue
+		}
+		if candidate.MaxHeight > 0 && height > candidate.MaxHeight {
+			log.Debug().
+				Uint16("page_index", container.Page.Index).
+				Str("candidate", candidate.Name).
+				Int("height", height).
+				Int("max_height", candidate.MaxHeight).
+				Msg("Page too tall for candidate, skipping it")
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err := candidate.Encode(&buf, container.Image, uint(quality), converter.effort); err != nil {
+			log.Debug().
+				Uint16("page_index", container.Page.Index).
+				Str("candidate", candidate.Name).
+				Err(err).
+				Msg("Candidate failed to encode page")
+			errList = append(errList, fmt.Errorf("%s: %w", candidate.Name, err))
+			continue
+		}
+		log.Trace().
+			Uint16("page_index", container.Page.Index).
+			Str("candidate", candidate.Name).
+			Int("size", buf.Len()).
+			Msg("Candidate encoded page")
+
+		if bestSize < 0 || buf.Len() < bestSize {
+			best = candidate
+			bestName = candidate.Name
+			bestSize = buf.Len()
+			bestBuffer = &buf
+		}
+	}
+
+	if bestSize < 0 {
+		// Nothing to keep, the pipeline falls back to PNG
+		err := fmt.Errorf("no candidate could encode page %d", container.Page.Index)
+		if len(errList) > 0 {
+			err = fmt.Errorf("%w: %w", err, errors.Join(errList...))
+		}
+		return container, err
+	}
+
+	log.Debug().
+		Uint16("page_index", container.Page.Index).
+		Str("kept", bestName).
+		Int("size", bestSize).
+		Msg("Smallest encoding selected")
+
+	if best == nil {
+		return container, nil
+	}
+	container.SetConverted(bestBuffer, best.Extension)
+	return container, nil
+}
+
+// convertAnimation encodes the frames of the container to an animated WebP file, keeping the original page when
+// it is smaller.
+func (converter *Converter) convertAnimation(container *manga.PageContainer, quality uint8, lossless bool) (*manga.PageContainer, error) {
+	var buf bytes.Buffer
+	err := webp.EncodeAnimation(&buf, container.Animation, webp.EncodeOptions{
+		Quality:  uint(quality),
+		Lossless: lossless,
+		Method:   options.ScaleEffort(converter.effort, 0, 6, webp.DefaultMethod),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if buf.Len() >= container.Page.Contents.Len() {
+		log.Debug().
+			Uint16("page_index", container.Page.Index).
+			Int("original_size", container.Page.Contents.Len()).
+			Int("converted_size", buf.Len()).
+			Msg("Animated WebP not smaller, keeping the original page")
+		return container, nil
+	}
+	container.SetConverted(&buf, ".webp")
+	return container, nil
+}
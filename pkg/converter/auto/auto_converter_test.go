@@ -0,0 +1,219 @@
+package auto
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math/rand/v2"
+	"sync"
+	"testing"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/constant"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/webp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createTwoToneImage draws black text-like stripes on a white page, the kind of page lossless WebP handles well.
+func createTwoToneImage(width, height int) image.Image {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if (y/8)%3 == 0 && (x/5)%4 != 0 {
+				img.SetGray(x, y, color.Gray{Y: 0})
+			} else {
+				img.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+	return img
+}
+
+func createTestPage(t *testing.T, index int, img image.Image) *manga.Page {
+	buf := new(bytes.Buffer)
+	require.NoError(t, png.Encode(buf, img))
+	return &manga.Page{
+		Index:     uint16(index),
+		Contents:  buf,
+		Extension: ".png",
+		Size:      uint64(buf.Len()),
+	}
+}
+
+// fixedCandidate writes size bytes whatever the image is.
+func fixedCandidate(name string, size int, lossless bool) Candidate {
+	return Candidate{
+		Name:      name,
+		Extension: "." + name,
+		Lossless:  lossless,
+		Encode: func(w io.Writer, img image.Image, quality uint, effort int) error {
+			_, err := w.Write(make([]byte, size))
+			return err
+		},
+	}
+}
+
+func TestConverter_ConvertChapter(t *testing.T) {
+	converter := New()
+	require.NoError(t, converter.PrepareConverter())
+
+	pages := []*manga.Page{
+		createTestPage(t, 0, createTwoToneImage(400, 600)),
+		createTestPage(t, 1, createTwoToneImage(200, 5000)),
+	}
+	var progressMutex sync.Mutex
+	var lastProgress uint32
+	progress := func(message string, current uint32, total uint32) {
+		progressMutex.Lock()
+		defer progressMutex.Unlock()
+		assert.GreaterOrEqual(t, current, lastProgress, "Progress should never decrease")
+		lastProgress = current
+	}
+
+	convertedChapter, err := converter.ConvertChapter(context.Background(), &manga.Chapter{Pages: pages}, &options.ConvertOptions{Quality: 80, Split: true}, progress)
+	require.NoError(t, err)
+	require.Len(t, convertedChapter.Pages, 4, "second page should be split in 3 parts")
+
+	for _, page := range convertedChapter.Pages {
+		assert.Equal(t, ".webp", page.Extension)
+		_, format, err := image.Decode(bytes.NewReader(page.Contents.Bytes()))
+		require.NoError(t, err)
+		assert.Equal(t, "webp", format)
+	}
+}
+
+func TestConverter_convertPage_KeepsSmallest(t *testing.T) {
+	converter := New()
+	require.NoError(t, converter.PrepareConverter())
+
+	img := createTwoToneImage(300, 400)
+	page := createTestPage(t, 1, img)
+
+	expected := page.Contents.Len()
+	for _, candidate := range DefaultCandidates() {
+		var buf bytes.Buffer
+		require.NoError(t, candidate.Encode(&buf, img, 80, 0))
+		expected = min(expected, buf.Len())
+	}
+	var lossy bytes.Buffer
+	require.NoError(t, webp.Encode(&lossy, img, 80, false))
+
+	converted, err := converter.convertPage(manga.NewContainer(page, img, "png", true), 80, false)
+	require.NoError(t, err)
+	assert.Equal(t, expected, converted.Page.Contents.Len())
+	assert.Equal(t, uint64(expected), converted.Page.Size)
+	assert.Less(t, converted.Page.Contents.Len(), lossy.Len(), "lossless WebP should beat lossy on a two tone page")
+}
+
+func TestConverter_convertPage_OtherFormatWins(t *testing.T) {
+	converter := New()
+	require.NoError(t, converter.PrepareConverter())
+
+	// Grain like noise, that JPEG XL compresses better than WebP
+	random := rand.New(rand.NewPCG(1, 2))
+	img := image.NewGray(image.Rect(0, 0, 300, 400))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(random.IntN(256))
+	}
+	page := createTestPage(t, 1, img)
+
+	converted, err := converter.convertPage(manga.NewContainer(page, img, "png", true), 80, false)
+	require.NoError(t, err)
+	assert.Equal(t, ".jxl", converted.Page.Extension)
+	_, format, err := image.Decode(bytes.NewReader(converted.Page.Contents.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, "jxl", format)
+}
+
+func TestConverter_convertPage_KeepsOriginal(t *testing.T) {
+	converter := New()
+	require.NoError(t, converter.PrepareConverter())
+
+	// A low quality WebP can't get smaller when encoded again at a high quality
+	img := image.NewRGBA(image.Rect(0, 0, 200, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 200; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * y), G: uint8(x ^ y), B: uint8(x + y), A: 255})
+		}
+	}
+	original := new(bytes.Buffer)
+	require.NoError(t, webp.Encode(original, img, 5, false))
+	originalBytes := bytes.Clone(original.Bytes())
+	page := &manga.Page{Index: 1, Contents: original, Extension: ".webp", Size: uint64(original.Len())}
+
+	converted, err := converter.convertPage(manga.NewContainer(page, img, "webp", true), 95, false)
+	require.NoError(t, err)
+	assert.False(t, converted.HasBeenConverted)
+	assert.Equal(t, ".webp", converted.Page.Extension)
+	assert.Equal(t, originalBytes, converted.Page.Contents.Bytes())
+}
+
+func TestConverter_convertPage_Candidates(t *testing.T) {
+	img := createTwoToneImage(10, 10)
+
+	tests := []struct {
+		name              string
+		candidates        []Candidate
+		lossless          bool
+		noContents        bool
+		expectedExtension string
+		expectError       bool
+	}{
+		{
+			name:              "Smallest candidate wins",
+			candidates:        []Candidate{fixedCandidate("big", 30, true), fixedCandidate("small", 10, false)},
+			expectedExtension: ".small",
+		},
+		{
+			name:              "Lossless skips lossy candidates",
+			candidates:        []Candidate{fixedCandidate("big", 30, true), fixedCandidate("small", 10, false)},
+			lossless:          true,
+			expectedExtension: ".big",
+		},
+		{
+			name:              "Original wins when candidates are bigger",
+			candidates:        []Candidate{fixedCandidate("huge", 1<<20, false)},
+			expectedExtension: ".png",
+		},
+		{
+			name:              "Split part without original",
+			candidates:        []Candidate{fixedCandidate("huge", 1<<20, false)},
+			noContents:        true,
+			expectedExtension: ".huge",
+		},
+		{
+			name:        "No candidate fits a split part",
+			candidates:  []Candidate{{Name: "tiny", Extension: ".tiny", MaxHeight: 5, Encode: fixedCandidate("tiny", 1, false).Encode}},
+			noContents:  true,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			converter := &Converter{maxHeight: 4000, cropHeight: 2000, candidates: tt.candidates}
+			page := createTestPage(t, 1, img)
+			if tt.noContents {
+				page = &manga.Page{Index: 1, IsSplitted: true}
+			}
+
+			converted, err := converter.convertPage(manga.NewContainer(page, img, "png", true), 80, tt.lossless)
+			if tt.expectError {
+				assert.Error(t, err)
+				assert.NotNil(t, converted, "the container is returned so the pipeline can fall back to PNG")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedExtension, converted.Page.Extension)
+		})
+	}
+}
+
+func TestConverter_Format(t *testing.T) {
+	assert.Equal(t, constant.Auto, New().Format())
+}
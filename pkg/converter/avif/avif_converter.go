@@ -0,0 +1,236 @@
+package avif
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"runtime"
+	"strings"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/constant"
+	converterrors "github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/errors"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/pipeline"
+	"github.com/rs/zerolog/log"
+	_ "golang.org/x/image/webp"
+)
+
+// avifMaxHeight is the biggest frame dimension supported by AV1.
+const avifMaxHeight = 65536
+
+type Converter struct {
+	maxHeight  int
+	cropHeight int
+	splitMode  options.SplitMode
+	speed      int
+	isPrepared bool
+}
+
+func (converter *Converter) Format() (format constant.ConversionFormat) {
+	return constant.AVIF
+}
+
+func New() *Converter {
+	return &Converter{
+		maxHeight:  4000,
+		cropHeight: 2000,
+		speed:      DefaultSpeed,
+		isPrepared: false,
+	}
+}
+
+func (converter *Converter) PrepareConverter() error {
+	if converter.isPrepared {
+		return nil
+	}
+	err := PrepareEncoder()
+	if err != nil {
+		return err
+	}
+	converter.isPrepared = true
+	return nil
+}
+
+func (converter *Converter) ConvertChapter(ctx context.Context, chapter *manga.Chapter, opts *options.ConvertOptions, progress func(message string, current uint32, total uint32)) (*manga.Chapter, error) {
+	err := opts.Validate()
+	if err != nil {
+		return nil, err
+	}
+	converter = converter.withOptions(opts)
+
+	log.Debug().
+		Str("chapter", chapter.FilePath).
+		Int("pages", len(chapter.Pages)).
+		Uint8("quality", opts.Quality).
+		Bool("lossless", opts.Lossless).
+		Bool("split", opts.Split).
+		Str("split_mode", string(converter.splitMode)).
+		Str("spreads", string(opts.Spreads)).
+		Int("max_height", converter.maxHeight).
+		Int("crop_height", converter.cropHeight).
+		Int("speed", converter.speed).
+		Int("max_goroutines", runtime.NumCPU()).
+		Msg("Starting chapter conversion")
+
+	err = converter.PrepareConverter()
+	if err != nil {
+		log.Error().Str("chapter", chapter.FilePath).Err(err).Msg("Failed to prepare converter")
+		return nil, err
+	}
+
+	return pipeline.Run(ctx, chapter, opts, &pipeline.Stages{
+		Format:              converter.Format(),
+		CheckPageNeedsSplit: converter.checkPageNeedsSplit,
+		CropImage:           converter.cropImage,
+		ConvertPage: func(container *manga.PageContainer) (*manga.PageContainer, error) {
+			return converter.convertPage(container, opts.Quality, opts.Lossless)
+		},
+		ConvertAnimation: func(container *manga.PageContainer) (*manga.PageContainer, error) {
+			return converter.convertAnimation(container, opts.Quality, opts.Lossless)
+		},
+	}, progress)
+}
+
+// withOptions returns a copy of the converter using the heights, split mode and effort of the options.
+func (converter *Converter) withOptions(opts *options.ConvertOptions) *Converter {
+	configured := *converter
+	configured.maxHeight, configured.cropHeight = opts.Heights(converter.maxHeight, converter.cropHeight)
+	configured.splitMode = opts.SplitMode
+	configured.speed = opts.ScaleEffort(10, 0, converter.speed)
+	return &configured
+}
+
+func (converter *Converter) cropImage(img image.Image) ([]image.Image, error) {
+	return pipeline.SplitImage(img, converter.splitMode, converter.cropHeight, 0)
+}
+
+func (converter *Converter) checkPageNeedsSplit(page *manga.Page, splitRequested bool) (bool, image.Image, string, error) {
+	log.Debug().
+		Uint16("page_index", page.Index).
+		Bool("split_requested", splitRequested).
+		Int("page_size", len(page.Contents.Bytes())).
+		Msg("Analyzing page for splitting")
+
+	img, format, err := pipeline.DecodePage(page)
+	if err != nil {
+		log.Debug().Uint16("page_index", page.Index).Err(err).Msg("Failed to decode page image")
+		return false, nil, format, err
+	}
+
+	bounds := img.Bounds()
+	height := bounds.Dy()
+	width := bounds.Dx()
+
+	log.Debug().
+		Uint16("page_index", page.Index).
+		Int("width", width).
+		Int("height", height).
+		Str("format", format).
+		Int("max_height", converter.maxHeight).
+		Int("avif_max_height", avifMaxHeight).
+		Msg("Page dimensions analyzed")
+
+	if height > avifMaxHeight && !splitRequested {
+		log.Debug().
+			Uint16("page_index", page.Index).
+			Int("height", height).
+			Int("avif_max", avifMaxHeight).
+			Msg("Page too tall for AVIF format, would be ignored")
+		return false, img, format, converterrors.NewPageIgnored(fmt.Sprintf("page %d is too tall [max: %dpx] to be converted to avif format", page.Index, avifMaxHeight))
+	}
+
+	needsSplit := height >= converter.maxHeight && splitRequested
+	log.Debug().
+		Uint16("page_index", page.Index).
+		Bool("needs_split", needsSplit).
+		Msg("Page splitting decision made")
+
+	return needsSplit, img, format, nil
+}
+
+func (converter *Converter) convertPage(container *manga.PageContainer, quality uint8, lossless bool) (*manga.PageContainer, error) {
+	log.Debug().
+		Uint16("page_index", container.Page.Index).
+		Str("format", container.Format).
+		Bool("to_be_converted", container.IsToBeConverted).
+		Uint8("quality", quality).
+		Bool("lossless", lossless).
+		Msg("Converting page")
+
+	if strings.EqualFold(container.Format, "avif") {
+		log.Debug().
+			Uint16("page_index", container.Page.Index).
+			Msg("Page already in AVIF format, skipping conversion")
+		container.Page.Extension = ".avif"
+		return container, nil
+	}
+	if !container.IsToBeConverted {
+		log.Debug().
+			Uint16("page_index", container.Page.Index).
+			Msg("Page marked as not to be converted, skipping")
+		return container, nil
+	}
+
+	log.Debug().
+		Uint16("page_index", container.Page.Index).
+		Uint8("quality", quality).
+		Msg("Encoding page to AVIF format")
+
+	converted, err := converter.convert(container.Image, uint(quality), lossless)
+	if err != nil {
+		log.Error().
+			Uint16("page_index", container.Page.Index).
+			Err(err).
+			Msg("Failed to convert page to AVIF")
+		return nil, err
+	}
+
+	container.SetConverted(converted, ".avif")
+
+	log.Debug().
+		Uint16("page_index", container.Page.Index).
+		Int("converted_size", len(converted.Bytes())).
+		Msg("Page conversion completed")
+
+	return container, nil
+}
+
+// convertAnimation encodes the frames of the container to an AVIF image sequence.
+func (converter *Converter) convertAnimation(container *manga.PageContainer, quality uint8, lossless bool) (*manga.PageContainer, error) {
+	log.Debug().
+		Uint16("page_index", container.Page.Index).
+		Int("frames", len(container.Animation.Frames)).
+		Uint8("quality", quality).
+		Msg("Encoding animated page to AVIF format")
+
+	var buf bytes.Buffer
+	err := EncodeAnimation(&buf, container.Animation, EncodeOptions{
+		Quality:  uint(quality),
+		Lossless: lossless,
+		Speed:    converter.speed,
+	})
+	if err != nil {
+		return nil, err
+	}
+	container.SetConverted(&buf, ".avif")
+	return container, nil
+}
+
+// convert encodes an image to the AVIF format and returns the resulting file as a bytes.Buffer.
+func (converter *Converter) convert(image image.Image, quality uint, lossless bool) (*bytes.Buffer, error) {
+	var buf bytes.Buffer
+	err := EncodeWithOptions(&buf, image, EncodeOptions{
+		Quality:  quality,
+		Lossless: lossless,
+		Speed:    converter.speed,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &buf, nil
+}
@@ -0,0 +1,344 @@
+package avif
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"sync"
+	"testing"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/constant"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/options"
+	libavif "github.com/gen2brain/avif"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createTestImage(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	// Create a gradient pattern to ensure we have actual image data
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{
+				R: uint8((x * 255) / width),
+				G: uint8((y * 255) / height),
+				B: 100,
+				A: 255,
+			})
+		}
+	}
+	return img
+}
+
+func encodeImage(t *testing.T, img image.Image, format string) (*bytes.Buffer, string) {
+	buf := new(bytes.Buffer)
+
+	switch format {
+	case "jpeg", "jpg":
+		require.NoError(t, jpeg.Encode(buf, img, &jpeg.Options{Quality: 85}))
+		return buf, ".jpg"
+	case "avif":
+		require.NoError(t, Encode(buf, img, 80, false))
+		return buf, ".avif"
+	default:
+		require.NoError(t, png.Encode(buf, img))
+		return buf, ".png"
+	}
+}
+
+func createTestPage(t *testing.T, index int, width, height int, format string) *manga.Page {
+	buf, ext := encodeImage(t, createTestImage(width, height), format)
+
+	return &manga.Page{
+		Index:     uint16(index),
+		Contents:  buf,
+		Extension: ext,
+		Size:      uint64(buf.Len()),
+	}
+}
+
+func validateConvertedImage(t *testing.T, page *manga.Page) image.Image {
+	require.NotNil(t, page.Contents)
+	require.Greater(t, page.Contents.Len(), 0)
+
+	img, format, err := image.Decode(bytes.NewReader(page.Contents.Bytes()))
+	require.NoError(t, err, "Failed to decode converted image")
+
+	if page.Extension == ".avif" {
+		assert.Equal(t, "avif", format, "Expected AVIF format")
+	}
+
+	require.NotNil(t, img)
+	bounds := img.Bounds()
+	assert.Greater(t, bounds.Dx(), 0, "Image width should be positive")
+	assert.Greater(t, bounds.Dy(), 0, "Image height should be positive")
+	return img
+}
+
+func TestConverter_ConvertChapter(t *testing.T) {
+	tests := []struct {
+		name        string
+		pages       []*manga.Page
+		split       bool
+		lossless    bool
+		expectSplit bool
+		numExpected int
+	}{
+		{
+			name:        "Single normal image",
+			pages:       []*manga.Page{createTestPage(t, 1, 800, 1200, "jpeg")},
+			numExpected: 1,
+		},
+		{
+			name: "Multiple normal images",
+			pages: []*manga.Page{
+				createTestPage(t, 1, 800, 1200, "png"),
+				createTestPage(t, 2, 800, 1200, "jpeg"),
+			},
+			numExpected: 2,
+		},
+		{
+			name:        "Lossless conversion",
+			pages:       []*manga.Page{createTestPage(t, 1, 200, 300, "png")},
+			lossless:    true,
+			numExpected: 1,
+		},
+		{
+			name:        "Tall image with split enabled",
+			pages:       []*manga.Page{createTestPage(t, 1, 100, 5000, "jpeg")},
+			split:       true,
+			expectSplit: true,
+			numExpected: 3, // Based on cropHeight of 2000
+		},
+		{
+			name:        "Image taller than webp limit without split",
+			pages:       []*manga.Page{createTestPage(t, 1, 20, 17000, "png")},
+			numExpected: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			converter := New()
+			require.NoError(t, converter.PrepareConverter())
+
+			chapter := &manga.Chapter{
+				Pages: tt.pages,
+			}
+
+			var progressMutex sync.Mutex
+			var lastProgress uint32
+			progress := func(message string, current uint32, total uint32) {
+				progressMutex.Lock()
+				defer progressMutex.Unlock()
+				assert.GreaterOrEqual(t, current, lastProgress, "Progress should never decrease")
+				lastProgress = current
+				assert.LessOrEqual(t, current, total, "Current progress should not exceed total")
+			}
+
+			convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, &options.ConvertOptions{Quality: 80, Lossless: tt.lossless, Split: tt.split}, progress)
+			require.NoError(t, err)
+			require.NotNil(t, convertedChapter)
+			assert.Len(t, convertedChapter.Pages, tt.numExpected)
+
+			for _, page := range convertedChapter.Pages {
+				assert.Equal(t, ".avif", page.Extension)
+				validateConvertedImage(t, page)
+			}
+
+			splitFound := false
+			for _, page := range convertedChapter.Pages {
+				if page.IsSplitted {
+					splitFound = true
+					break
+				}
+			}
+			assert.Equal(t, tt.expectSplit, splitFound)
+		})
+	}
+}
+
+func TestConverter_convertPage(t *testing.T) {
+	converter := New()
+	require.NoError(t, converter.PrepareConverter())
+
+	tests := []struct {
+		name            string
+		format          string
+		isToBeConverted bool
+		expectAVIF      bool
+	}{
+		{
+			name:            "Convert PNG to AVIF",
+			format:          "png",
+			isToBeConverted: true,
+			expectAVIF:      true,
+		},
+		{
+			name:            "Already AVIF",
+			format:          "avif",
+			isToBeConverted: true,
+			expectAVIF:      true,
+		},
+		{
+			name:            "Skip conversion",
+			format:          "png",
+			isToBeConverted: false,
+			expectAVIF:      false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := createTestPage(t, 1, 100, 100, tt.format)
+			container := manga.NewContainer(page, createTestImage(100, 100), tt.format, tt.isToBeConverted)
+
+			converted, err := converter.convertPage(container, 80, false)
+			require.NoError(t, err)
+			assert.NotNil(t, converted)
+
+			if tt.expectAVIF {
+				assert.Equal(t, ".avif", converted.Page.Extension)
+				validateConvertedImage(t, converted.Page)
+			} else {
+				assert.NotEqual(t, ".avif", converted.Page.Extension)
+			}
+		})
+	}
+}
+
+func TestConverter_convertPage_Quality(t *testing.T) {
+	converter := New()
+	require.NoError(t, converter.PrepareConverter())
+
+	img := createTestImage(256, 256)
+	sizes := make(map[string]int)
+	for name, tc := range map[string]struct {
+		quality  uint8
+		lossless bool
+	}{
+		"low":      {quality: 20},
+		"high":     {quality: 95},
+		"lossless": {lossless: true},
+	} {
+		page := createTestPage(t, 1, 256, 256, "png")
+		container := manga.NewContainer(page, img, "png", true)
+		converted, err := converter.convertPage(container, tc.quality, tc.lossless)
+		require.NoError(t, err)
+		sizes[name] = converted.Page.Contents.Len()
+
+		if tc.lossless {
+			decoded := validateConvertedImage(t, converted.Page)
+			for _, point := range []image.Point{{0, 0}, {128, 64}, {255, 255}} {
+				r1, g1, b1, _ := img.At(point.X, point.Y).RGBA()
+				r2, g2, b2, _ := decoded.At(point.X, point.Y).RGBA()
+				assert.Equal(t, []uint32{r1 >> 8, g1 >> 8, b1 >> 8}, []uint32{r2 >> 8, g2 >> 8, b2 >> 8}, "lossless pixel mismatch at %v", point)
+			}
+		}
+	}
+
+	assert.Less(t, sizes["low"], sizes["high"], "lower quality should produce a smaller file")
+}
+
+func TestConverter_checkPageNeedsSplit(t *testing.T) {
+	converter := New()
+
+	tests := []struct {
+		name        string
+		imageHeight int
+		split       bool
+		expectSplit bool
+	}{
+		{
+			name:        "Normal height",
+			imageHeight: 1000,
+			split:       true,
+			expectSplit: false,
+		},
+		{
+			name:        "Height exceeds max with split enabled",
+			imageHeight: 5000,
+			split:       true,
+			expectSplit: true,
+		},
+		{
+			name:        "Height exceeds webp max without split",
+			imageHeight: 17000,
+			split:       false,
+			expectSplit: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := createTestPage(t, 1, 20, tt.imageHeight, "png")
+
+			needsSplit, img, format, err := converter.checkPageNeedsSplit(page, tt.split)
+			require.NoError(t, err)
+			assert.NotNil(t, img)
+			assert.NotEmpty(t, format)
+			assert.Equal(t, tt.expectSplit, needsSplit)
+		})
+	}
+}
+
+func TestConverter_Format(t *testing.T) {
+	converter := New()
+	assert.Equal(t, constant.AVIF, converter.Format())
+}
+
+func TestConverter_ConvertChapter_Timeout(t *testing.T) {
+	converter := New()
+	require.NoError(t, converter.PrepareConverter())
+
+	chapter := &manga.Chapter{
+		FilePath: "/test/chapter.cbz",
+		Pages: []*manga.Page{
+			createTestPage(t, 1, 800, 1200, "jpeg"),
+			createTestPage(t, 2, 800, 1200, "jpeg"),
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1)
+	defer cancel()
+
+	convertedChapter, err := converter.ConvertChapter(ctx, chapter, &options.ConvertOptions{Quality: 80}, func(string, uint32, uint32) {})
+
+	assert.Error(t, err)
+	assert.Nil(t, convertedChapter)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestConverter_ConvertChapter_Animations(t *testing.T) {
+	converter := New()
+	require.NoError(t, converter.PrepareConverter())
+
+	var animated bytes.Buffer
+	require.NoError(t, gif.EncodeAll(&animated, &gif.GIF{
+		Image: []*image.Paletted{
+			image.NewPaletted(image.Rect(0, 0, 64, 64), color.Palette{color.Black, color.White}),
+			image.NewPaletted(image.Rect(0, 0, 64, 64), color.Palette{color.White, color.Black}),
+		},
+		Delay: []int{20, 20},
+	}))
+	chapter := &manga.Chapter{Pages: []*manga.Page{{Index: 0, Contents: &animated, Extension: ".gif", Size: uint64(animated.Len())}}}
+
+	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, &options.ConvertOptions{
+		Quality:    80,
+		Animations: options.AnimationConvert,
+	}, func(string, uint32, uint32) {})
+	require.NoError(t, err)
+	require.Len(t, convertedChapter.Pages, 1)
+
+	page := convertedChapter.Pages[0]
+	assert.Equal(t, ".avif", page.Extension)
+	sequence, err := libavif.DecodeAll(bytes.NewReader(page.Contents.Bytes()))
+	require.NoError(t, err)
+	assert.Len(t, sequence.Image, 2)
+}
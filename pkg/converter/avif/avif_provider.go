@@ -0,0 +1,64 @@
+package avif
+
+import (
+	"image"
+	"io"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+	libavif "github.com/gen2brain/avif"
+)
+
+// DefaultSpeed is the encoding speed used when none is given, 0 being the slowest and 10 the fastest.
+const DefaultSpeed = 8
+
+// PrepareEncoder loads libavif (shared library or embedded WASM module) by encoding a single pixel.
+func PrepareEncoder() error {
+	return libavif.Encode(io.Discard, image.NewGray(image.Rect(0, 0, 1, 1)), libavif.Options{Speed: 10})
+}
+
+// EncodeOptions holds the encoder settings.
+type EncodeOptions struct {
+	Quality  uint
+	Lossless bool
+	// Speed trades encoding time for size, 0 being the slowest and 10 the fastest.
+	Speed int
+}
+
+func Encode(w io.Writer, m image.Image, quality uint, lossless bool) error {
+	return EncodeWithOptions(w, m, EncodeOptions{
+		Quality:  quality,
+		Lossless: lossless,
+		Speed:    DefaultSpeed,
+	})
+}
+
+func EncodeWithOptions(w io.Writer, m image.Image, options EncodeOptions) error {
+	return libavif.Encode(w, m, libavif.Options{
+		Quality:           int(options.Quality),
+		QualityAlpha:      int(options.Quality),
+		Speed:             options.Speed,
+		ChromaSubsampling: image.YCbCrSubsampleRatio420,
+		Lossless:          options.Lossless,
+	})
+}
+
+// EncodeAnimation encodes the frames to an AVIF image sequence.
+func EncodeAnimation(w io.Writer, animation *manga.Animation, options EncodeOptions) error {
+	delays := make([]float64, len(animation.Frames))
+	for i := range delays {
+		if i < len(animation.Delays) {
+			delays[i] = float64(animation.Delays[i]) / 1000
+		}
+	}
+	return libavif.EncodeAll(w, &libavif.AVIF{
+		Image:     animation.Frames,
+		Delay:     delays,
+		LoopCount: animation.LoopCount,
+	}, libavif.Options{
+		Quality:           int(options.Quality),
+		QualityAlpha:      int(options.Quality),
+		Speed:             options.Speed,
+		ChromaSubsampling: image.YCbCrSubsampleRatio420,
+		Lossless:          options.Lossless,
+	})
+}
@@ -6,14 +6,23 @@ type ConversionFormat enumflag.Flag
 
 const (
 	WebP ConversionFormat = iota
+	AVIF
+	JXL
+	Auto
 )
 
 var CommandValue = map[ConversionFormat][]string{
 	WebP: {"webp"},
+	AVIF: {"avif"},
+	JXL:  {"jxl", "jpegxl"},
+	Auto: {"auto"},
 }
 
 var HelpText = enumflag.Help[ConversionFormat]{
 	WebP: "WebP Image Format",
+	AVIF: "AVIF Image Format",
+	JXL:  "JPEG XL Image Format, lossless mode recompresses JPEG pages reversibly",
+	Auto: "Smallest of WebP lossy, WebP lossless and the original page, chosen per page",
 }
 
 var DefaultConversion = WebP
@@ -6,23 +6,36 @@ import (
 	"strings"
 
 	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/auto"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/avif"
 	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/constant"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/jxl"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/options"
 	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/webp"
 	"github.com/samber/lo"
 )
 
+// ConvertOptions tells a converter how to convert a chapter, see options.ConvertOptions.
+type ConvertOptions = options.ConvertOptions
+
 type Converter interface {
 	// Format of the converter
 	Format() (format constant.ConversionFormat)
 	// ConvertChapter converts a manga chapter to the specified format.
 	//
 	// Returns partial success where some pages are converted and some are not.
-	ConvertChapter(ctx context.Context, chapter *manga.Chapter, quality uint8, lossless bool, split bool, progress func(message string, current uint32, total uint32)) (*manga.Chapter, error)
+	//
+	// A converter is shared between the chapters converted in parallel: the options apply to the given chapter
+	// only and must never be stored in the converter itself.
+	ConvertChapter(ctx context.Context, chapter *manga.Chapter, opts *ConvertOptions, progress func(message string, current uint32, total uint32)) (*manga.Chapter, error)
 	PrepareConverter() error
 }
 
 var converters = map[constant.ConversionFormat]Converter{
 	constant.WebP: webp.New(),
+	constant.AVIF: avif.New(),
+	constant.JXL:  jxl.New(),
+	constant.Auto: auto.New(),
 }
 
 // Available returns a list of available converters.
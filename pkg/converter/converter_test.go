@@ -85,7 +85,7 @@ func TestConvertChapter(t *testing.T) {
 						t.Log(msg)
 					}
 
-					convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, quality, false, tc.split, progress)
+					convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, &ConvertOptions{Quality: quality, Split: tc.split}, progress)
 					if err != nil {
 						if convertedChapter != nil && slices.Contains(tc.expectPartialSuccess, converter.Format()) {
 							t.Logf("Partial success to convert genTestChapter: %v", err)
@@ -108,9 +108,17 @@ func TestConvertChapter(t *testing.T) {
 						t.Fatalf("converted chapter has different number of pages")
 					}
 
+					expectedExtension := "." + converter.Format().String()
 					for _, page := range convertedChapter.Pages {
-						if page.Extension != ".webp" {
-							t.Errorf("page %d was not converted to webp format", page.Index)
+						// The auto format picks the extension of the smallest encoding
+						if converter.Format() == constant.Auto {
+							if !slices.Contains([]string{".webp", ".avif", ".jxl", ".jpg"}, page.Extension) {
+								t.Errorf("page %d has unexpected extension %s", page.Index, page.Extension)
+							}
+							continue
+						}
+						if page.Extension != expectedExtension {
+							t.Errorf("page %d was not converted to %s format", page.Index, converter.Format())
 						}
 					}
 				})
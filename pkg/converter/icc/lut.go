@@ -0,0 +1,339 @@
+package icc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// curve maps a normalized value (0-1) to another.
+type curve func(float64) float64
+
+func identity(value float64) float64 {
+	return value
+}
+
+// parseCurve reads a curv or para curve, returning it with its size in bytes.
+func parseCurve(data []byte) (curve, int, error) {
+	if len(data) < 12 {
+		return nil, 0, errTruncated
+	}
+	switch string(data[:4]) {
+	case "curv":
+		count := int(binary.BigEndian.Uint32(data[8:]))
+		size := 12 + 2*count
+		if len(data) < size {
+			return nil, 0, errTruncated
+		}
+		switch count {
+		case 0:
+			return identity, size, nil
+		case 1:
+			gamma := float64(binary.BigEndian.Uint16(data[12:])) / 256
+			return func(value float64) float64 { return math.Pow(value, gamma) }, size, nil
+		default:
+			table := make([]float64, count)
+			for i := range table {
+				table[i] = float64(binary.BigEndian.Uint16(data[12+2*i:])) / 65535
+			}
+			return tableCurve(table), size, nil
+		}
+	case "para":
+		function := int(binary.BigEndian.Uint16(data[8:]))
+		counts := []int{1, 3, 4, 5, 7}
+		if function >= len(counts) {
+			return nil, 0, fmt.Errorf("unknown icc parametric curve %d", function)
+		}
+		size := 12 + 4*counts[function]
+		if len(data) < size {
+			return nil, 0, errTruncated
+		}
+		// Missing parameters are set so that every function type reduces to the complete one
+		p := []float64{1, 1, 0, 0, math.Inf(-1), 0, 0}
+		for i := 0; i < counts[function]; i++ {
+			p[i] = s15Fixed16(data[12+4*i:])
+		}
+		g, a, b, c, d, e, f := p[0], p[1], p[2], p[3], p[4], p[5], p[6]
+		switch function {
+		case 0:
+			return func(value float64) float64 { return math.Pow(value, g) }, size, nil
+		case 1, 2:
+			return func(value float64) float64 {
+				if a != 0 && value >= -b/a {
+					return math.Pow(max(a*value+b, 0), g) + c
+				}
+				return c
+			}, size, nil
+		default:
+			return func(value float64) float64 {
+				if value >= d {
+					return math.Pow(max(a*value+b, 0), g) + e
+				}
+				return c*value + f
+			}, size, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("unknown icc curve type %q", data[:4])
+}
+
+// tableCurve interpolates linearly between the evenly spaced entries of the table.
+func tableCurve(table []float64) curve {
+	last := len(table) - 1
+	return func(value float64) float64 {
+		position := min(max(value, 0), 1) * float64(last)
+		index := min(int(position), last-1)
+		fraction := position - float64(index)
+		return table[index]*(1-fraction) + table[index+1]*fraction
+	}
+}
+
+// parseCurves reads count consecutive curves, each one aligned on 4 bytes.
+func parseCurves(data []byte, count int) ([]curve, error) {
+	curves := make([]curve, count)
+	offset := 0
+	for i := range curves {
+		if offset > len(data) {
+			return nil, errTruncated
+		}
+		parsed, size, err := parseCurve(data[offset:])
+		if err != nil {
+			return nil, err
+		}
+		curves[i] = parsed
+		offset += (size + 3) &^ 3
+	}
+	return curves, nil
+}
+
+// clut is a multidimensional color lookup table, the first input varying the slowest.
+type clut struct {
+	grid    []int
+	outputs int
+	values  []float64
+}
+
+// evaluate interpolates the table at the normalized input, writing the outputs to out.
+func (c *clut) evaluate(in []float64, out []float64) {
+	var base [maxChannels]int
+	var fraction [maxChannels]float64
+	for i, size := range c.grid {
+		position := min(max(in[i], 0), 1) * float64(size-1)
+		base[i] = min(int(position), max(size-2, 0))
+		fraction[i] = position - float64(base[i])
+	}
+
+	for o := range out[:c.outputs] {
+		out[o] = 0
+	}
+	for corner := 0; corner < 1<<len(c.grid); corner++ {
+		weight := 1.0
+		index := 0
+		for i, size := range c.grid {
+			offset := base[i]
+			if corner&(1<<(len(c.grid)-1-i)) != 0 {
+				offset = min(offset+1, size-1)
+				weight *= fraction[i]
+			} else {
+				weight *= 1 - fraction[i]
+			}
+			index = index*size + offset
+		}
+		if weight == 0 {
+			continue
+		}
+		for o := 0; o < c.outputs; o++ {
+			out[o] += weight * c.values[index*c.outputs+o]
+		}
+	}
+}
+
+// maxChannels is the highest number of input channels of a lookup table handled.
+const maxChannels = 8
+
+// lut is a device to PCS transform read from an A2B tag.
+type lut struct {
+	inputs      int
+	inCurves    []curve
+	clut        *clut
+	midCurves   []curve
+	matrix      []float64
+	outCurves   []curve
+	legacyLab16 bool
+}
+
+// apply runs the input through the transform, the outputs being normalized PCS values.
+func (l *lut) apply(in []float64) [3]float64 {
+	var values [maxChannels]float64
+	for i := 0; i < l.inputs; i++ {
+		values[i] = in[i]
+		if l.inCurves != nil {
+			values[i] = l.inCurves[i](values[i])
+		}
+	}
+
+	var result [3]float64
+	if l.clut != nil {
+		l.clut.evaluate(values[:l.inputs], result[:])
+	} else {
+		copy(result[:], values[:3])
+	}
+	if l.midCurves != nil {
+		for i := range result {
+			result[i] = l.midCurves[i](result[i])
+		}
+	}
+	if l.matrix != nil {
+		m := l.matrix
+		x, y, z := result[0], result[1], result[2]
+		result = [3]float64{
+			m[0]*x + m[1]*y + m[2]*z + m[9],
+			m[3]*x + m[4]*y + m[5]*z + m[10],
+			m[6]*x + m[7]*y + m[8]*z + m[11],
+		}
+	}
+	if l.outCurves != nil {
+		for i := range result {
+			result[i] = l.outCurves[i](result[i])
+		}
+	}
+	return result
+}
+
+// parseLut reads a lut8 (mft1), lut16 (mft2) or lutAtoB (mAB) tag converting to the 3 channels of the PCS.
+func parseLut(data []byte) (*lut, error) {
+	if len(data) < 32 {
+		return nil, errTruncated
+	}
+	inputs, outputs := int(data[8]), int(data[9])
+	if inputs == 0 || inputs > maxChannels || outputs != 3 {
+		return nil, fmt.Errorf("unsupported icc lut with %d inputs and %d outputs", inputs, outputs)
+	}
+
+	switch string(data[:4]) {
+	case "mft1", "mft2":
+		grid := int(data[10])
+		sixteenBits := string(data[:4]) == "mft2"
+		inEntries, outEntries, offset, sampleSize := 256, 256, 48, 1
+		if sixteenBits {
+			if len(data) < 52 {
+				return nil, errTruncated
+			}
+			inEntries = int(binary.BigEndian.Uint16(data[48:]))
+			outEntries = int(binary.BigEndian.Uint16(data[50:]))
+			offset, sampleSize = 52, 2
+		}
+		if grid < 2 || inEntries < 2 || outEntries < 2 {
+			return nil, fmt.Errorf("invalid icc lut dimensions")
+		}
+
+		gridSize := 1
+		for i := 0; i < inputs; i++ {
+			gridSize *= grid
+		}
+		needed := offset + sampleSize*(inputs*inEntries+gridSize*outputs+outputs*outEntries)
+		if len(data) < needed {
+			return nil, errTruncated
+		}
+		read := func(count int) []float64 {
+			values := readSamples(data[offset:], count, sampleSize)
+			offset += count * sampleSize
+			return values
+		}
+
+		parsed := &lut{inputs: inputs, legacyLab16: sixteenBits}
+		for i := 0; i < inputs; i++ {
+			parsed.inCurves = append(parsed.inCurves, tableCurve(read(inEntries)))
+		}
+		dims := make([]int, inputs)
+		for i := range dims {
+			dims[i] = grid
+		}
+		parsed.clut = &clut{grid: dims, outputs: outputs, values: read(gridSize * outputs)}
+		for i := 0; i < outputs; i++ {
+			parsed.outCurves = append(parsed.outCurves, tableCurve(read(outEntries)))
+		}
+		return parsed, nil
+	case "mAB ":
+		return parseLutAToB(data, inputs, outputs)
+	}
+	return nil, fmt.Errorf("unsupported icc lut type %q", data[:4])
+}
+
+func parseLutAToB(data []byte, inputs int, outputs int) (*lut, error) {
+	offsetB := int(binary.BigEndian.Uint32(data[12:]))
+	offsetMatrix := int(binary.BigEndian.Uint32(data[16:]))
+	offsetM := int(binary.BigEndian.Uint32(data[20:]))
+	offsetCLUT := int(binary.BigEndian.Uint32(data[24:]))
+	offsetA := int(binary.BigEndian.Uint32(data[28:]))
+	for _, offset := range []int{offsetB, offsetMatrix, offsetM, offsetCLUT, offsetA} {
+		if offset > len(data) {
+			return nil, errTruncated
+		}
+	}
+	if offsetB == 0 {
+		return nil, fmt.Errorf("icc lutAtoB without B curves")
+	}
+
+	parsed := &lut{inputs: inputs}
+	var err error
+	if parsed.outCurves, err = parseCurves(data[offsetB:], outputs); err != nil {
+		return nil, err
+	}
+	if offsetA != 0 {
+		if parsed.inCurves, err = parseCurves(data[offsetA:], inputs); err != nil {
+			return nil, err
+		}
+	}
+	if offsetM != 0 {
+		if parsed.midCurves, err = parseCurves(data[offsetM:], outputs); err != nil {
+			return nil, err
+		}
+	}
+	if offsetMatrix != 0 {
+		if offsetMatrix+48 > len(data) {
+			return nil, errTruncated
+		}
+		parsed.matrix = make([]float64, 12)
+		for i := range parsed.matrix {
+			parsed.matrix[i] = s15Fixed16(data[offsetMatrix+4*i:])
+		}
+	}
+	if offsetCLUT != 0 {
+		if offsetCLUT+20 > len(data) {
+			return nil, errTruncated
+		}
+		dims := make([]int, inputs)
+		gridSize := 1
+		for i := range dims {
+			dims[i] = int(data[offsetCLUT+i])
+			if dims[i] < 2 {
+				return nil, fmt.Errorf("invalid icc clut dimensions")
+			}
+			gridSize *= dims[i]
+		}
+		sampleSize := int(data[offsetCLUT+16])
+		if sampleSize != 1 && sampleSize != 2 {
+			return nil, fmt.Errorf("invalid icc clut precision %d", sampleSize)
+		}
+		if offsetCLUT+20+gridSize*outputs*sampleSize > len(data) {
+			return nil, errTruncated
+		}
+		parsed.clut = &clut{grid: dims, outputs: outputs, values: readSamples(data[offsetCLUT+20:], gridSize*outputs, sampleSize)}
+	} else if inputs != outputs {
+		return nil, fmt.Errorf("icc lutAtoB without clut can't change the number of channels")
+	}
+	return parsed, nil
+}
+
+// readSamples reads count unsigned 8 or 16 bits samples, normalized to 0-1.
+func readSamples(data []byte, count int, sampleSize int) []float64 {
+	values := make([]float64, count)
+	for i := range values {
+		if sampleSize == 2 {
+			values[i] = float64(binary.BigEndian.Uint16(data[2*i:])) / 65535
+		} else {
+			values[i] = float64(data[i]) / 255
+		}
+	}
+	return values
+}
@@ -0,0 +1,112 @@
+// Package icc reads the ICC color profiles embedded in the pages and converts the images they describe to sRGB.
+//
+// Matrix/TRC RGB profiles, gray TRC profiles and the lut8, lut16 and lutAtoB based profiles used for CMYK are
+// supported, with the perceptual intent.
+package icc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// Color spaces of the profiles.
+const (
+	ColorSpaceRGB  = "RGB "
+	ColorSpaceCMYK = "CMYK"
+	ColorSpaceGray = "GRAY"
+)
+
+const (
+	headerSize = 128
+	pcsXYZ     = "XYZ "
+	pcsLab     = "Lab "
+)
+
+var errTruncated = errors.New("truncated icc profile")
+
+// Profile is a parsed ICC profile.
+type Profile struct {
+	// ColorSpace of the images described by the profile, one of the ColorSpace constants for the supported ones.
+	ColorSpace string
+	// PCS is the connection space of the profile, XYZ or Lab.
+	PCS string
+	// Description is the name of the profile, like "sRGB IEC61966-2.1".
+	Description string
+	tags        map[string][]byte
+}
+
+// Parse reads the header and the tag table of the profile.
+func Parse(data []byte) (*Profile, error) {
+	if len(data) < headerSize+4 {
+		return nil, errTruncated
+	}
+	if string(data[36:40]) != "acsp" {
+		return nil, fmt.Errorf("invalid icc profile signature %q", data[36:40])
+	}
+
+	profile := &Profile{
+		ColorSpace: string(data[16:20]),
+		PCS:        string(data[20:24]),
+		tags:       make(map[string][]byte),
+	}
+
+	count := int(binary.BigEndian.Uint32(data[headerSize:]))
+	if len(data) < headerSize+4+count*12 {
+		return nil, errTruncated
+	}
+	for i := 0; i < count; i++ {
+		entry := data[headerSize+4+i*12:]
+		offset := int(binary.BigEndian.Uint32(entry[4:]))
+		size := int(binary.BigEndian.Uint32(entry[8:]))
+		if offset < 0 || size < 0 || offset+size > len(data) || size < 8 {
+			return nil, fmt.Errorf("icc tag %q out of the profile", entry[:4])
+		}
+		profile.tags[string(entry[:4])] = data[offset : offset+size]
+	}
+
+	profile.Description = textTag(profile.tags["desc"])
+	return profile, nil
+}
+
+// IsSRGB tells if the profile is an sRGB profile, whose images need no conversion.
+func (p *Profile) IsSRGB() bool {
+	return p.ColorSpace == ColorSpaceRGB && strings.Contains(strings.ToLower(p.Description), "srgb")
+}
+
+// textTag reads a desc (ICC v2) or mluc (ICC v4) tag, returning the first localized string.
+func textTag(data []byte) string {
+	if len(data) < 12 {
+		return ""
+	}
+	switch string(data[:4]) {
+	case "desc":
+		length := int(binary.BigEndian.Uint32(data[8:]))
+		if 12+length > len(data) {
+			return ""
+		}
+		return strings.TrimRight(string(data[12:12+length]), "\x00")
+	case "mluc":
+		if len(data) < 28 || binary.BigEndian.Uint32(data[8:]) == 0 {
+			return ""
+		}
+		length := int(binary.BigEndian.Uint32(data[20:]))
+		offset := int(binary.BigEndian.Uint32(data[24:]))
+		if offset+length > len(data) {
+			return ""
+		}
+		units := make([]uint16, length/2)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(data[offset+i*2:])
+		}
+		return string(utf16.Decode(units))
+	}
+	return ""
+}
+
+// s15Fixed16 reads a signed 15.16 fixed point number.
+func s15Fixed16(data []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(data))) / 65536
+}
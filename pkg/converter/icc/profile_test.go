@@ -0,0 +1,300 @@
+package icc
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildProfile assembles an ICC profile with the given tags.
+func buildProfile(colorSpace string, pcs string, tags map[string][]byte) []byte {
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		names = append(names, name)
+	}
+
+	data := make([]byte, headerSize+4+12*len(names))
+	copy(data[16:], colorSpace)
+	copy(data[20:], pcs)
+	copy(data[36:], "acsp")
+	binary.BigEndian.PutUint32(data[headerSize:], uint32(len(names)))
+	for i, name := range names {
+		entry := data[headerSize+4+12*i:]
+		copy(entry, name)
+		binary.BigEndian.PutUint32(entry[4:], uint32(len(data)))
+		binary.BigEndian.PutUint32(entry[8:], uint32(len(tags[name])))
+		data = append(data, tags[name]...)
+		for len(data)%4 != 0 {
+			data = append(data, 0)
+		}
+	}
+	binary.BigEndian.PutUint32(data, uint32(len(data)))
+	return data
+}
+
+func fixed(value float64) []byte {
+	return binary.BigEndian.AppendUint32(nil, uint32(int32(math.Round(value*65536))))
+}
+
+func descTag(text string) []byte {
+	data := append([]byte("desc\x00\x00\x00\x00"), binary.BigEndian.AppendUint32(nil, uint32(len(text)+1))...)
+	return append(append(data, text...), 0)
+}
+
+func xyzTag(x, y, z float64) []byte {
+	data := []byte("XYZ \x00\x00\x00\x00")
+	for _, value := range []float64{x, y, z} {
+		data = append(data, fixed(value)...)
+	}
+	return data
+}
+
+func gammaTag(gamma float64) []byte {
+	data := append([]byte("curv\x00\x00\x00\x00"), binary.BigEndian.AppendUint32(nil, 1)...)
+	return binary.BigEndian.AppendUint16(data, uint16(math.Round(gamma*256)))
+}
+
+// srgbCurveTag is the sRGB transfer function as a parametric curve.
+func srgbCurveTag() []byte {
+	data := append([]byte("para\x00\x00\x00\x00"), 0, 3, 0, 0)
+	for _, value := range []float64{2.4, 1 / 1.055, 0.055 / 1.055, 1 / 12.92, 0.04045} {
+		data = append(data, fixed(value)...)
+	}
+	return data
+}
+
+// matrixProfile builds an RGB profile from its D50 adapted colorants.
+func matrixProfile(description string, red, green, blue [3]float64, trc []byte) []byte {
+	return buildProfile(ColorSpaceRGB, pcsXYZ, map[string][]byte{
+		"desc": descTag(description),
+		"rXYZ": xyzTag(red[0], red[1], red[2]),
+		"gXYZ": xyzTag(green[0], green[1], green[2]),
+		"bXYZ": xyzTag(blue[0], blue[1], blue[2]),
+		"rTRC": trc,
+		"gTRC": trc,
+		"bTRC": trc,
+	})
+}
+
+var (
+	srgbRed   = [3]float64{0.4361, 0.2225, 0.0139}
+	srgbGreen = [3]float64{0.3851, 0.7169, 0.0971}
+	srgbBlue  = [3]float64{0.1431, 0.0606, 0.7141}
+)
+
+// cmykProfile builds a lut16 CMYK profile with a Lab PCS, mixing the inks like a simplified press.
+func cmykProfile() []byte {
+	data := []byte("mft2\x00\x00\x00\x00")
+	data = append(data, 4, 3, 2, 0)
+	for i := 0; i < 9; i++ {
+		value := 0.0
+		if i%4 == 0 {
+			value = 1
+		}
+		data = append(data, fixed(value)...)
+	}
+	data = binary.BigEndian.AppendUint16(data, 2)
+	data = binary.BigEndian.AppendUint16(data, 2)
+	for i := 0; i < 4; i++ {
+		data = binary.BigEndian.AppendUint16(data, 0)
+		data = binary.BigEndian.AppendUint16(data, 0xFFFF)
+	}
+	// The Lab of each ink alone, mixed additively in a, b and multiplicatively in L
+	inks := [4][3]float64{{55, -37, -50}, {48, 74, -3}, {89, -5, 93}, {0, 0, 0}}
+	for corner := 0; corner < 16; corner++ {
+		lightness, a, b := 100.0, 0.0, 0.0
+		for ink := 0; ink < 4; ink++ {
+			if corner&(1<<(3-ink)) != 0 {
+				lightness *= inks[ink][0] / 100
+				a += inks[ink][1]
+				b += inks[ink][2]
+			}
+		}
+		for _, value := range []float64{lightness / 100, (a + 128) / 255, (b + 128) / 255} {
+			data = binary.BigEndian.AppendUint16(data, uint16(math.Round(min(max(value, 0), 1)*65280)))
+		}
+	}
+	for i := 0; i < 3; i++ {
+		data = binary.BigEndian.AppendUint16(data, 0)
+		data = binary.BigEndian.AppendUint16(data, 0xFFFF)
+	}
+	return buildProfile(ColorSpaceCMYK, pcsLab, map[string][]byte{"desc": descTag("Test CMYK"), "A2B0": data})
+}
+
+func convertColor(t *testing.T, profile []byte, c color.NRGBA) color.NRGBA {
+	parsed, err := Parse(profile)
+	require.NoError(t, err)
+	img := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	img.SetNRGBA(0, 0, c)
+	converted, err := parsed.ToSRGB(img)
+	require.NoError(t, err)
+	return converted.(*image.NRGBA).NRGBAAt(0, 0)
+}
+
+func assertColor(t *testing.T, expected color.NRGBA, actual color.NRGBA, delta float64) {
+	t.Helper()
+	assert.InDelta(t, expected.R, actual.R, delta, "red of %v", actual)
+	assert.InDelta(t, expected.G, actual.G, delta, "green of %v", actual)
+	assert.InDelta(t, expected.B, actual.B, delta, "blue of %v", actual)
+}
+
+func TestParse(t *testing.T) {
+	profile, err := Parse(matrixProfile("sRGB IEC61966-2.1", srgbRed, srgbGreen, srgbBlue, srgbCurveTag()))
+	require.NoError(t, err)
+	assert.Equal(t, ColorSpaceRGB, profile.ColorSpace)
+	assert.Equal(t, "sRGB IEC61966-2.1", profile.Description)
+	assert.True(t, profile.IsSRGB())
+
+	adobe, err := Parse(matrixProfile("Adobe RGB (1998)", srgbRed, srgbGreen, srgbBlue, gammaTag(2.2)))
+	require.NoError(t, err)
+	assert.False(t, adobe.IsSRGB())
+
+	_, err = Parse([]byte("not a profile"))
+	assert.Error(t, err)
+
+	invalid := matrixProfile("Test", srgbRed, srgbGreen, srgbBlue, gammaTag(2.2))
+	copy(invalid[36:], "nope")
+	_, err = Parse(invalid)
+	assert.Error(t, err)
+
+	truncated := matrixProfile("Test", srgbRed, srgbGreen, srgbBlue, gammaTag(2.2))
+	_, err = Parse(truncated[:len(truncated)-40])
+	assert.Error(t, err)
+}
+
+func TestToSRGB_MatrixProfile(t *testing.T) {
+	// A profile describing sRGB under another name converts the colors to themselves
+	srgbLike := matrixProfile("Display", srgbRed, srgbGreen, srgbBlue, srgbCurveTag())
+	for _, c := range []color.NRGBA{{R: 255, A: 255}, {G: 255, A: 255}, {B: 255, A: 255}, {R: 200, G: 120, B: 40, A: 255}, {R: 128, G: 128, B: 128, A: 128}} {
+		converted := convertColor(t, srgbLike, c)
+		assertColor(t, c, converted, 2)
+		assert.Equal(t, c.A, converted.A, "alpha is kept")
+	}
+
+	// Swapped red and blue colorants swap the channels
+	swapped := matrixProfile("Swapped", srgbBlue, srgbGreen, srgbRed, srgbCurveTag())
+	assertColor(t, color.NRGBA{B: 255}, convertColor(t, swapped, color.NRGBA{R: 255, A: 255}), 2)
+
+	// Adobe RGB colors are more saturated than the same values in sRGB, grays stay gray
+	adobe := matrixProfile("Adobe RGB (1998)", [3]float64{0.6097, 0.3111, 0.0195}, [3]float64{0.2053, 0.6257, 0.0609}, [3]float64{0.1492, 0.0632, 0.7446}, gammaTag(2.2))
+	gray := convertColor(t, adobe, color.NRGBA{R: 128, G: 128, B: 128, A: 255})
+	assertColor(t, color.NRGBA{R: gray.G, G: gray.G, B: gray.G}, gray, 1)
+	green := convertColor(t, adobe, color.NRGBA{R: 100, G: 160, B: 100, A: 255})
+	assert.Less(t, green.R, uint8(100))
+	assert.Greater(t, green.G, green.R+70)
+}
+
+func TestToSRGB_CMYKProfile(t *testing.T) {
+	parsed, err := Parse(cmykProfile())
+	require.NoError(t, err)
+
+	img := image.NewCMYK(image.Rect(0, 0, 4, 1))
+	img.SetCMYK(0, 0, color.CMYK{})
+	img.SetCMYK(1, 0, color.CMYK{K: 255})
+	img.SetCMYK(2, 0, color.CMYK{C: 255})
+	img.SetCMYK(3, 0, color.CMYK{Y: 255})
+
+	converted, err := parsed.ToSRGB(img)
+	require.NoError(t, err)
+	nrgba := converted.(*image.NRGBA)
+
+	assertColor(t, color.NRGBA{R: 255, G: 255, B: 255}, nrgba.NRGBAAt(0, 0), 2)
+	assertColor(t, color.NRGBA{}, nrgba.NRGBAAt(1, 0), 2)
+	cyan := nrgba.NRGBAAt(2, 0)
+	assert.Greater(t, cyan.B, cyan.R+100, "cyan ink is blue green")
+	assert.Greater(t, cyan.G, cyan.R+50, "cyan ink is blue green")
+	yellow := nrgba.NRGBAAt(3, 0)
+	assert.Greater(t, yellow.R, yellow.B+150, "yellow ink is yellow")
+	assert.Greater(t, yellow.G, yellow.B+150, "yellow ink is yellow")
+
+	// The profile doesn't match an RGB image
+	_, err = parsed.ToSRGB(image.NewNRGBA(image.Rect(0, 0, 1, 1)))
+	assert.Error(t, err)
+}
+
+// lutAToBProfile builds an RGB profile equivalent to sRGB as a lutAtoB tag: the A curves linearize the values,
+// a 2x2x2 clut holds the colorants and the B curves are identities.
+func lutAToBProfile() []byte {
+	identityCurve := append([]byte("curv"), make([]byte, 8)...)
+	var curves []byte
+	for i := 0; i < 3; i++ {
+		curves = append(curves, srgbCurveTag()...)
+	}
+	var bCurves []byte
+	for i := 0; i < 3; i++ {
+		bCurves = append(bCurves, identityCurve...)
+	}
+
+	clutData := append([]byte{2, 2, 2}, make([]byte, 13)...)
+	clutData = append(clutData, 2, 0, 0, 0)
+	for corner := 0; corner < 8; corner++ {
+		var xyz [3]float64
+		for i, colorant := range [][3]float64{srgbRed, srgbGreen, srgbBlue} {
+			if corner&(1<<(2-i)) != 0 {
+				for j := range xyz {
+					xyz[j] += colorant[j]
+				}
+			}
+		}
+		for _, value := range xyz {
+			clutData = binary.BigEndian.AppendUint16(clutData, uint16(math.Round(value*32768)))
+		}
+	}
+
+	offsetB := 32
+	offsetCLUT := offsetB + len(bCurves)
+	offsetA := offsetCLUT + len(clutData)
+	data := append([]byte("mAB \x00\x00\x00\x00"), 3, 3, 0, 0)
+	for _, offset := range []int{offsetB, 0, 0, offsetCLUT, offsetA} {
+		data = binary.BigEndian.AppendUint32(data, uint32(offset))
+	}
+	data = append(append(append(data, bCurves...), clutData...), curves...)
+	return buildProfile(ColorSpaceRGB, pcsXYZ, map[string][]byte{"desc": descTag("Display v4"), "A2B0": data})
+}
+
+func TestToSRGB_LutAToBProfile(t *testing.T) {
+	for _, c := range []color.NRGBA{{R: 255, A: 255}, {G: 255, A: 255}, {R: 200, G: 120, B: 40, A: 255}, {R: 255, G: 255, B: 255, A: 255}} {
+		assertColor(t, c, convertColor(t, lutAToBProfile(), c), 3)
+	}
+}
+
+func TestToSRGB_GrayProfile(t *testing.T) {
+	linear := buildProfile(ColorSpaceGray, pcsXYZ, map[string][]byte{"desc": descTag("Linear gray"), "kTRC": gammaTag(1)})
+	parsed, err := Parse(linear)
+	require.NoError(t, err)
+
+	img := image.NewGray(image.Rect(0, 0, 3, 1))
+	img.Pix = []uint8{0, 128, 255}
+	converted, err := parsed.ToSRGB(img)
+	require.NoError(t, err)
+
+	gray, ok := converted.(*image.Gray)
+	require.True(t, ok, "gray images stay gray")
+	assert.InDelta(t, 0, gray.Pix[0], 1)
+	assert.InDelta(t, 188, gray.Pix[1], 1, "linear mid gray is lighter in sRGB")
+	assert.InDelta(t, 255, gray.Pix[2], 1)
+}
+
+func TestParseCurve(t *testing.T) {
+	srgb, _, err := parseCurve(srgbCurveTag())
+	require.NoError(t, err)
+	assert.InDelta(t, 0.2140, srgb(0.5), 0.001)
+	assert.InDelta(t, 0.01/12.92, srgb(0.01), 0.0001)
+
+	table := append([]byte("curv\x00\x00\x00\x00"), binary.BigEndian.AppendUint32(nil, 3)...)
+	for _, value := range []uint16{0, 0x4000, 0xFFFF} {
+		table = binary.BigEndian.AppendUint16(table, value)
+	}
+	interpolated, size, err := parseCurve(table)
+	require.NoError(t, err)
+	assert.Equal(t, 18, size)
+	assert.InDelta(t, 0.125, interpolated(0.25), 0.001)
+
+	_, _, err = parseCurve([]byte("sf32\x00\x00\x00\x00\x00\x00\x00\x00"))
+	assert.Error(t, err)
+}
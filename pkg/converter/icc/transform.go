@@ -0,0 +1,259 @@
+package icc
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// d50 is the white point of the PCS.
+var d50 = [3]float64{0.9642, 1, 0.8249}
+
+// xyzToSRGB converts PCS XYZ (D50) to linear sRGB (D65), the Bradford chromatic adaptation included.
+var xyzToSRGB = [9]float64{
+	3.1338561, -1.6168667, -0.4906146,
+	-0.9787684, 1.9161415, 0.0334540,
+	0.0719453, -0.2289914, 1.4052427,
+}
+
+// gridPoints is the number of samples of each input channel of the precomputed transforms.
+var gridPoints = map[int]int{1: 256, 3: 33, 4: 17}
+
+// ToSRGB converts the image, whose colors are described by the profile, to sRGB.
+// Gray images stay gray, RGB and CMYK images are converted to NRGBA.
+func (p *Profile) ToSRGB(img image.Image) (image.Image, error) {
+	channels := map[string]int{ColorSpaceRGB: 3, ColorSpaceCMYK: 4, ColorSpaceGray: 1}[p.ColorSpace]
+	if channels == 0 {
+		return nil, fmt.Errorf("unsupported icc color space %q", p.ColorSpace)
+	}
+	toPCS, err := p.deviceToXYZ(channels)
+	if err != nil {
+		return nil, err
+	}
+	table := sampleTransform(channels, toPCS)
+
+	bounds := img.Bounds()
+	switch p.ColorSpace {
+	case ColorSpaceGray:
+		gray, ok := img.(*image.Gray)
+		if !ok {
+			return nil, fmt.Errorf("gray icc profile on a %T image", img)
+		}
+		var levels [256]uint8
+		var out [3]float64
+		for level := range levels {
+			table.evaluate([]float64{float64(level) / 255}, out[:])
+			levels[level] = toByte(out[1])
+		}
+		converted := image.NewGray(bounds)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				converted.Pix[converted.PixOffset(x, y)] = levels[gray.Pix[gray.PixOffset(x, y)]]
+			}
+		}
+		return converted, nil
+	case ColorSpaceCMYK:
+		cmyk, ok := img.(*image.CMYK)
+		if !ok {
+			return nil, fmt.Errorf("cmyk icc profile on a %T image", img)
+		}
+		converted := image.NewNRGBA(bounds)
+		in := make([]float64, 4)
+		var out [3]float64
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				pixel := cmyk.Pix[cmyk.PixOffset(x, y):]
+				for i := range in {
+					in[i] = float64(pixel[i]) / 255
+				}
+				table.evaluate(in, out[:])
+				setNRGBA(converted, x, y, out, 255)
+			}
+		}
+		return converted, nil
+	default:
+		if _, ok := img.(*image.CMYK); ok {
+			return nil, fmt.Errorf("rgb icc profile on a cmyk image")
+		}
+		converted := image.NewNRGBA(bounds)
+		in := make([]float64, 3)
+		var out [3]float64
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				r, g, b, a := rgbAt(img, x, y)
+				in[0], in[1], in[2] = float64(r)/255, float64(g)/255, float64(b)/255
+				table.evaluate(in, out[:])
+				setNRGBA(converted, x, y, out, a)
+			}
+		}
+		return converted, nil
+	}
+}
+
+// deviceToXYZ returns the transform from the normalized device values to PCS XYZ, using the perceptual lookup
+// table when there is one, the matrix and curves of the profile otherwise.
+func (p *Profile) deviceToXYZ(channels int) (func([]float64) [3]float64, error) {
+	if data, ok := p.tags["A2B0"]; ok {
+		parsed, err := parseLut(data)
+		if err != nil {
+			return nil, err
+		}
+		if parsed.inputs != channels {
+			return nil, fmt.Errorf("icc lut with %d inputs for %d channels", parsed.inputs, channels)
+		}
+		lab := p.PCS == pcsLab
+		return func(in []float64) [3]float64 {
+			pcs := parsed.apply(in)
+			if lab {
+				return labToXYZ(decodeLab(pcs, parsed.legacyLab16))
+			}
+			// u1Fixed15 encoding, 1.0 being 0x8000
+			for i := range pcs {
+				pcs[i] *= 65535.0 / 32768.0
+			}
+			return pcs
+		}, nil
+	}
+
+	if p.PCS != pcsXYZ {
+		return nil, fmt.Errorf("icc profile without lookup table needs an XYZ PCS")
+	}
+	switch channels {
+	case 1:
+		trc, err := p.curveTag("kTRC")
+		if err != nil {
+			return nil, err
+		}
+		return func(in []float64) [3]float64 {
+			luminance := trc(in[0])
+			return [3]float64{luminance * d50[0], luminance * d50[1], luminance * d50[2]}
+		}, nil
+	case 3:
+		var columns [3][3]float64
+		var trcs [3]curve
+		for i, name := range []string{"r", "g", "b"} {
+			data, ok := p.tags[name+"XYZ"]
+			if !ok || len(data) < 20 {
+				return nil, fmt.Errorf("icc profile without %sXYZ colorant", name)
+			}
+			columns[i] = [3]float64{s15Fixed16(data[8:]), s15Fixed16(data[12:]), s15Fixed16(data[16:])}
+			trc, err := p.curveTag(name + "TRC")
+			if err != nil {
+				return nil, err
+			}
+			trcs[i] = trc
+		}
+		return func(in []float64) [3]float64 {
+			var xyz [3]float64
+			for i := range columns {
+				linear := trcs[i](in[i])
+				for j := range xyz {
+					xyz[j] += columns[i][j] * linear
+				}
+			}
+			return xyz
+		}, nil
+	}
+	return nil, fmt.Errorf("icc profile without lookup table for %d channels", channels)
+}
+
+func (p *Profile) curveTag(name string) (curve, error) {
+	data, ok := p.tags[name]
+	if !ok {
+		return nil, fmt.Errorf("icc profile without %s curve", name)
+	}
+	parsed, _, err := parseCurve(data)
+	return parsed, err
+}
+
+// sampleTransform precomputes the device to sRGB transform on a grid, the outputs being the encoded sRGB
+// values (0-1) interpolated for each pixel.
+func sampleTransform(channels int, toXYZ func([]float64) [3]float64) *clut {
+	points := gridPoints[channels]
+	grid := make([]int, channels)
+	size := 1
+	for i := range grid {
+		grid[i] = points
+		size *= points
+	}
+
+	table := &clut{grid: grid, outputs: 3, values: make([]float64, size*3)}
+	in := make([]float64, channels)
+	for index := 0; index < size; index++ {
+		remainder := index
+		for i := channels - 1; i >= 0; i-- {
+			in[i] = float64(remainder%points) / float64(points-1)
+			remainder /= points
+		}
+		rgb := xyzToEncodedSRGB(toXYZ(in))
+		copy(table.values[index*3:], rgb[:])
+	}
+	return table
+}
+
+// decodeLab converts the normalized PCS values to L*a*b*. lut16 tags use the legacy 16 bits encoding
+// where 0xFF00 is the highest value.
+func decodeLab(pcs [3]float64, legacy16 bool) [3]float64 {
+	scale := 1.0
+	if legacy16 {
+		scale = 65535.0 / 65280.0
+	}
+	return [3]float64{pcs[0] * scale * 100, pcs[1]*scale*255 - 128, pcs[2]*scale*255 - 128}
+}
+
+func labToXYZ(lab [3]float64) [3]float64 {
+	fy := (lab[0] + 16) / 116
+	fx := fy + lab[1]/500
+	fz := fy - lab[2]/200
+	inverse := func(t float64) float64 {
+		if t > 6.0/29 {
+			return t * t * t
+		}
+		return 3 * (6.0 / 29) * (6.0 / 29) * (t - 4.0/29)
+	}
+	return [3]float64{d50[0] * inverse(fx), d50[1] * inverse(fy), d50[2] * inverse(fz)}
+}
+
+func xyzToEncodedSRGB(xyz [3]float64) [3]float64 {
+	m := xyzToSRGB
+	var rgb [3]float64
+	for i := range rgb {
+		linear := m[3*i]*xyz[0] + m[3*i+1]*xyz[1] + m[3*i+2]*xyz[2]
+		linear = min(max(linear, 0), 1)
+		if linear <= 0.0031308 {
+			rgb[i] = 12.92 * linear
+		} else {
+			rgb[i] = 1.055*math.Pow(linear, 1/2.4) - 0.055
+		}
+	}
+	return rgb
+}
+
+// rgbAt returns the non premultiplied color of the pixel.
+func rgbAt(img image.Image, x int, y int) (r, g, b, a uint8) {
+	switch typed := img.(type) {
+	case *image.YCbCr:
+		chroma := typed.COffset(x, y)
+		r, g, b = color.YCbCrToRGB(typed.Y[typed.YOffset(x, y)], typed.Cb[chroma], typed.Cr[chroma])
+		return r, g, b, 255
+	case *image.NRGBA:
+		pixel := typed.Pix[typed.PixOffset(x, y):]
+		return pixel[0], pixel[1], pixel[2], pixel[3]
+	default:
+		pixel := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+		return pixel.R, pixel.G, pixel.B, pixel.A
+	}
+}
+
+func toByte(value float64) uint8 {
+	return uint8(min(max(math.Round(value*255), 0), 255))
+}
+
+func setNRGBA(img *image.NRGBA, x int, y int, rgb [3]float64, alpha uint8) {
+	offset := img.PixOffset(x, y)
+	img.Pix[offset] = toByte(rgb[0])
+	img.Pix[offset+1] = toByte(rgb[1])
+	img.Pix[offset+2] = toByte(rgb[2])
+	img.Pix[offset+3] = alpha
+}
@@ -0,0 +1,222 @@
+package jxl
+
+import (
+	"bytes"
+	"context"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"runtime"
+	"strings"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/constant"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/pipeline"
+	"github.com/rs/zerolog/log"
+	_ "golang.org/x/image/webp"
+)
+
+type Converter struct {
+	maxHeight  int
+	cropHeight int
+	splitMode  options.SplitMode
+	effort     int
+	isPrepared bool
+}
+
+func (converter *Converter) Format() (format constant.ConversionFormat) {
+	return constant.JXL
+}
+
+func New() *Converter {
+	return &Converter{
+		maxHeight:  4000,
+		cropHeight: 2000,
+		effort:     DefaultEffort,
+		isPrepared: false,
+	}
+}
+
+func (converter *Converter) PrepareConverter() error {
+	if converter.isPrepared {
+		return nil
+	}
+	err := PrepareEncoder()
+	if err != nil {
+		return err
+	}
+	converter.isPrepared = true
+	return nil
+}
+
+// ConvertChapter converts the pages of the chapter to JPEG XL.
+//
+// In lossless mode, JPEG pages are recompressed with cjxl so the original JPEG can be reconstructed. Without cjxl
+// they are kept as they are.
+func (converter *Converter) ConvertChapter(ctx context.Context, chapter *manga.Chapter, opts *options.ConvertOptions, progress func(message string, current uint32, total uint32)) (*manga.Chapter, error) {
+	err := opts.Validate()
+	if err != nil {
+		return nil, err
+	}
+	converter = converter.withOptions(opts)
+
+	log.Debug().
+		Str("chapter", chapter.FilePath).
+		Int("pages", len(chapter.Pages)).
+		Uint8("quality", opts.Quality).
+		Bool("lossless", opts.Lossless).
+		Bool("jpeg_recompression", opts.Lossless && CanRecompressJPEG()).
+		Bool("split", opts.Split).
+		Str("split_mode", string(converter.splitMode)).
+		Str("spreads", string(opts.Spreads)).
+		Int("max_height", converter.maxHeight).
+		Int("crop_height", converter.cropHeight).
+		Int("effort", converter.effort).
+		Int("max_goroutines", runtime.NumCPU()).
+		Msg("Starting chapter conversion")
+
+	err = converter.PrepareConverter()
+	if err != nil {
+		log.Error().Str("chapter", chapter.FilePath).Err(err).Msg("Failed to prepare converter")
+		return nil, err
+	}
+
+	return pipeline.Run(ctx, chapter, opts, &pipeline.Stages{
+		Format:              converter.Format(),
+		CheckPageNeedsSplit: converter.checkPageNeedsSplit,
+		CropImage:           converter.cropImage,
+		ConvertPage: func(container *manga.PageContainer) (*manga.PageContainer, error) {
+			return converter.convertPage(container, opts.Quality, opts.Lossless)
+		},
+	}, progress)
+}
+
+// withOptions returns a copy of the converter using the heights, split mode and effort of the options.
+func (converter *Converter) withOptions(opts *options.ConvertOptions) *Converter {
+	configured := *converter
+	configured.maxHeight, configured.cropHeight = opts.Heights(converter.maxHeight, converter.cropHeight)
+	configured.splitMode = opts.SplitMode
+	configured.effort = opts.ScaleEffort(1, 9, converter.effort)
+	return &configured
+}
+
+func (converter *Converter) cropImage(img image.Image) ([]image.Image, error) {
+	return pipeline.SplitImage(img, converter.splitMode, converter.cropHeight, 0)
+}
+
+func (converter *Converter) checkPageNeedsSplit(page *manga.Page, splitRequested bool) (bool, image.Image, string, error) {
+	log.Debug().
+		Uint16("page_index", page.Index).
+		Bool("split_requested", splitRequested).
+		Int("page_size", len(page.Contents.Bytes())).
+		Msg("Analyzing page for splitting")
+
+	img, format, err := pipeline.DecodePage(page)
+	if err != nil {
+		log.Debug().Uint16("page_index", page.Index).Err(err).Msg("Failed to decode page image")
+		return false, nil, format, err
+	}
+
+	height := img.Bounds().Dy()
+	needsSplit := height >= converter.maxHeight && splitRequested
+	log.Debug().
+		Uint16("page_index", page.Index).
+		Int("width", img.Bounds().Dx()).
+		Int("height", height).
+		Str("format", format).
+		Int("max_height", converter.maxHeight).
+		Bool("needs_split", needsSplit).
+		Msg("Page splitting decision made")
+
+	return needsSplit, img, format, nil
+}
+
+func (converter *Converter) convertPage(container *manga.PageContainer, quality uint8, lossless bool) (*manga.PageContainer, error) {
+	log.Debug().
+		Uint16("page_index", container.Page.Index).
+		Str("format", container.Format).
+		Bool("to_be_converted", container.IsToBeConverted).
+		Uint8("quality", quality).
+		Bool("lossless", lossless).
+		Msg("Converting page")
+
+	if strings.EqualFold(container.Format, "jxl") {
+		log.Debug().
+			Uint16("page_index", container.Page.Index).
+			Msg("Page already in JPEG XL format, skipping conversion")
+		container.Page.Extension = ".jxl"
+		return container, nil
+	}
+	if !container.IsToBeConverted {
+		log.Debug().
+			Uint16("page_index", container.Page.Index).
+			Msg("Page marked as not to be converted, skipping")
+		return container, nil
+	}
+
+	// Split or transformed pages don't have contents anymore, only their decoded image. The others are kept as
+	// they are when they can't be recompressed, a JPEG re-encoded from pixels can't be reconstructed.
+	if lossless && container.Format == "jpeg" && container.Page.Contents != nil {
+		if !CanRecompressJPEG() {
+			log.Warn().
+				Uint16("page_index", container.Page.Index).
+				Msg("cjxl not available, keeping the JPEG page as is")
+			return container, nil
+		}
+		var buf bytes.Buffer
+		err := RecompressJPEG(&buf, container.Page.Contents.Bytes(), converter.effort)
+		if err != nil {
+			log.Warn().
+				Uint16("page_index", container.Page.Index).
+				Err(err).
+				Msg("Failed to recompress JPEG page, keeping it as is")
+			return container, nil
+		}
+		log.Debug().
+			Uint16("page_index", container.Page.Index).
+			Int("original_size", container.Page.Contents.Len()).
+			Int("converted_size", buf.Len()).
+			Msg("JPEG page recompressed losslessly")
+		container.SetConverted(&buf, ".jxl")
+		return container, nil
+	}
+
+	log.Debug().
+		Uint16("page_index", container.Page.Index).
+		Uint8("quality", quality).
+		Msg("Encoding page to JPEG XL format")
+
+	converted, err := converter.convert(container.Image, uint(quality), lossless)
+	if err != nil {
+		log.Error().
+			Uint16("page_index", container.Page.Index).
+			Err(err).
+			Msg("Failed to convert page to JPEG XL")
+		return nil, err
+	}
+
+	container.SetConverted(converted, ".jxl")
+
+	log.Debug().
+		Uint16("page_index", container.Page.Index).
+		Int("converted_size", len(converted.Bytes())).
+		Msg("Page conversion completed")
+
+	return container, nil
+}
+
+// convert encodes an image to the JPEG XL format and returns the resulting file as a bytes.Buffer.
+func (converter *Converter) convert(image image.Image, quality uint, lossless bool) (*bytes.Buffer, error) {
+	var buf bytes.Buffer
+	err := EncodeWithOptions(&buf, image, EncodeOptions{
+		Quality:  quality,
+		Lossless: lossless,
+		Effort:   converter.effort,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &buf, nil
+}
@@ -0,0 +1,241 @@
+package jxl
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/constant"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createTestImage(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	// Create a gradient pattern to ensure we have actual image data
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{
+				R: uint8((x * 255) / width),
+				G: uint8((y * 255) / height),
+				B: 100,
+				A: 255,
+			})
+		}
+	}
+	return img
+}
+
+func createTestPage(t *testing.T, index int, width, height int, format string) *manga.Page {
+	img := createTestImage(width, height)
+	buf := new(bytes.Buffer)
+	ext := ".png"
+	switch format {
+	case "jpeg":
+		require.NoError(t, jpeg.Encode(buf, img, &jpeg.Options{Quality: 85}))
+		ext = ".jpg"
+	case "jxl":
+		require.NoError(t, Encode(buf, img, 80, false))
+		ext = ".jxl"
+	default:
+		require.NoError(t, png.Encode(buf, img))
+	}
+
+	return &manga.Page{
+		Index:     uint16(index),
+		Contents:  buf,
+		Extension: ext,
+		Size:      uint64(buf.Len()),
+	}
+}
+
+func validateConvertedImage(t *testing.T, page *manga.Page) image.Image {
+	require.NotNil(t, page.Contents)
+	require.Greater(t, page.Contents.Len(), 0)
+
+	img, format, err := image.Decode(bytes.NewReader(page.Contents.Bytes()))
+	require.NoError(t, err, "Failed to decode converted image")
+	assert.Equal(t, "jxl", format, "Expected JPEG XL format")
+	assert.Greater(t, img.Bounds().Dx(), 0, "Image width should be positive")
+	assert.Greater(t, img.Bounds().Dy(), 0, "Image height should be positive")
+	return img
+}
+
+func TestConverter_ConvertChapter(t *testing.T) {
+	tests := []struct {
+		name        string
+		pages       []*manga.Page
+		split       bool
+		lossless    bool
+		numExpected int
+	}{
+		{
+			name: "Lossy conversion",
+			pages: []*manga.Page{
+				createTestPage(t, 1, 400, 600, "png"),
+				createTestPage(t, 2, 400, 600, "jpeg"),
+			},
+			numExpected: 2,
+		},
+		{
+			name: "Lossless conversion",
+			pages: []*manga.Page{
+				createTestPage(t, 1, 200, 300, "png"),
+				createTestPage(t, 2, 200, 300, "jpeg"),
+			},
+			lossless:    true,
+			numExpected: 2,
+		},
+		{
+			name:        "Tall image with split enabled",
+			pages:       []*manga.Page{createTestPage(t, 1, 100, 5000, "jpeg")},
+			split:       true,
+			lossless:    true,
+			numExpected: 3, // Based on cropHeight of 2000
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			converter := New()
+			require.NoError(t, converter.PrepareConverter())
+
+			var progressMutex sync.Mutex
+			var lastProgress uint32
+			progress := func(message string, current uint32, total uint32) {
+				progressMutex.Lock()
+				defer progressMutex.Unlock()
+				assert.GreaterOrEqual(t, current, lastProgress, "Progress should never decrease")
+				lastProgress = current
+				assert.LessOrEqual(t, current, total, "Current progress should not exceed total")
+			}
+
+			convertedChapter, err := converter.ConvertChapter(context.Background(), &manga.Chapter{Pages: tt.pages}, &options.ConvertOptions{Quality: 80, Lossless: tt.lossless, Split: tt.split}, progress)
+			require.NoError(t, err)
+			require.NotNil(t, convertedChapter)
+			assert.Len(t, convertedChapter.Pages, tt.numExpected)
+
+			for _, page := range convertedChapter.Pages {
+				if page.Extension == ".jpg" {
+					// Whole JPEG pages are kept as they are in lossless mode without cjxl
+					assert.True(t, tt.lossless && !CanRecompressJPEG(), "JPEG page %d not converted", page.Index)
+					continue
+				}
+				assert.Equal(t, ".jxl", page.Extension)
+				validateConvertedImage(t, page)
+			}
+		})
+	}
+}
+
+func TestConverter_convertPage(t *testing.T) {
+	converter := New()
+	require.NoError(t, converter.PrepareConverter())
+
+	tests := []struct {
+		name            string
+		format          string
+		isToBeConverted bool
+		expectJXL       bool
+	}{
+		{
+			name:            "Convert PNG to JPEG XL",
+			format:          "png",
+			isToBeConverted: true,
+			expectJXL:       true,
+		},
+		{
+			name:            "Already JPEG XL",
+			format:          "jxl",
+			isToBeConverted: true,
+			expectJXL:       true,
+		},
+		{
+			name:            "Skip conversion",
+			format:          "png",
+			isToBeConverted: false,
+			expectJXL:       false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := createTestPage(t, 1, 100, 100, tt.format)
+			container := manga.NewContainer(page, createTestImage(100, 100), tt.format, tt.isToBeConverted)
+
+			converted, err := converter.convertPage(container, 80, false)
+			require.NoError(t, err)
+
+			if tt.expectJXL {
+				assert.Equal(t, ".jxl", converted.Page.Extension)
+				validateConvertedImage(t, converted.Page)
+			} else {
+				assert.NotEqual(t, ".jxl", converted.Page.Extension)
+			}
+		})
+	}
+}
+
+func TestConverter_convertPage_LosslessWithoutCjxl(t *testing.T) {
+	converter := New()
+	require.NoError(t, converter.PrepareConverter())
+
+	previous := cjxlPath
+	cjxlPath = ""
+	defer func() { cjxlPath = previous }()
+
+	page := createTestPage(t, 1, 64, 64, "jpeg")
+	img, _, err := image.Decode(bytes.NewReader(page.Contents.Bytes()))
+	require.NoError(t, err)
+
+	original := bytes.Clone(page.Contents.Bytes())
+
+	converted, err := converter.convertPage(manga.NewContainer(page, img, "jpeg", true), 80, true)
+	require.NoError(t, err)
+
+	// A JPEG re-encoded from pixels couldn't be reconstructed, the original is kept
+	assert.False(t, converted.HasBeenConverted)
+	assert.Equal(t, ".jpg", converted.Page.Extension)
+	assert.Equal(t, original, converted.Page.Contents.Bytes())
+}
+
+func TestRecompressJPEG(t *testing.T) {
+	require.NoError(t, PrepareEncoder())
+	if !CanRecompressJPEG() {
+		t.Skip("cjxl is not installed")
+	}
+
+	page := createTestPage(t, 1, 300, 400, "jpeg")
+	var buf bytes.Buffer
+	require.NoError(t, RecompressJPEG(&buf, page.Contents.Bytes(), DefaultEffort))
+	assert.Less(t, buf.Len(), page.Contents.Len(), "recompressed page should be smaller")
+
+	djxl, err := exec.LookPath("djxl")
+	if err != nil {
+		t.Skip("djxl is not installed, can't check the JPEG reconstruction")
+	}
+	dir := t.TempDir()
+	input := filepath.Join(dir, "page.jxl")
+	output := filepath.Join(dir, "page.jpg")
+	require.NoError(t, os.WriteFile(input, buf.Bytes(), 0o600))
+	require.NoError(t, exec.Command(djxl, input, output).Run())
+
+	reconstructed, err := os.ReadFile(output)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(page.Contents.Bytes(), reconstructed), "reconstructed JPEG should be identical to the original")
+}
+
+func TestConverter_Format(t *testing.T) {
+	assert.Equal(t, constant.JXL, New().Format())
+}
@@ -0,0 +1,101 @@
+package jxl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/utils/errs"
+	libjxl "github.com/gen2brain/jpegxl"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultEffort is the encoding effort used when none is given, 1 being the fastest and 10 the slowest.
+const DefaultEffort = 7
+
+// cjxlPath is the cjxl binary used to recompress JPEG pages, empty when it isn't installed.
+var cjxlPath string
+
+// PrepareEncoder loads libjxl and looks for the cjxl binary needed by RecompressJPEG.
+func PrepareEncoder() error {
+	libjxl.InitEncoder()
+
+	path, err := exec.LookPath("cjxl")
+	if err != nil {
+		log.Warn().Err(err).Msg("cjxl not found in PATH, JPEG pages will be kept as they are in lossless mode")
+		cjxlPath = ""
+		return nil
+	}
+	log.Debug().Str("cjxl", path).Msg("Found cjxl for lossless JPEG recompression")
+	cjxlPath = path
+	return nil
+}
+
+// CanRecompressJPEG tells if RecompressJPEG can be used.
+func CanRecompressJPEG() bool {
+	return cjxlPath != ""
+}
+
+// EncodeOptions holds the encoder settings.
+type EncodeOptions struct {
+	Quality  uint
+	Lossless bool
+	// Effort trades encoding time for size, 1 being the fastest and 10 the slowest.
+	Effort int
+}
+
+func Encode(w io.Writer, m image.Image, quality uint, lossless bool) error {
+	return EncodeWithOptions(w, m, EncodeOptions{
+		Quality:  quality,
+		Lossless: lossless,
+		Effort:   DefaultEffort,
+	})
+}
+
+func EncodeWithOptions(w io.Writer, m image.Image, options EncodeOptions) error {
+	return libjxl.Encode(w, m, libjxl.Options{
+		Quality:  int(options.Quality),
+		Effort:   options.Effort,
+		Lossless: options.Lossless,
+	})
+}
+
+// RecompressJPEG transcodes JPEG data to JPEG XL without decoding it to pixels.
+// The JPEG reconstruction data is kept, so `djxl` can restore the original file bit for bit.
+func RecompressJPEG(w io.Writer, jpegData []byte, effort int) (err error) {
+	if cjxlPath == "" {
+		return errors.New("cjxl is not available")
+	}
+
+	dir, err := os.MkdirTemp("", "cbzoptimizer-jxl-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer errs.CaptureGeneric(&err, os.RemoveAll, dir, "failed to remove temporary directory")
+
+	input := filepath.Join(dir, "page.jpg")
+	output := filepath.Join(dir, "page.jxl")
+	if err = os.WriteFile(input, jpegData, 0o600); err != nil {
+		return fmt.Errorf("failed to write JPEG page: %w", err)
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(cjxlPath, input, output, "--lossless_jpeg=1", "-e", strconv.Itoa(effort))
+	cmd.Stderr = &stderr
+	if err = cmd.Run(); err != nil {
+		return fmt.Errorf("cjxl failed: %w. %s", err, stderr.String())
+	}
+
+	converted, err := os.ReadFile(output)
+	if err != nil {
+		return fmt.Errorf("failed to read recompressed page: %w", err)
+	}
+	_, err = w.Write(converted)
+	return err
+}
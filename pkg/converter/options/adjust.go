@@ -0,0 +1,62 @@
+package options
+
+import "fmt"
+
+const (
+	// DefaultClipPercent is the share of the darkest and brightest pixels clipped by the auto levels when
+	// Adjust.BlackPoint or Adjust.WhitePoint is unset.
+	DefaultClipPercent = 1.0
+	// MaxClipPercent is the highest value of Adjust.BlackPoint and Adjust.WhitePoint.
+	MaxClipPercent = 20.0
+	// MaxSharpen is the highest value of Adjust.Sharpen.
+	MaxSharpen = 2.0
+)
+
+// Adjust corrects the tones of the scans before encoding them.
+type Adjust struct {
+	// AutoLevels stretches the tones so that the BlackPoint darkest pixels become black and the WhitePoint
+	// brightest become white, fixing faded blacks and grey paper.
+	AutoLevels bool `mapstructure:"auto-levels"`
+	// BlackPoint is the percentage of the darkest pixels clipped to black, 0 uses DefaultClipPercent.
+	BlackPoint float64 `mapstructure:"black-point"`
+	// WhitePoint is the percentage of the brightest pixels clipped to white, 0 uses DefaultClipPercent.
+	WhitePoint float64 `mapstructure:"white-point"`
+	// Gamma applied to the midtones after the levels, below 1 darkens them. 0 and 1 leave them alone.
+	Gamma float64 `mapstructure:"gamma"`
+	// Sharpen is the strength of the unsharp mask, from 0 (disabled) to MaxSharpen. 0.5 is a mild sharpening.
+	Sharpen float64 `mapstructure:"sharpen"`
+}
+
+// Enabled tells if any adjustment is requested.
+func (a Adjust) Enabled() bool {
+	return a.AutoLevels || (a.Gamma != 0 && a.Gamma != 1) || a.Sharpen > 0
+}
+
+// Validate checks the adjustment values.
+func (a Adjust) Validate() error {
+	if a.BlackPoint < 0 || a.BlackPoint > MaxClipPercent {
+		return fmt.Errorf("invalid black point %g, it must be between 0 and %g", a.BlackPoint, MaxClipPercent)
+	}
+	if a.WhitePoint < 0 || a.WhitePoint > MaxClipPercent {
+		return fmt.Errorf("invalid white point %g, it must be between 0 and %g", a.WhitePoint, MaxClipPercent)
+	}
+	if a.Gamma != 0 && (a.Gamma < 0.1 || a.Gamma > 10) {
+		return fmt.Errorf("invalid gamma %g, it must be between 0.1 and 10", a.Gamma)
+	}
+	if a.Sharpen < 0 || a.Sharpen > MaxSharpen {
+		return fmt.Errorf("invalid sharpen strength %g, it must be between 0 and %g", a.Sharpen, MaxSharpen)
+	}
+	return nil
+}
+
+// ClipPercents returns BlackPoint and WhitePoint, using DefaultClipPercent for the unset ones.
+func (a Adjust) ClipPercents() (black float64, white float64) {
+	black, white = a.BlackPoint, a.WhitePoint
+	if black == 0 {
+		black = DefaultClipPercent
+	}
+	if white == 0 {
+		white = DefaultClipPercent
+	}
+	return black, white
+}
@@ -0,0 +1,239 @@
+package options
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Version of the ConvertOptions layout understood by the converters of this module.
+//
+// New fields are added so that their zero value keeps the previous behaviour, the version is only
+// bumped when the meaning of an existing field changes.
+const Version = 1
+
+// MaxEffort is the highest value of ConvertOptions.Effort.
+const MaxEffort = 10
+
+// DefaultGrayscaleTolerance is the chroma tolerance used when ConvertOptions.GrayscaleTolerance is unset,
+// high enough to absorb the JPEG artifacts of black and white scans.
+const DefaultGrayscaleTolerance = 16
+
+// SplitMode tells how the split pages are cut.
+type SplitMode string
+
+const (
+	// SplitFixed cuts every CropHeight pixels.
+	SplitFixed SplitMode = "fixed"
+	// SplitSmart moves each cut to the nearest gutter, a horizontal band of near uniform color, to avoid slicing
+	// through speech bubbles and faces.
+	SplitSmart SplitMode = "smart"
+)
+
+// SplitModes are the accepted values of ConvertOptions.SplitMode.
+var SplitModes = []SplitMode{SplitFixed, SplitSmart}
+
+// SpreadMode tells what is done with the double page spreads, the pages wider than tall.
+type SpreadMode string
+
+const (
+	// SpreadKeep converts the spreads like any other page.
+	SpreadKeep SpreadMode = "keep"
+	// SpreadSplitRTL splits the spreads in two pages, the right half first as in manga.
+	SpreadSplitRTL SpreadMode = "split-rtl"
+	// SpreadSplitLTR splits the spreads in two pages, the left half first.
+	SpreadSplitLTR SpreadMode = "split-ltr"
+	// SpreadRotate rotates the spreads by 90° clockwise, to fill a portrait screen.
+	SpreadRotate SpreadMode = "rotate"
+	// SpreadMark keeps the spreads and sets DoublePage="true" on them in the ComicInfo.
+	SpreadMark SpreadMode = "mark"
+)
+
+// SpreadModes are the accepted values of ConvertOptions.Spreads.
+var SpreadModes = []SpreadMode{SpreadKeep, SpreadSplitRTL, SpreadSplitLTR, SpreadRotate, SpreadMark}
+
+// AnimationMode tells what is done with the animated pages, GIF, WebP or PNG with more than one frame.
+type AnimationMode string
+
+const (
+	// AnimationKeep keeps the animated pages as they are.
+	AnimationKeep AnimationMode = "keep"
+	// AnimationConvert encodes the animated pages to an animation of the target format when it supports them,
+	// keeping them as they are otherwise.
+	AnimationConvert AnimationMode = "convert"
+)
+
+// AnimationModes are the accepted values of ConvertOptions.Animations.
+var AnimationModes = []AnimationMode{AnimationKeep, AnimationConvert}
+
+// WebPPresets are the presets accepted by WebPTuning, as named by cwebp.
+var WebPPresets = []string{"default", "picture", "photo", "drawing", "icon", "text"}
+
+// WebPTuning holds the libwebp settings not every WebP encoder backend supports, see webp.PrepareTuning.
+type WebPTuning struct {
+	// Preset tunes the encoder for a kind of image, one of WebPPresets. Empty means no preset.
+	Preset string
+	// SharpYUV uses the slower but sharper RGB to YUV conversion.
+	SharpYUV bool
+	// AutoFilter picks the deblocking filter strength automatically.
+	AutoFilter bool
+	// NearLossless enables the near lossless encoding, from 0 (strongest preprocessing) to 100 (none) like cwebp.
+	// Nil disables it. It always produces a lossless WebP, whatever the quality.
+	NearLossless *int
+}
+
+// IsZero tells if no tuning is requested.
+func (t WebPTuning) IsZero() bool {
+	return t == WebPTuning{}
+}
+
+// Validate checks the tuning values.
+func (t WebPTuning) Validate() error {
+	if t.Preset != "" && !slices.Contains(WebPPresets, t.Preset) {
+		return fmt.Errorf("invalid webp preset \"%s\", available options are %s", t.Preset, strings.Join(WebPPresets, ", "))
+	}
+	if t.NearLossless != nil && (*t.NearLossless < 0 || *t.NearLossless > 100) {
+		return fmt.Errorf("invalid webp near lossless level %d, it must be between 0 and 100", *t.NearLossless)
+	}
+	return nil
+}
+
+// ConvertOptions tells a converter how to convert a chapter.
+// Zero values pick the converter defaults, so only the relevant fields need to be set.
+type ConvertOptions struct {
+	// Version of the layout the options were built for, 0 means the current Version.
+	Version int
+	// Quality of the lossy conversion (0-100).
+	Quality uint8
+	// Lossless conversion, Quality is ignored.
+	Lossless bool
+	// Split pages taller than MaxHeight into parts of CropHeight.
+	Split bool
+	// MaxHeight is the height from which a page is split, 0 uses the converter default.
+	MaxHeight int
+	// CropHeight is the height of the parts of a split page, 0 uses the converter default.
+	CropHeight int
+	// SplitMode tells how split pages are cut, empty means SplitFixed.
+	SplitMode SplitMode
+	// Stitch consecutive pages of the same width into a strip, re-cut at gutters into pages of about CropHeight.
+	// Meant for webtoons delivered as arbitrary slices, only used by the WebP converter. Split is ignored.
+	Stitch bool
+	// Spreads tells what is done with the double page spreads, empty means SpreadKeep.
+	Spreads SpreadMode
+	// Animations tells what is done with the animated pages, empty means AnimationKeep. Their frames are encoded
+	// as they are, without being split, trimmed, resized or adjusted. Animated pages are kept when stitching.
+	Animations AnimationMode
+	// Trim crops the uniform scanner borders of the pages before they are split or encoded. Ignored when stitching.
+	Trim Trim
+	// Resize scales the pages down to a device resolution before encoding them.
+	Resize Resize
+	// Adjust corrects the tones of the pages before encoding them.
+	Adjust Adjust
+	// Grayscale converts the pages without color to image.Gray before encoding them, color pages are left alone.
+	Grayscale bool
+	// GrayscaleTolerance is the highest chroma, the difference between the highest and lowest RGB channel (0-255),
+	// of a grayscale pixel. 0 uses DefaultGrayscaleTolerance.
+	GrayscaleTolerance int
+	// GrayLevels quantizes the grayscale pages to that many evenly spaced gray levels (2-256), 0 keeps them as is.
+	// The grayscale pages are detected as with Grayscale, which it implies. Best paired with a lossless encoding.
+	GrayLevels int
+	// Dither the quantized pages with Floyd-Steinberg error diffusion, smoothing the gradients.
+	Dither bool
+	// Effort trades encoding time for size, from 1 (fastest) to MaxEffort (smallest), 0 uses the encoder default.
+	// Each converter maps it to its own scale: WebP method, AVIF speed or JPEG XL effort.
+	Effort int
+	// WebP tuning, only used by the WebP converter.
+	WebP WebPTuning
+}
+
+// Validate checks that the options can be used by the converters of this module.
+func (o *ConvertOptions) Validate() error {
+	if o.Version < 0 || o.Version > Version {
+		return fmt.Errorf("unsupported convert options version %d, the highest supported is %d", o.Version, Version)
+	}
+	if o.Quality > 100 {
+		return fmt.Errorf("invalid quality %d, it must be between 0 and 100", o.Quality)
+	}
+	if o.MaxHeight < 0 {
+		return fmt.Errorf("invalid max height %d, it can't be negative", o.MaxHeight)
+	}
+	if o.CropHeight < 0 {
+		return fmt.Errorf("invalid crop height %d, it can't be negative", o.CropHeight)
+	}
+	if o.MaxHeight > 0 && o.CropHeight > o.MaxHeight {
+		return fmt.Errorf("crop height %d can't be greater than max height %d", o.CropHeight, o.MaxHeight)
+	}
+	if o.SplitMode != "" && !slices.Contains(SplitModes, o.SplitMode) {
+		return fmt.Errorf("invalid split mode \"%s\", available options are %s", o.SplitMode, joinModes(SplitModes))
+	}
+	if o.Spreads != "" && !slices.Contains(SpreadModes, o.Spreads) {
+		return fmt.Errorf("invalid spreads mode \"%s\", available options are %s", o.Spreads, joinModes(SpreadModes))
+	}
+	if o.Animations != "" && !slices.Contains(AnimationModes, o.Animations) {
+		return fmt.Errorf("invalid animations mode \"%s\", available options are %s", o.Animations, joinModes(AnimationModes))
+	}
+	if err := o.Trim.Validate(); err != nil {
+		return err
+	}
+	if err := o.Resize.Validate(); err != nil {
+		return err
+	}
+	if err := o.Adjust.Validate(); err != nil {
+		return err
+	}
+	if o.GrayscaleTolerance < 0 || o.GrayscaleTolerance > 255 {
+		return fmt.Errorf("invalid grayscale tolerance %d, it must be between 0 and 255", o.GrayscaleTolerance)
+	}
+	if o.GrayLevels != 0 && (o.GrayLevels < 2 || o.GrayLevels > 256) {
+		return fmt.Errorf("invalid gray levels %d, it must be between 2 and 256", o.GrayLevels)
+	}
+	if o.Effort < 0 || o.Effort > MaxEffort {
+		return fmt.Errorf("invalid effort %d, it must be between 0 and %d", o.Effort, MaxEffort)
+	}
+	return o.WebP.Validate()
+}
+
+func joinModes[T ~string](modes []T) string {
+	names := make([]string, len(modes))
+	for i, mode := range modes {
+		names[i] = string(mode)
+	}
+	return strings.Join(names, ", ")
+}
+
+// GrayscaleChromaTolerance returns GrayscaleTolerance, or DefaultGrayscaleTolerance when it is unset.
+func (o *ConvertOptions) GrayscaleChromaTolerance() int {
+	if o.GrayscaleTolerance == 0 {
+		return DefaultGrayscaleTolerance
+	}
+	return o.GrayscaleTolerance
+}
+
+// Heights returns MaxHeight and CropHeight, using the given defaults for the unset ones.
+func (o *ConvertOptions) Heights(defaultMaxHeight, defaultCropHeight int) (maxHeight int, cropHeight int) {
+	maxHeight, cropHeight = defaultMaxHeight, defaultCropHeight
+	if o.MaxHeight > 0 {
+		maxHeight = o.MaxHeight
+	}
+	if o.CropHeight > 0 {
+		cropHeight = o.CropHeight
+	}
+	if cropHeight > maxHeight {
+		cropHeight = maxHeight
+	}
+	return maxHeight, cropHeight
+}
+
+// ScaleEffort maps Effort onto an encoder scale going from fastest to smallest, returning def when Effort is unset.
+func (o *ConvertOptions) ScaleEffort(fastest, smallest, def int) int {
+	return ScaleEffort(o.Effort, fastest, smallest, def)
+}
+
+// ScaleEffort maps an effort (1 to MaxEffort) onto an encoder scale going from fastest to smallest,
+// returning def when the effort is unset.
+func ScaleEffort(effort, fastest, smallest, def int) int {
+	if effort <= 0 {
+		return def
+	}
+	return fastest + (smallest-fastest)*(effort-1)/(MaxEffort-1)
+}
@@ -0,0 +1,120 @@
+package options
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvertOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		options     ConvertOptions
+		expectError bool
+	}{
+		{name: "Zero value", options: ConvertOptions{}},
+		{name: "Current version", options: ConvertOptions{Version: Version, Quality: 85, Split: true, MaxHeight: 4000, CropHeight: 2000, Effort: 5}},
+		{name: "Future version", options: ConvertOptions{Version: Version + 1}, expectError: true},
+		{name: "Quality above 100", options: ConvertOptions{Quality: 101}, expectError: true},
+		{name: "Negative max height", options: ConvertOptions{MaxHeight: -1}, expectError: true},
+		{name: "Negative crop height", options: ConvertOptions{CropHeight: -1}, expectError: true},
+		{name: "Crop taller than max", options: ConvertOptions{MaxHeight: 1000, CropHeight: 2000}, expectError: true},
+		{name: "Effort too high", options: ConvertOptions{Effort: MaxEffort + 1}, expectError: true},
+		{name: "Smart split", options: ConvertOptions{Split: true, SplitMode: SplitSmart}},
+		{name: "Unknown split mode", options: ConvertOptions{Split: true, SplitMode: "diagonal"}, expectError: true},
+		{name: "Split spreads", options: ConvertOptions{Spreads: SpreadSplitRTL}},
+		{name: "Unknown spreads mode", options: ConvertOptions{Spreads: "fold"}, expectError: true},
+		{name: "Convert animations", options: ConvertOptions{Animations: AnimationConvert}},
+		{name: "Unknown animations mode", options: ConvertOptions{Animations: "first-frame"}, expectError: true},
+		{name: "Resize", options: ConvertOptions{Resize: Resize{Width: 1264, Height: 1680, Mode: ResizeFill, Filter: FilterCatmullRom}}},
+		{name: "Resize width only", options: ConvertOptions{Resize: Resize{Width: 1264}}},
+		{name: "Negative resize width", options: ConvertOptions{Resize: Resize{Width: -1}}, expectError: true},
+		{name: "Unknown resize mode", options: ConvertOptions{Resize: Resize{Width: 100, Mode: "stretch"}}, expectError: true},
+		{name: "Unknown resize filter", options: ConvertOptions{Resize: Resize{Width: 100, Filter: "box"}}, expectError: true},
+		{name: "Fill without height", options: ConvertOptions{Resize: Resize{Width: 100, Mode: ResizeFill}}, expectError: true},
+		{name: "Trim", options: ConvertOptions{Trim: Trim{Enabled: true, Tolerance: 30, MaxPercent: 15}}},
+		{name: "Negative trim tolerance", options: ConvertOptions{Trim: Trim{Enabled: true, Tolerance: -1}}, expectError: true},
+		{name: "Trim max percent too high", options: ConvertOptions{Trim: Trim{Enabled: true, MaxPercent: MaxTrimPercent + 1}}, expectError: true},
+		{name: "Adjust", options: ConvertOptions{Adjust: Adjust{AutoLevels: true, BlackPoint: 2, WhitePoint: 0.5, Gamma: 0.8, Sharpen: 0.5}}},
+		{name: "Black point too high", options: ConvertOptions{Adjust: Adjust{AutoLevels: true, BlackPoint: MaxClipPercent + 1}}, expectError: true},
+		{name: "Negative white point", options: ConvertOptions{Adjust: Adjust{AutoLevels: true, WhitePoint: -1}}, expectError: true},
+		{name: "Gamma too low", options: ConvertOptions{Adjust: Adjust{Gamma: 0.01}}, expectError: true},
+		{name: "Sharpen too strong", options: ConvertOptions{Adjust: Adjust{Sharpen: MaxSharpen + 1}}, expectError: true},
+		{name: "Grayscale", options: ConvertOptions{Grayscale: true, GrayscaleTolerance: 30}},
+		{name: "Grayscale tolerance above 255", options: ConvertOptions{Grayscale: true, GrayscaleTolerance: 256}, expectError: true},
+		{name: "Gray levels", options: ConvertOptions{GrayLevels: 16, Dither: true}},
+		{name: "Single gray level", options: ConvertOptions{GrayLevels: 1}, expectError: true},
+		{name: "Too many gray levels", options: ConvertOptions{GrayLevels: 257}, expectError: true},
+		{name: "WebP tuning", options: ConvertOptions{WebP: WebPTuning{Preset: "drawing", SharpYUV: true, AutoFilter: true, NearLossless: nearLossless(60)}}},
+		{name: "Unknown WebP preset", options: ConvertOptions{WebP: WebPTuning{Preset: "manga"}}, expectError: true},
+		{name: "Strongest WebP near lossless", options: ConvertOptions{WebP: WebPTuning{NearLossless: nearLossless(0)}}},
+		{name: "WebP near lossless above 100", options: ConvertOptions{WebP: WebPTuning{NearLossless: nearLossless(101)}}, expectError: true},
+		{name: "Negative WebP near lossless", options: ConvertOptions{WebP: WebPTuning{NearLossless: nearLossless(-1)}}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.options.Validate()
+			if tt.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestConvertOptions_Heights(t *testing.T) {
+	maxHeight, cropHeight := (&ConvertOptions{}).Heights(4000, 2000)
+	assert.Equal(t, 4000, maxHeight)
+	assert.Equal(t, 2000, cropHeight)
+
+	maxHeight, cropHeight = (&ConvertOptions{MaxHeight: 3000, CropHeight: 1500}).Heights(4000, 2000)
+	assert.Equal(t, 3000, maxHeight)
+	assert.Equal(t, 1500, cropHeight)
+
+	// The default crop height never exceeds a lower max height
+	maxHeight, cropHeight = (&ConvertOptions{MaxHeight: 1000}).Heights(4000, 2000)
+	assert.Equal(t, 1000, maxHeight)
+	assert.Equal(t, 1000, cropHeight)
+}
+
+func TestConvertOptions_GrayscaleChromaTolerance(t *testing.T) {
+	assert.Equal(t, DefaultGrayscaleTolerance, (&ConvertOptions{}).GrayscaleChromaTolerance())
+	assert.Equal(t, 4, (&ConvertOptions{GrayscaleTolerance: 4}).GrayscaleChromaTolerance())
+}
+
+func TestTrim_Defaults(t *testing.T) {
+	assert.Equal(t, DefaultTrimTolerance, Trim{}.BorderTolerance())
+	assert.Equal(t, DefaultTrimMaxPercent, Trim{}.MaxSidePercent())
+	assert.Equal(t, 8, Trim{Tolerance: 8}.BorderTolerance())
+	assert.Equal(t, 20, Trim{MaxPercent: 20}.MaxSidePercent())
+}
+
+func TestAdjust_Enabled(t *testing.T) {
+	assert.False(t, Adjust{}.Enabled())
+	assert.False(t, Adjust{Gamma: 1, BlackPoint: 5}.Enabled(), "clip points alone don't adjust anything")
+	assert.True(t, Adjust{AutoLevels: true}.Enabled())
+	assert.True(t, Adjust{Gamma: 0.8}.Enabled())
+	assert.True(t, Adjust{Sharpen: 0.5}.Enabled())
+
+	black, white := Adjust{WhitePoint: 3}.ClipPercents()
+	assert.Equal(t, DefaultClipPercent, black)
+	assert.Equal(t, 3.0, white)
+}
+
+func TestScaleEffort(t *testing.T) {
+	assert.Equal(t, 4, ScaleEffort(0, 0, 6, 4), "unset effort uses the default")
+	assert.Equal(t, 0, ScaleEffort(1, 0, 6, 4))
+	assert.Equal(t, 6, ScaleEffort(MaxEffort, 0, 6, 4))
+
+	// Scales where the fastest value is the highest one, like AVIF speed
+	assert.Equal(t, 10, ScaleEffort(1, 10, 0, 8))
+	assert.Equal(t, 0, ScaleEffort(MaxEffort, 10, 0, 8))
+	assert.Equal(t, 3, (&ConvertOptions{Effort: 6}).ScaleEffort(0, 6, 4))
+}
+
+// nearLossless returns a WebPTuning.NearLossless level.
+func nearLossless(level int) *int {
+	return &level
+}
@@ -0,0 +1,88 @@
+package options
+
+import (
+	"fmt"
+	"slices"
+)
+
+// ResizeMode tells how the pages are scaled into the resize box.
+type ResizeMode string
+
+const (
+	// ResizeFit scales the page to fit in the box, keeping all of it.
+	ResizeFit ResizeMode = "fit"
+	// ResizeFill scales the page to cover the box and crops what overflows, keeping the center.
+	ResizeFill ResizeMode = "fill"
+)
+
+// ResizeModes are the accepted values of Resize.Mode.
+var ResizeModes = []ResizeMode{ResizeFit, ResizeFill}
+
+// ResizeFilter is the interpolation used to scale the pages.
+type ResizeFilter string
+
+const (
+	// FilterLanczos is the sharpest filter, the slowest too.
+	FilterLanczos ResizeFilter = "lanczos"
+	// FilterCatmullRom is almost as sharp as Lanczos and faster.
+	FilterCatmullRom ResizeFilter = "catmullrom"
+	// FilterBilinear is the fastest filter, softer when shrinking a lot.
+	FilterBilinear ResizeFilter = "bilinear"
+)
+
+// ResizeFilters are the accepted values of Resize.Filter.
+var ResizeFilters = []ResizeFilter{FilterLanczos, FilterCatmullRom, FilterBilinear}
+
+// Resize scales the pages to a device resolution. A zero width or height doesn't constrain that side.
+type Resize struct {
+	// Width of the box in pixels.
+	Width int `mapstructure:"width"`
+	// Height of the box in pixels.
+	Height int `mapstructure:"height"`
+	// Mode tells how the page is scaled into the box, empty means ResizeFit.
+	Mode ResizeMode `mapstructure:"mode"`
+	// Filter used to scale, empty means FilterLanczos.
+	Filter ResizeFilter `mapstructure:"filter"`
+	// Upscale pages smaller than the box, they are kept as is otherwise.
+	Upscale bool `mapstructure:"upscale"`
+}
+
+// Enabled tells if a box is set.
+func (r Resize) Enabled() bool {
+	return r.Width > 0 || r.Height > 0
+}
+
+// Validate checks the resize values.
+func (r Resize) Validate() error {
+	if r.Width < 0 || r.Height < 0 {
+		return fmt.Errorf("invalid resize box %dx%d, it can't be negative", r.Width, r.Height)
+	}
+	if r.Mode != "" && !slices.Contains(ResizeModes, r.Mode) {
+		return fmt.Errorf("invalid resize mode \"%s\", available options are %s", r.Mode, joinModes(ResizeModes))
+	}
+	if r.Filter != "" && !slices.Contains(ResizeFilters, r.Filter) {
+		return fmt.Errorf("invalid resize filter \"%s\", available options are %s", r.Filter, joinModes(ResizeFilters))
+	}
+	if r.Mode == ResizeFill && (r.Width == 0 || r.Height == 0) {
+		return fmt.Errorf("resize mode %s needs both a width and a height", ResizeFill)
+	}
+	return nil
+}
+
+// Profile holds the settings of a reading device, selected by name.
+type Profile struct {
+	Resize `mapstructure:",squash"`
+	// Adjust holds the tone corrections suited to the screen of the device.
+	Adjust Adjust `mapstructure:",squash"`
+}
+
+// Profiles are the built-in device profiles. The config file can add its own or override them.
+var Profiles = map[string]Profile{
+	"kobo-clara-2e":     {Resize: Resize{Width: 1072, Height: 1448}},
+	"kobo-libra2":       {Resize: Resize{Width: 1264, Height: 1680}},
+	"kobo-sage":         {Resize: Resize{Width: 1440, Height: 1920}},
+	"kindle-paperwhite": {Resize: Resize{Width: 1236, Height: 1648}},
+	"kindle-oasis":      {Resize: Resize{Width: 1264, Height: 1680}},
+	"kindle-scribe":     {Resize: Resize{Width: 1860, Height: 2480}},
+	"phone":             {Resize: Resize{Width: 1080, Height: 2400}},
+}
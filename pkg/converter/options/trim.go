@@ -0,0 +1,50 @@
+package options
+
+import "fmt"
+
+const (
+	// DefaultTrimTolerance is the border tolerance used when Trim.Tolerance is unset.
+	DefaultTrimTolerance = 24
+	// DefaultTrimMaxPercent is the largest trim of a side used when Trim.MaxPercent is unset.
+	DefaultTrimMaxPercent = 10
+	// MaxTrimPercent is the highest value of Trim.MaxPercent.
+	MaxTrimPercent = 45
+)
+
+// Trim crops the uniform borders left by the scanner around the pages.
+type Trim struct {
+	// Enabled turns the trimming on.
+	Enabled bool
+	// Tolerance is the largest luma difference (0-255) between a border pixel and the border color,
+	// 0 uses DefaultTrimTolerance.
+	Tolerance int
+	// MaxPercent is the largest share of the width or height trimmed from each side, 0 uses DefaultTrimMaxPercent.
+	MaxPercent int
+}
+
+// Validate checks the trim values.
+func (t Trim) Validate() error {
+	if t.Tolerance < 0 || t.Tolerance > 255 {
+		return fmt.Errorf("invalid trim tolerance %d, it must be between 0 and 255", t.Tolerance)
+	}
+	if t.MaxPercent < 0 || t.MaxPercent > MaxTrimPercent {
+		return fmt.Errorf("invalid trim max percent %d, it must be between 0 and %d", t.MaxPercent, MaxTrimPercent)
+	}
+	return nil
+}
+
+// BorderTolerance returns Tolerance, or DefaultTrimTolerance when it is unset.
+func (t Trim) BorderTolerance() int {
+	if t.Tolerance == 0 {
+		return DefaultTrimTolerance
+	}
+	return t.Tolerance
+}
+
+// MaxSidePercent returns MaxPercent, or DefaultTrimMaxPercent when it is unset.
+func (t Trim) MaxSidePercent() int {
+	if t.MaxPercent == 0 {
+		return DefaultTrimMaxPercent
+	}
+	return t.MaxPercent
+}
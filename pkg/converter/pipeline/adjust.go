@@ -0,0 +1,192 @@
+package pipeline
+
+import (
+	"image"
+	"image/draw"
+	"math"
+	"slices"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/rs/zerolog/log"
+)
+
+// plane is one 8-bit channel of an image, the sample of the pixel (x, y) relative to the image origin
+// being pix[y*stride+x*step].
+type plane struct {
+	pix    []uint8
+	stride int
+	step   int
+	width  int
+	height int
+}
+
+func (p plane) at(x, y int) uint8 {
+	return p.pix[y*p.stride+x*p.step]
+}
+
+func (p plane) set(x, y int, value uint8) {
+	p.pix[y*p.stride+x*p.step] = value
+}
+
+// adjustContainer applies the tone corrections to the image of the container.
+func adjustContainer(container *manga.PageContainer, adjust *options.Adjust) {
+	container.Image = AdjustImage(container.Image, adjust)
+	log.Debug().
+		Uint16("page_index", container.Page.Index).
+		Uint16("split_part", container.Page.SplitPartIndex).
+		Interface("adjust", adjust).
+		Msg("Page tones adjusted")
+
+	page := *container.Page
+	page.Contents = nil
+	page.Size = 0
+	page.IsModified = true
+	container.Page = &page
+	container.Format = "N/A"
+}
+
+// AdjustImage applies the auto levels, gamma and sharpening to a copy of the image. The luma of grayscale and JPEG
+// images is adjusted, their chroma left alone, the RGB channels of the others.
+func AdjustImage(img image.Image, adjust *options.Adjust) image.Image {
+	if !adjust.Enabled() {
+		return img
+	}
+
+	adjusted, planes := adjustablePlanes(img)
+	if adjust.AutoLevels || (adjust.Gamma != 0 && adjust.Gamma != 1) {
+		curve := toneCurve(lumaHistogram(planes), adjust)
+		for _, p := range planes {
+			for y := 0; y < p.height; y++ {
+				for x := 0; x < p.width; x++ {
+					p.set(x, y, curve[p.at(x, y)])
+				}
+			}
+		}
+	}
+	if adjust.Sharpen > 0 {
+		for _, p := range planes {
+			sharpen(p, adjust.Sharpen)
+		}
+	}
+	return adjusted
+}
+
+// adjustablePlanes copies the image and returns the planes of the copy to adjust, a single luma plane
+// or the three RGB planes.
+func adjustablePlanes(img image.Image) (image.Image, []plane) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	switch typed := img.(type) {
+	case *image.Gray:
+		gray := image.NewGray(bounds)
+		draw.Draw(gray, bounds, typed, bounds.Min, draw.Src)
+		return gray, []plane{{pix: gray.Pix, stride: gray.Stride, step: 1, width: width, height: height}}
+	case *image.YCbCr:
+		ycbcr := *typed
+		ycbcr.Y = slices.Clone(typed.Y)
+		luma := ycbcr.Y[ycbcr.YOffset(bounds.Min.X, bounds.Min.Y):]
+		return &ycbcr, []plane{{pix: luma, stride: ycbcr.YStride, step: 1, width: width, height: height}}
+	default:
+		rgba := image.NewRGBA(bounds)
+		draw.Draw(rgba, bounds, img, bounds.Min, draw.Src)
+		planes := make([]plane, 3)
+		for i := range planes {
+			planes[i] = plane{pix: rgba.Pix[i:], stride: rgba.Stride, step: 4, width: width, height: height}
+		}
+		return rgba, planes
+	}
+}
+
+// lumaHistogram counts the pixels of each luma, computing it from the RGB planes when there are three.
+func lumaHistogram(planes []plane) [256]int {
+	var histogram [256]int
+	p := planes[0]
+	for y := 0; y < p.height; y++ {
+		for x := 0; x < p.width; x++ {
+			if len(planes) == 3 {
+				r, g, b := uint32(planes[0].at(x, y)), uint32(planes[1].at(x, y)), uint32(planes[2].at(x, y))
+				histogram[(299*r+587*g+114*b)/1000]++
+			} else {
+				histogram[p.at(x, y)]++
+			}
+		}
+	}
+	return histogram
+}
+
+// toneCurve maps each level to its adjusted value: the black and white points found by the auto levels are
+// stretched to the full range, then the gamma is applied.
+func toneCurve(histogram [256]int, adjust *options.Adjust) [256]uint8 {
+	low, high := 0, 255
+	if adjust.AutoLevels {
+		total := 0
+		for _, count := range histogram {
+			total += count
+		}
+		blackPercent, whitePercent := adjust.ClipPercents()
+		low = levelAtShare(histogram, total, blackPercent, false)
+		high = levelAtShare(histogram, total, whitePercent, true)
+		if high <= low {
+			// Uniform page, nothing to stretch
+			low, high = 0, 255
+		}
+	}
+	gamma := adjust.Gamma
+	if gamma == 0 {
+		gamma = 1
+	}
+
+	var curve [256]uint8
+	for level := range curve {
+		value := min(max(float64(level-low)/float64(high-low), 0), 1)
+		curve[level] = uint8(math.Round(255 * math.Pow(value, 1/gamma)))
+	}
+	return curve
+}
+
+// levelAtShare returns the first level reached once percent of the pixels are counted,
+// from the darkest level or from the brightest one.
+func levelAtShare(histogram [256]int, total int, percent float64, fromBrightest bool) int {
+	threshold := float64(total) * percent / 100
+	count := 0
+	for i := range histogram {
+		level := i
+		if fromBrightest {
+			level = 255 - i
+		}
+		count += histogram[level]
+		if float64(count) >= threshold {
+			return level
+		}
+	}
+	return 255
+}
+
+// sharpen applies an unsharp mask with a 3x3 box blur to the plane, the border pixels are left as is.
+func sharpen(p plane, amount float64) {
+	if p.width < 3 || p.height < 3 {
+		return
+	}
+
+	source := make([]uint8, p.width*p.height)
+	for y := 0; y < p.height; y++ {
+		for x := 0; x < p.width; x++ {
+			source[y*p.width+x] = p.at(x, y)
+		}
+	}
+
+	for y := 1; y < p.height-1; y++ {
+		for x := 1; x < p.width-1; x++ {
+			sum := 0
+			for dy := -1; dy <= 1; dy++ {
+				row := (y + dy) * p.width
+				sum += int(source[row+x-1]) + int(source[row+x]) + int(source[row+x+1])
+			}
+			value := float64(source[y*p.width+x])
+			sharpened := value + amount*(value-float64(sum)/9)
+			p.set(x, y, uint8(min(max(math.Round(sharpened), 0), 255)))
+		}
+	}
+}
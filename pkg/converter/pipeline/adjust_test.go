@@ -0,0 +1,110 @@
+package pipeline
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fadedScan returns a page of grey paper at the given luma with faded ink bars.
+func fadedScan(paper uint8, ink uint8) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, 100, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 100; x++ {
+			level := paper
+			if x%10 < 3 {
+				level = ink
+			}
+			img.SetGray(x, y, color.Gray{Y: level})
+		}
+	}
+	return img
+}
+
+func TestAdjustImage_AutoLevels(t *testing.T) {
+	img := fadedScan(200, 60)
+	adjusted := AdjustImage(img, &options.Adjust{AutoLevels: true})
+
+	gray, ok := adjusted.(*image.Gray)
+	require.True(t, ok, "grayscale pages stay grayscale")
+	assert.Equal(t, uint8(0), gray.GrayAt(0, 0).Y, "faded ink becomes black")
+	assert.Equal(t, uint8(255), gray.GrayAt(5, 0).Y, "grey paper becomes white")
+	assert.Equal(t, uint8(60), img.GrayAt(0, 0).Y, "the original image is left alone")
+}
+
+func TestAdjustImage_Gamma(t *testing.T) {
+	page := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	draw.Draw(page, page.Bounds(), image.NewUniform(color.Gray{Y: 128}), image.Point{}, draw.Src)
+
+	darker := AdjustImage(page, &options.Adjust{Gamma: 0.5}).(*image.RGBA)
+	assert.Less(t, darker.RGBAAt(1, 1).R, uint8(128))
+	assert.Equal(t, darker.RGBAAt(1, 1).R, darker.RGBAAt(1, 1).B)
+
+	lighter := AdjustImage(page, &options.Adjust{Gamma: 2}).(*image.RGBA)
+	assert.Greater(t, lighter.RGBAAt(1, 1).R, uint8(128))
+}
+
+func TestAdjustImage_KeepsJPEGChroma(t *testing.T) {
+	img := image.NewYCbCr(image.Rect(0, 0, 20, 20), image.YCbCrSubsampleRatio420)
+	for i := range img.Y {
+		img.Y[i] = uint8(50 + i%100)
+	}
+	for i := range img.Cb {
+		img.Cb[i], img.Cr[i] = 90, 160
+	}
+
+	adjusted, ok := AdjustImage(img, &options.Adjust{AutoLevels: true}).(*image.YCbCr)
+	require.True(t, ok)
+	assert.Equal(t, img.Cb, adjusted.Cb)
+	assert.Equal(t, img.Cr, adjusted.Cr)
+	assert.NotEqual(t, img.Y, adjusted.Y)
+	assert.Equal(t, uint8(50), img.Y[0], "the original image is left alone")
+}
+
+func TestAdjustImage_Sharpen(t *testing.T) {
+	// A soft edge between a dark and a light half
+	img := image.NewGray(image.Rect(0, 0, 20, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 20; x++ {
+			level := uint8(80)
+			if x >= 10 {
+				level = 170
+			}
+			img.SetGray(x, y, color.Gray{Y: level})
+		}
+	}
+
+	sharpened := AdjustImage(img, &options.Adjust{Sharpen: 1}).(*image.Gray)
+	assert.Less(t, sharpened.GrayAt(9, 10).Y, uint8(80), "the dark side of the edge gets darker")
+	assert.Greater(t, sharpened.GrayAt(10, 10).Y, uint8(170), "the light side of the edge gets lighter")
+	assert.Equal(t, uint8(80), sharpened.GrayAt(3, 10).Y, "flat areas are left alone")
+}
+
+func TestAdjustImage_Disabled(t *testing.T) {
+	img := fadedScan(200, 60)
+	assert.Same(t, img, AdjustImage(img, &options.Adjust{Gamma: 1}))
+}
+
+func TestToneCurve_UniformPage(t *testing.T) {
+	var histogram [256]int
+	histogram[200] = 1000
+	curve := toneCurve(histogram, &options.Adjust{AutoLevels: true})
+	assert.Equal(t, uint8(200), curve[200], "a blank page isn't stretched")
+}
+
+func TestAdjustContainer(t *testing.T) {
+	page := &manga.Page{Index: 2, Size: 100}
+	container := manga.NewContainer(page, fadedScan(200, 60), "jpeg", true)
+	adjustContainer(container, &options.Adjust{AutoLevels: true})
+
+	assert.True(t, container.Page.IsModified)
+	assert.Equal(t, uint16(2), container.Page.Index)
+	assert.Equal(t, "N/A", container.Format)
+	assert.False(t, page.IsModified)
+}
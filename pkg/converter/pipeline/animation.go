@@ -0,0 +1,239 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+	converterrors "github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/errors"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/options"
+	gowebp "github.com/gen2brain/webp"
+	"github.com/rs/zerolog/log"
+)
+
+// minFrameDelay is the delay given to the frames shown for 10ms or less, as the browsers do.
+const minFrameDelay = 100
+
+// animationFormat returns the format of the image when it has more than one frame, an empty string otherwise.
+// Only the structure of the file is read, the frames aren't decoded.
+func animationFormat(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("GIF8")):
+		if gifFrameCount(data, 2) > 1 {
+			return "gif"
+		}
+	case len(data) >= 21 && string(data[:4]) == "RIFF" && string(data[8:16]) == "WEBPVP8X":
+		// Animation flag of the extended format header
+		if data[20]&0x02 != 0 {
+			return "webp"
+		}
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		if apngFrameCount(data) > 1 {
+			return "png"
+		}
+	}
+	return ""
+}
+
+// gifFrameCount counts the image descriptors of the GIF, stopping at limit.
+func gifFrameCount(data []byte, limit int) int {
+	if len(data) < 13 {
+		return 0
+	}
+	offset := 13
+	if data[10]&0x80 != 0 {
+		offset += 3 << (data[10]&0x07 + 1)
+	}
+
+	skipSubBlocks := func() {
+		for offset < len(data) && data[offset] != 0 {
+			offset += int(data[offset]) + 1
+		}
+		offset++
+	}
+
+	frames := 0
+	for offset < len(data) && frames < limit {
+		switch data[offset] {
+		case 0x21: // Extension, its label then sub blocks
+			offset += 2
+			skipSubBlocks()
+		case 0x2C: // Image descriptor, its color table, the LZW code size then the data sub blocks
+			if offset+10 > len(data) {
+				return frames
+			}
+			frames++
+			flags := data[offset+9]
+			offset += 10
+			if flags&0x80 != 0 {
+				offset += 3 << (flags&0x07 + 1)
+			}
+			offset++
+			skipSubBlocks()
+		default: // Trailer or corrupted data
+			return frames
+		}
+	}
+	return frames
+}
+
+// apngFrameCount reads the number of frames of the acTL chunk, 1 when the PNG isn't animated.
+func apngFrameCount(data []byte) int {
+	offset := 8
+	for offset+8 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[offset:]))
+		kind := string(data[offset+4 : offset+8])
+		if kind == "IDAT" || length < 0 || offset+12+length > len(data) {
+			break
+		}
+		if kind == "acTL" && length >= 8 {
+			return int(binary.BigEndian.Uint32(data[offset+8:]))
+		}
+		offset += 12 + length
+	}
+	return 1
+}
+
+// decodeAnimation decodes every frame of an animated page, as full size images.
+func decodeAnimation(data []byte, format string) (*manga.Animation, error) {
+	switch format {
+	case "gif":
+		decoded, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return gifAnimation(decoded), nil
+	case "webp":
+		decoded, err := gowebp.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return &manga.Animation{Frames: decoded.Image, Delays: decoded.Delay, LoopCount: decoded.LoopCount}, nil
+	}
+	return nil, fmt.Errorf("decoding animated %s images isn't supported", format)
+}
+
+// gifAnimation draws the frames of the GIF, which can cover part of the image only, on the full canvas following
+// their disposal methods.
+func gifAnimation(decoded *gif.GIF) *manga.Animation {
+	bounds := image.Rect(0, 0, decoded.Config.Width, decoded.Config.Height)
+	canvas := image.NewNRGBA(bounds)
+	animation := &manga.Animation{}
+
+	switch {
+	case decoded.LoopCount < 0:
+		animation.LoopCount = 1
+	case decoded.LoopCount > 0:
+		// The GIF count is the number of repetitions after the first play
+		animation.LoopCount = decoded.LoopCount + 1
+	}
+
+	for i, frame := range decoded.Image {
+		var previous *image.NRGBA
+		disposal := byte(0)
+		if i < len(decoded.Disposal) {
+			disposal = decoded.Disposal[i]
+		}
+		if disposal == gif.DisposalPrevious {
+			previous = cloneNRGBA(canvas)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		animation.Frames = append(animation.Frames, cloneNRGBA(canvas))
+		delay := 0
+		if i < len(decoded.Delay) {
+			delay = decoded.Delay[i] * 10
+		}
+		if delay <= 10 {
+			delay = minFrameDelay
+		}
+		animation.Delays = append(animation.Delays, delay)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return animation
+}
+
+func cloneNRGBA(img *image.NRGBA) *image.NRGBA {
+	clone := *img
+	clone.Pix = bytes.Clone(img.Pix)
+	return &clone
+}
+
+// animatedContainer returns the container of an animated page: its frames when they are to be converted by the
+// stages, the page as it is otherwise. converted tells which one was picked.
+func animatedContainer(page *manga.Page, format string, mode options.AnimationMode, stages *Stages) (container *manga.PageContainer, converted bool) {
+	reason := ""
+	switch {
+	case mode != options.AnimationConvert:
+		reason = "animations are kept"
+	case stages.ConvertAnimation == nil:
+		reason = fmt.Sprintf("%s has no animations", stages.Format)
+	case format == stages.Format.String():
+		reason = fmt.Sprintf("already in %s format", format)
+	}
+	if reason != "" {
+		log.Info().
+			Uint16("page_index", page.Index).
+			Str("format", format).
+			Str("reason", reason).
+			Msg("Animated page kept as is")
+		return manga.NewContainer(page, nil, format, false), false
+	}
+
+	animation, err := decodeAnimation(page.Contents.Bytes(), format)
+	if err != nil {
+		log.Warn().
+			Uint16("page_index", page.Index).
+			Str("format", format).
+			Err(err).
+			Msg("Failed to decode animated page, keeping it as is")
+		return manga.NewContainer(page, nil, format, false), false
+	}
+	container = manga.NewContainer(page, nil, format, true)
+	container.Animation = animation
+	return container, true
+}
+
+// convertAnimation encodes the frames of the container with the given stage. The page is kept as it is when the
+// animation can't be encoded, or when the stage prefers the original. converted tells which one was picked.
+func convertAnimation(container *manga.PageContainer, convert func(container *manga.PageContainer) (*manga.PageContainer, error)) (result *manga.PageContainer, converted bool, err error) {
+	page := container.Page
+	frames := len(container.Animation.Frames)
+	result, err = convert(container)
+	container.Animation = nil
+	if err != nil {
+		log.Warn().
+			Uint16("page_index", page.Index).
+			Str("format", container.Format).
+			Err(err).
+			Msg("Failed to encode animated page, keeping it as is")
+		container.IsToBeConverted = false
+		return container, false, converterrors.NewPageIgnored(fmt.Sprintf("animated page %d can't be converted, it is kept as is: %v", page.Index, err))
+	}
+
+	if !result.HasBeenConverted {
+		log.Info().
+			Uint16("page_index", page.Index).
+			Str("format", container.Format).
+			Str("reason", "the original is smaller").
+			Msg("Animated page kept as is")
+		return result, false, nil
+	}
+	log.Info().
+		Uint16("page_index", page.Index).
+		Str("format", container.Format).
+		Int("frames", frames).
+		Str("extension", result.Page.Extension).
+		Msg("Animated page converted")
+	return result, true, nil
+}
@@ -0,0 +1,171 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/png"
+	"testing"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/constant"
+	converterrors "github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/errors"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/options"
+	gowebp "github.com/gen2brain/webp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// palettedFrame returns a frame of the given bounds filled with a color of the web palette.
+func palettedFrame(bounds image.Rectangle, index uint8) *image.Paletted {
+	frame := image.NewPaletted(bounds, palette.WebSafe)
+	for i := range frame.Pix {
+		frame.Pix[i] = index
+	}
+	return frame
+}
+
+// animatedGIF encodes a 20x10 GIF whose second frame only covers its left half.
+func animatedGIF(t *testing.T, disposal byte) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, gif.EncodeAll(&buf, &gif.GIF{
+		Image:     []*image.Paletted{palettedFrame(image.Rect(0, 0, 20, 10), 0), palettedFrame(image.Rect(0, 0, 10, 10), 215)},
+		Delay:     []int{50, 0},
+		Disposal:  []byte{disposal, gif.DisposalNone},
+		LoopCount: 2,
+	}))
+	return buf.Bytes()
+}
+
+func TestAnimationFormat(t *testing.T) {
+	var stillGIF bytes.Buffer
+	require.NoError(t, gif.Encode(&stillGIF, palettedFrame(image.Rect(0, 0, 4, 4), 0), nil))
+
+	var stillPNG bytes.Buffer
+	require.NoError(t, png.Encode(&stillPNG, image.NewGray(image.Rect(0, 0, 4, 4))))
+	// The animation control chunk of an APNG goes before the image data, after IHDR
+	actl := append([]byte{0, 0, 0, 3}, 0, 0, 0, 0)
+	apng := append(append(append([]byte{}, stillPNG.Bytes()[:33]...), pngChunk("acTL", actl)...), stillPNG.Bytes()[33:]...)
+
+	// Identical frames would be merged into a still image
+	black, white := image.NewNRGBA(image.Rect(0, 0, 4, 4)), image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	for i := range white.Pix {
+		white.Pix[i] = 255
+	}
+	var stillWebP, animatedWebP bytes.Buffer
+	require.NoError(t, gowebp.Encode(&stillWebP, black, gowebp.Options{Lossless: true}))
+	require.NoError(t, gowebp.EncodeAll(&animatedWebP, &gowebp.WEBP{Image: []image.Image{black, white}, Delay: []int{100, 100}}, gowebp.Options{Lossless: true}))
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{name: "Animated GIF", data: animatedGIF(t, gif.DisposalNone), expected: "gif"},
+		{name: "Still GIF", data: stillGIF.Bytes()},
+		{name: "APNG", data: apng, expected: "png"},
+		{name: "Still PNG", data: stillPNG.Bytes()},
+		{name: "Animated WebP", data: animatedWebP.Bytes(), expected: "webp"},
+		{name: "Still WebP", data: stillWebP.Bytes()},
+		{name: "Truncated GIF", data: animatedGIF(t, gif.DisposalNone)[:20]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, animationFormat(tt.data))
+		})
+	}
+}
+
+func TestDecodeAnimation_GIF(t *testing.T) {
+	tests := []struct {
+		name     string
+		disposal byte
+		// right is the color of the right half of the second frame, which it doesn't cover
+		right color.NRGBA
+	}{
+		{name: "Frames drawn over each other", disposal: gif.DisposalNone, right: color.NRGBA{A: 255}},
+		{name: "Frame cleared to the background", disposal: gif.DisposalBackground, right: color.NRGBA{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			animation, err := decodeAnimation(animatedGIF(t, tt.disposal), "gif")
+			require.NoError(t, err)
+			require.Len(t, animation.Frames, 2)
+			assert.Equal(t, []int{500, minFrameDelay}, animation.Delays)
+			assert.Equal(t, 3, animation.LoopCount, "played once then repeated twice")
+
+			second := animation.Frames[1].(*image.NRGBA)
+			assert.Equal(t, image.Rect(0, 0, 20, 10), second.Bounds())
+			assert.Equal(t, color.NRGBA{R: 255, G: 255, B: 255, A: 255}, second.NRGBAAt(5, 5))
+			assert.Equal(t, tt.right, second.NRGBAAt(15, 5))
+			assert.Equal(t, color.NRGBA{A: 255}, animation.Frames[0].(*image.NRGBA).NRGBAAt(5, 5), "frames are copies")
+		})
+	}
+
+	_, err := decodeAnimation([]byte("not an animation"), "png")
+	assert.Error(t, err)
+}
+
+func TestRun_Animations(t *testing.T) {
+	animated := animatedGIF(t, gif.DisposalNone)
+	newChapter := func() *manga.Chapter {
+		return &manga.Chapter{Pages: []*manga.Page{{Index: 0, Extension: ".gif", Contents: bytes.NewBuffer(animated), Size: uint64(len(animated))}}}
+	}
+	convertAnimation := func(container *manga.PageContainer) (*manga.PageContainer, error) {
+		container.SetConverted(bytes.NewBufferString("animation"), ".anim")
+		return container, nil
+	}
+
+	tests := []struct {
+		name      string
+		mode      options.AnimationMode
+		convert   func(container *manga.PageContainer) (*manga.PageContainer, error)
+		extension string
+		// expectError is set when the page is kept with an error reported
+		expectError bool
+	}{
+		{name: "Kept by default", convert: convertAnimation, extension: ".gif"},
+		{name: "Converted", mode: options.AnimationConvert, convert: convertAnimation, extension: ".anim"},
+		{name: "Kept when the format has no animations", mode: options.AnimationConvert, extension: ".gif"},
+		{
+			name: "Kept when the encoding fails",
+			mode: options.AnimationConvert,
+			convert: func(container *manga.PageContainer) (*manga.PageContainer, error) {
+				return nil, errors.New("too big")
+			},
+			extension:   ".gif",
+			expectError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stages := &Stages{
+				Format: constant.WebP,
+				CheckPageNeedsSplit: func(page *manga.Page, splitRequested bool) (bool, image.Image, string, error) {
+					t.Fatal("animated pages aren't decoded as still images")
+					return false, nil, "", nil
+				},
+				ConvertPage: func(container *manga.PageContainer) (*manga.PageContainer, error) {
+					return container, nil
+				},
+				ConvertAnimation: tt.convert,
+			}
+			converted, err := Run(context.Background(), newChapter(), &options.ConvertOptions{Animations: tt.mode}, stages, func(string, uint32, uint32) {})
+			if tt.expectError {
+				var pageIgnored *converterrors.PageIgnoredError
+				assert.ErrorAs(t, err, &pageIgnored)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Len(t, converted.Pages, 1)
+			assert.Equal(t, tt.extension, converted.Pages[0].Extension)
+			if tt.extension == ".gif" {
+				assert.Equal(t, animated, converted.Pages[0].Contents.Bytes())
+			}
+		})
+	}
+}
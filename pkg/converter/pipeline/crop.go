@@ -0,0 +1,195 @@
+package pipeline
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/oliamb/cutter"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// gutterTolerance is the largest luma difference between the pixels of a gutter row, on a 0-255 scale.
+	gutterTolerance = 24
+	// minGutterRows is the thinnest band of uniform rows considered as a gutter.
+	minGutterRows = 4
+)
+
+// SplitImage cuts the image with the given split mode, no part being taller than maxPartHeight (0 for no limit).
+func SplitImage(img image.Image, mode options.SplitMode, cropHeight int, maxPartHeight int) ([]image.Image, error) {
+	if maxPartHeight > 0 && cropHeight > maxPartHeight {
+		cropHeight = maxPartHeight
+	}
+	if mode == options.SplitSmart {
+		return SmartCropImage(img, cropHeight, maxPartHeight)
+	}
+	return CropImage(img, cropHeight)
+}
+
+// CropImage cuts the image into parts of cropHeight pixels, the last part holding the remainder.
+func CropImage(img image.Image, cropHeight int) ([]image.Image, error) {
+	height := img.Bounds().Dy()
+	var cuts []int
+	for y := cropHeight; y < height; y += cropHeight {
+		cuts = append(cuts, y)
+	}
+	return cropAt(img, cropHeight, cuts)
+}
+
+// SmartCropImage cuts the image into parts of about cropHeight pixels. Each cut is moved to the middle of the
+// nearest gutter, a band of near uniform rows, found within a quarter of cropHeight around it.
+// Without gutter, the cut stays at cropHeight. No part is taller than maxPartHeight, 0 meaning no limit.
+func SmartCropImage(img image.Image, cropHeight int, maxPartHeight int) ([]image.Image, error) {
+	return cropAt(img, cropHeight, smartCuts(img, cropHeight, maxPartHeight))
+}
+
+// smartCuts returns the rows, relative to the top of the image, where the parts start.
+func smartCuts(img image.Image, cropHeight int, maxPartHeight int) []int {
+	height := img.Bounds().Dy()
+
+	var cuts []int
+	for top := 0; height-top > cropHeight; {
+		cut := nextCut(img, top, cropHeight, maxPartHeight)
+		cuts = append(cuts, cut)
+		top = cut
+	}
+	return cuts
+}
+
+// nextCut returns the row where the part starting at top ends, the image having to be taller than top+cropHeight.
+func nextCut(img image.Image, top int, cropHeight int, maxPartHeight int) int {
+	height := img.Bounds().Dy()
+	window := cropHeight / 4
+	target := top + cropHeight
+	low := max(target-window, top+1)
+	high := min(target+window, height-1)
+	if maxPartHeight > 0 {
+		high = min(high, top+maxPartHeight)
+	}
+
+	cut := findGutter(img, low, high, target)
+	log.Trace().
+		Int("target", target).
+		Int("cut", cut).
+		Int("window_start", low).
+		Int("window_end", high).
+		Msg("Smart split cut selected")
+	return cut
+}
+
+// findGutter returns the middle of the gutter between rows low and high closest to target, or target without gutter.
+func findGutter(img image.Image, low int, high int, target int) int {
+	best := target
+	bestDistance := -1
+	bandStart := -1
+	for y := low; y <= high+1; y++ {
+		if y <= high && isUniformRow(img, y) {
+			if bandStart < 0 {
+				bandStart = y
+			}
+			continue
+		}
+		if bandStart >= 0 && y-bandStart >= minGutterRows {
+			middle := (bandStart + y) / 2
+			distance := middle - target
+			if distance < 0 {
+				distance = -distance
+			}
+			if bestDistance < 0 || distance < bestDistance {
+				best, bestDistance = middle, distance
+			}
+		}
+		bandStart = -1
+	}
+	return best
+}
+
+// isUniformRow tells if the luma of the pixels of the row, relative to the top of the image, stays within gutterTolerance.
+func isUniformRow(img image.Image, row int) bool {
+	bounds := img.Bounds()
+	y := bounds.Min.Y + row
+	lowest, highest := uint8(255), uint8(0)
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		luma := lumaAt(img, x, y)
+		lowest, highest = min(lowest, luma), max(highest, luma)
+		if highest-lowest > gutterTolerance {
+			return false
+		}
+	}
+	return true
+}
+
+// lumaAt returns the luma of the pixel, on a 0-255 scale.
+func lumaAt(img image.Image, x int, y int) uint8 {
+	switch typed := img.(type) {
+	case *image.YCbCr:
+		return typed.Y[typed.YOffset(x, y)]
+	case *image.Gray:
+		return typed.Pix[typed.PixOffset(x, y)]
+	default:
+		r, g, b, _ := img.At(x, y).RGBA()
+		return uint8((299*r + 587*g + 114*b) / 1000 >> 8)
+	}
+}
+
+// cropAt cuts the image at the given rows, relative to its top.
+func cropAt(img image.Image, cropHeight int, cuts []int) ([]image.Image, error) {
+	bounds := img.Bounds()
+	height := bounds.Dy()
+	width := bounds.Dx()
+	numParts := len(cuts) + 1
+
+	log.Debug().
+		Int("original_width", width).
+		Int("original_height", height).
+		Int("crop_height", cropHeight).
+		Int("num_parts", numParts).
+		Msg("Starting image cropping for page splitting")
+
+	parts := make([]image.Image, numParts)
+
+	top := 0
+	for i := 0; i < numParts; i++ {
+		bottom := height
+		if i < len(cuts) {
+			bottom = cuts[i]
+		}
+		partHeight := bottom - top
+
+		log.Debug().
+			Int("part_index", i).
+			Int("part_height", partHeight).
+			Int("y_offset", top).
+			Msg("Cropping image part")
+
+		part, err := cutter.Crop(img, cutter.Config{
+			Width:  width,
+			Height: partHeight,
+			Anchor: image.Point{Y: top},
+			Mode:   cutter.TopLeft,
+		})
+		if err != nil {
+			log.Error().
+				Int("part_index", i).
+				Err(err).
+				Msg("Failed to crop image part")
+			return nil, fmt.Errorf("error cropping part %d: %v", i+1, err)
+		}
+
+		parts[i] = part
+		top = bottom
+
+		log.Debug().
+			Int("part_index", i).
+			Int("cropped_width", part.Bounds().Dx()).
+			Int("cropped_height", part.Bounds().Dy()).
+			Msg("Image part cropped successfully")
+	}
+
+	log.Debug().
+		Int("total_parts", len(parts)).
+		Msg("Image cropping completed")
+
+	return parts, nil
+}
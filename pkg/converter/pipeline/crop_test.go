@@ -0,0 +1,120 @@
+package pipeline
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stripWithGutters returns a strip filled with a checker pattern, except for white gutters between the given rows.
+func stripWithGutters(width, height int, gutters ...[2]int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.RGBA{R: 20, G: 20, B: 20, A: 255}
+			if (x/8+y/8)%2 == 0 {
+				c = color.RGBA{R: 230, G: 200, B: 180, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	for _, gutter := range gutters {
+		for y := gutter[0]; y < gutter[1]; y++ {
+			for x := 0; x < width; x++ {
+				img.Set(x, y, color.White)
+			}
+		}
+	}
+	return img
+}
+
+func partHeights(parts []image.Image) []int {
+	heights := make([]int, len(parts))
+	for i, part := range parts {
+		heights[i] = part.Bounds().Dy()
+	}
+	return heights
+}
+
+func TestCropImage(t *testing.T) {
+	parts, err := CropImage(stripWithGutters(50, 2500), 1000)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1000, 1000, 500}, partHeights(parts))
+}
+
+func TestSmartCropImage(t *testing.T) {
+	tests := []struct {
+		name          string
+		img           image.Image
+		cropHeight    int
+		maxPartHeight int
+		expected      []int
+	}{
+		{
+			name:       "Cut moved to the gutter",
+			img:        stripWithGutters(50, 2000, [2]int{880, 920}),
+			cropHeight: 1000,
+			expected:   []int{900, 1000, 100},
+		},
+		{
+			name:       "Closest gutter wins",
+			img:        stripWithGutters(50, 2000, [2]int{780, 800}, [2]int{1040, 1060}),
+			cropHeight: 1000,
+			expected:   []int{1050, 950},
+		},
+		{
+			name:       "Gutter outside the window is ignored",
+			img:        stripWithGutters(50, 2000, [2]int{500, 540}),
+			cropHeight: 1000,
+			expected:   []int{1000, 1000},
+		},
+		{
+			name:       "Gutter thinner than the minimum is ignored",
+			img:        stripWithGutters(50, 2000, [2]int{950, 952}),
+			cropHeight: 1000,
+			expected:   []int{1000, 1000},
+		},
+		{
+			name:          "Parts never exceed the max part height",
+			img:           stripWithGutters(50, 2000, [2]int{1180, 1220}),
+			cropHeight:    1000,
+			maxPartHeight: 1100,
+			expected:      []int{1000, 1000},
+		},
+		{
+			name:       "Short image is not cut",
+			img:        stripWithGutters(50, 900),
+			cropHeight: 1000,
+			expected:   []int{900},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts, err := SmartCropImage(tt.img, tt.cropHeight, tt.maxPartHeight)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, partHeights(parts))
+		})
+	}
+}
+
+func TestSplitImage(t *testing.T) {
+	img := stripWithGutters(50, 3000, [2]int{880, 920})
+
+	parts, err := SplitImage(img, "", 1000, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1000, 1000, 1000}, partHeights(parts), "fixed is the default mode")
+
+	parts, err = SplitImage(img, options.SplitSmart, 1000, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int{900, 1000, 1000, 100}, partHeights(parts))
+
+	// The crop height is capped by the max part height in both modes
+	parts, err = SplitImage(img, options.SplitFixed, 2000, 1500)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1500, 1500}, partHeights(parts))
+}
@@ -0,0 +1,257 @@
+package pipeline
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"image/draw"
+	"io"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/icc"
+	"github.com/rs/zerolog/log"
+)
+
+// maxICCProfileSize bounds the size of an embedded profile once decompressed.
+const maxICCProfileSize = 16 << 20
+
+// DecodePage decodes the image of the page the way it is meant to be displayed: the embedded ICC profile,
+// when it isn't sRGB, is converted to sRGB, CMYK images are converted to RGB and the EXIF orientation is applied.
+// When the image had to be corrected, the page is marked as modified and the format is "N/A" as the image no
+// longer matches the contents of the page. Metadata that can't be read or applied is logged and ignored, only the
+// decoding of the image itself can fail.
+func DecodePage(page *manga.Page) (image.Image, string, error) {
+	data := page.Contents.Bytes()
+	decoded, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, format, err
+	}
+
+	img := decoded
+	meta := readMetadata(format, data)
+	if meta.icc != nil {
+		img = applyICCProfile(page, img, meta.icc)
+	}
+	if cmyk, ok := img.(*image.CMYK); ok {
+		rgba := image.NewRGBA(cmyk.Bounds())
+		draw.Draw(rgba, rgba.Bounds(), cmyk, cmyk.Bounds().Min, draw.Src)
+		img = rgba
+	}
+
+	if orientation := exifOrientation(meta.exif); orientation > 1 {
+		log.Debug().
+			Uint16("page_index", page.Index).
+			Int("orientation", orientation).
+			Msg("Applying EXIF orientation")
+		img = orient(img, orientation)
+	}
+
+	if img != decoded {
+		page.IsModified = true
+		format = "N/A"
+	}
+	return img, format, nil
+}
+
+func applyICCProfile(page *manga.Page, img image.Image, data []byte) image.Image {
+	profile, err := icc.Parse(data)
+	if err != nil {
+		log.Warn().Uint16("page_index", page.Index).Err(err).Msg("Ignoring unreadable ICC profile")
+		return img
+	}
+	if profile.IsSRGB() {
+		return img
+	}
+
+	converted, err := profile.ToSRGB(img)
+	if err != nil {
+		log.Warn().
+			Uint16("page_index", page.Index).
+			Str("icc_profile", profile.Description).
+			Err(err).
+			Msg("Failed to convert page to sRGB, keeping its colors as is")
+		return img
+	}
+	log.Debug().
+		Uint16("page_index", page.Index).
+		Str("icc_profile", profile.Description).
+		Str("color_space", profile.ColorSpace).
+		Msg("Converted page to sRGB")
+	return converted
+}
+
+// metadata holds the raw ICC profile and EXIF (TIFF structure) of an image, nil when absent.
+type metadata struct {
+	icc  []byte
+	exif []byte
+}
+
+func readMetadata(format string, data []byte) metadata {
+	switch format {
+	case "jpeg":
+		return readJPEGMetadata(data)
+	case "png":
+		return readPNGMetadata(data)
+	case "webp":
+		return readWebPMetadata(data)
+	}
+	return metadata{}
+}
+
+// readJPEGMetadata reads the APP1 Exif segment and the APP2 segments the ICC profile is split in.
+func readJPEGMetadata(data []byte) metadata {
+	var meta metadata
+	var chunks [][]byte
+	exifHeader := []byte("Exif\x00\x00")
+	iccHeader := []byte("ICC_PROFILE\x00")
+
+	offset := 2
+	for offset+4 <= len(data) && data[offset] == 0xFF {
+		marker := data[offset+1]
+		if marker == 0xFF {
+			offset++
+			continue
+		}
+		if marker == 0xD8 || marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			offset += 2
+			continue
+		}
+		// The metadata comes before the image data
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[offset+2:]))
+		if length < 2 || offset+2+length > len(data) {
+			break
+		}
+		segment := data[offset+4 : offset+2+length]
+		switch {
+		case marker == 0xE1 && meta.exif == nil && bytes.HasPrefix(segment, exifHeader):
+			meta.exif = segment[len(exifHeader):]
+		case marker == 0xE2 && bytes.HasPrefix(segment, iccHeader) && len(segment) > len(iccHeader)+2:
+			sequence, count := int(segment[len(iccHeader)]), int(segment[len(iccHeader)+1])
+			if chunks == nil && count > 0 {
+				chunks = make([][]byte, count)
+			}
+			if sequence >= 1 && sequence <= len(chunks) {
+				chunks[sequence-1] = segment[len(iccHeader)+2:]
+			}
+		}
+		offset += 2 + length
+	}
+
+	if len(chunks) > 0 {
+		var profile []byte
+		for _, chunk := range chunks {
+			if chunk == nil {
+				return meta
+			}
+			profile = append(profile, chunk...)
+		}
+		meta.icc = profile
+	}
+	return meta
+}
+
+// readPNGMetadata reads the iCCP and eXIf chunks.
+func readPNGMetadata(data []byte) metadata {
+	var meta metadata
+	offset := 8
+	for offset+8 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[offset:]))
+		kind := string(data[offset+4 : offset+8])
+		if length < 0 || offset+12+length > len(data) || kind == "IDAT" {
+			break
+		}
+		chunk := data[offset+8 : offset+8+length]
+		switch kind {
+		case "iCCP":
+			// Profile name, null separator, compression method and the zlib compressed profile
+			separator := bytes.IndexByte(chunk, 0)
+			if separator >= 0 && separator+2 <= len(chunk) {
+				meta.icc = inflate(chunk[separator+2:])
+			}
+		case "eXIf":
+			meta.exif = chunk
+		}
+		offset += 12 + length
+	}
+	return meta
+}
+
+// readWebPMetadata reads the ICCP and EXIF chunks of an extended WebP file.
+func readWebPMetadata(data []byte) metadata {
+	var meta metadata
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return meta
+	}
+	offset := 12
+	for offset+8 <= len(data) {
+		kind := string(data[offset : offset+4])
+		length := int(binary.LittleEndian.Uint32(data[offset+4:]))
+		if length < 0 || offset+8+length > len(data) {
+			break
+		}
+		chunk := data[offset+8 : offset+8+length]
+		switch kind {
+		case "ICCP":
+			meta.icc = chunk
+		case "EXIF":
+			// Some writers keep the JPEG header in front of the TIFF structure
+			meta.exif = bytes.TrimPrefix(chunk, []byte("Exif\x00\x00"))
+		}
+		offset += 8 + length + length%2
+	}
+	return meta
+}
+
+func inflate(data []byte) []byte {
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	defer reader.Close()
+	inflated, err := io.ReadAll(io.LimitReader(reader, maxICCProfileSize))
+	if err != nil {
+		return nil
+	}
+	return inflated
+}
+
+// exifOrientation returns the orientation (1-8) stored in the first IFD of the EXIF, 1 when there is none.
+func exifOrientation(exif []byte) int {
+	if len(exif) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(exif[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(exif[4:]))
+	if ifd < 8 || ifd+2 > len(exif) {
+		return 1
+	}
+	entries := int(order.Uint16(exif[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + 12*i
+		if entry+12 > len(exif) {
+			break
+		}
+		// Orientation tag, a SHORT value
+		if order.Uint16(exif[entry:]) == 0x0112 && order.Uint16(exif[entry+2:]) == 3 {
+			orientation := int(order.Uint16(exif[entry+8:]))
+			if orientation >= 1 && orientation <= 8 {
+				return orientation
+			}
+			return 1
+		}
+	}
+	return 1
+}
@@ -0,0 +1,211 @@
+package pipeline
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadPage(t *testing.T, name string) *manga.Page {
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	require.NoError(t, err)
+	return &manga.Page{Index: 1, Extension: filepath.Ext(name), Contents: bytes.NewBuffer(data), Size: uint64(len(data))}
+}
+
+func decodeReference(t *testing.T) image.Image {
+	file, err := os.Open(filepath.Join("testdata", "page.png"))
+	require.NoError(t, err)
+	defer file.Close()
+	img, err := png.Decode(file)
+	require.NoError(t, err)
+	return img
+}
+
+// meanDifference returns the mean absolute difference of the RGB channels (0-255) of two images of the same size.
+func meanDifference(t *testing.T, expected image.Image, actual image.Image) float64 {
+	require.Equal(t, expected.Bounds().Size(), actual.Bounds().Size())
+	var sum float64
+	expectedMin, actualMin := expected.Bounds().Min, actual.Bounds().Min
+	size := expected.Bounds().Size()
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			r1, g1, b1, _ := expected.At(expectedMin.X+x, expectedMin.Y+y).RGBA()
+			r2, g2, b2, _ := actual.At(actualMin.X+x, actualMin.Y+y).RGBA()
+			for _, pair := range [][2]uint32{{r1, r2}, {g1, g2}, {b1, b2}} {
+				sum += math.Abs(float64(pair[0]>>8) - float64(pair[1]>>8))
+			}
+		}
+	}
+	return sum / float64(3*size.X*size.Y)
+}
+
+func TestDecodePage_Fixtures(t *testing.T) {
+	reference := decodeReference(t)
+
+	tests := []struct {
+		name string
+		file string
+		// plainDifference is the least mean difference with the reference when decoding without the metadata,
+		// 0 when the plain decoding doesn't even have the right size
+		plainDifference float64
+	}{
+		{name: "CMYK JPEG", file: "page_cmyk.jpeg"},
+		{name: "Adobe RGB profile", file: "page_adobe_rgb.jpeg", plainDifference: 5},
+		{name: "EXIF orientation", file: "page_orientation6.jpeg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := loadPage(t, tt.file)
+			img, format, err := DecodePage(page)
+			require.NoError(t, err)
+			assert.Equal(t, "N/A", format, "the image no longer matches the contents")
+			assert.True(t, page.IsModified)
+			assert.NotEqual(t, color.CMYKModel, img.ColorModel())
+			assert.Less(t, meanDifference(t, reference, img), 3.0, "the decoded page looks like the original")
+
+			if tt.plainDifference > 0 {
+				plain, _, err := image.Decode(bytes.NewReader(page.Contents.Bytes()))
+				require.NoError(t, err)
+				assert.Greater(t, meanDifference(t, reference, plain), tt.plainDifference, "the fixture is far from the original without its metadata")
+			}
+		})
+	}
+}
+
+func TestDecodePage_WithoutMetadata(t *testing.T) {
+	page := loadPage(t, "page.png")
+	img, format, err := DecodePage(page)
+	require.NoError(t, err)
+	assert.Equal(t, "png", format)
+	assert.False(t, page.IsModified)
+	assert.Zero(t, meanDifference(t, decodeReference(t), img))
+}
+
+func TestDecodePage_Invalid(t *testing.T) {
+	_, _, err := DecodePage(&manga.Page{Index: 1, Contents: bytes.NewBufferString("not an image")})
+	assert.Error(t, err)
+}
+
+// pngChunk returns a PNG chunk with its checksum.
+func pngChunk(kind string, data []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(append(chunk, kind...), data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+// tiffOrientation returns a little endian TIFF structure with the orientation as the only tag.
+func tiffOrientation(orientation uint16) []byte {
+	data := []byte("II*\x00\x08\x00\x00\x00\x01\x00\x12\x01\x03\x00\x01\x00\x00\x00")
+	data = binary.LittleEndian.AppendUint16(data, orientation)
+	return append(data, make([]byte, 6)...)
+}
+
+func TestDecodePage_PNGMetadata(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 3, 2))
+	copy(img.Pix, []uint8{1, 2, 3, 4, 5, 6})
+	var encoded bytes.Buffer
+	require.NoError(t, png.Encode(&encoded, img))
+
+	// A profile that can't be parsed is ignored
+	var profile bytes.Buffer
+	writer := zlib.NewWriter(&profile)
+	_, err := writer.Write([]byte("not an icc profile"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	// The chunks go after IHDR, which ends at byte 33
+	data := append([]byte{}, encoded.Bytes()[:33]...)
+	data = append(data, pngChunk("iCCP", append([]byte("Profile\x00\x00"), profile.Bytes()...))...)
+	data = append(data, pngChunk("eXIf", tiffOrientation(8))...)
+	data = append(data, encoded.Bytes()[33:]...)
+
+	meta := readPNGMetadata(data)
+	assert.Equal(t, []byte("not an icc profile"), meta.icc)
+
+	decoded, format, err := DecodePage(&manga.Page{Index: 1, Contents: bytes.NewBuffer(data)})
+	require.NoError(t, err)
+	assert.Equal(t, "N/A", format)
+	gray, ok := decoded.(*image.Gray)
+	require.True(t, ok)
+	assert.Equal(t, image.Rect(0, 0, 2, 3), gray.Bounds())
+	assert.Equal(t, []uint8{3, 6, 2, 5, 1, 4}, gray.Pix)
+}
+
+func TestReadWebPMetadata(t *testing.T) {
+	chunk := func(kind string, data []byte) []byte {
+		result := append([]byte(kind), binary.LittleEndian.AppendUint32(nil, uint32(len(data)))...)
+		result = append(result, data...)
+		if len(data)%2 == 1 {
+			result = append(result, 0)
+		}
+		return result
+	}
+	body := append([]byte("WEBP"), chunk("VP8X", make([]byte, 10))...)
+	body = append(body, chunk("ICCP", []byte("profile"))...)
+	body = append(body, chunk("EXIF", append([]byte("Exif\x00\x00"), tiffOrientation(3)...))...)
+	data := append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...)
+	data = append(data, body...)
+
+	meta := readWebPMetadata(data)
+	assert.Equal(t, []byte("profile"), meta.icc)
+	assert.Equal(t, 3, exifOrientation(meta.exif))
+}
+
+func TestExifOrientation(t *testing.T) {
+	assert.Equal(t, 6, exifOrientation(tiffOrientation(6)))
+	assert.Equal(t, 6, exifOrientation([]byte("MM\x00*\x00\x00\x00\x08\x00\x01\x01\x12\x00\x03\x00\x00\x00\x01\x00\x06\x00\x00\x00\x00\x00\x00")))
+	assert.Equal(t, 1, exifOrientation(tiffOrientation(9)), "invalid orientations are ignored")
+	assert.Equal(t, 1, exifOrientation(nil))
+	assert.Equal(t, 1, exifOrientation([]byte("II*\x00\xFF\x00\x00\x00")), "IFD out of the data")
+}
+
+func TestOrient(t *testing.T) {
+	// 1 2 3
+	// 4 5 6
+	img := image.NewGray(image.Rect(0, 0, 3, 2))
+	copy(img.Pix, []uint8{1, 2, 3, 4, 5, 6})
+
+	tests := []struct {
+		orientation int
+		size        image.Point
+		expected    []uint8
+	}{
+		{orientation: 2, size: image.Pt(3, 2), expected: []uint8{3, 2, 1, 6, 5, 4}},
+		{orientation: 3, size: image.Pt(3, 2), expected: []uint8{6, 5, 4, 3, 2, 1}},
+		{orientation: 4, size: image.Pt(3, 2), expected: []uint8{4, 5, 6, 1, 2, 3}},
+		{orientation: 5, size: image.Pt(2, 3), expected: []uint8{1, 4, 2, 5, 3, 6}},
+		{orientation: 6, size: image.Pt(2, 3), expected: []uint8{4, 1, 5, 2, 6, 3}},
+		{orientation: 7, size: image.Pt(2, 3), expected: []uint8{6, 3, 5, 2, 4, 1}},
+		{orientation: 8, size: image.Pt(2, 3), expected: []uint8{3, 6, 2, 5, 1, 4}},
+	}
+
+	for _, tt := range tests {
+		gray := orient(img, tt.orientation).(*image.Gray)
+		assert.Equal(t, tt.size, gray.Bounds().Size(), "orientation %d", tt.orientation)
+		assert.Equal(t, tt.expected, gray.Pix, "orientation %d", tt.orientation)
+	}
+
+	// Color images are turned into NRGBA, from any origin
+	colored := image.NewRGBA(image.Rect(10, 10, 13, 12))
+	for i, value := range []uint8{1, 2, 3, 4, 5, 6} {
+		colored.SetRGBA(10+i%3, 10+i/3, color.RGBA{R: value, G: 255 - value, A: 255})
+	}
+	nrgba := orient(colored, 6).(*image.NRGBA)
+	assert.Equal(t, image.Rect(0, 0, 2, 3), nrgba.Bounds())
+	assert.Equal(t, color.NRGBA{R: 4, G: 251, A: 255}, nrgba.NRGBAAt(0, 0))
+	assert.Equal(t, color.NRGBA{R: 3, G: 252, A: 255}, nrgba.NRGBAAt(1, 2))
+}
@@ -0,0 +1,106 @@
+package pipeline
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+	"github.com/rs/zerolog/log"
+)
+
+// grayscaleOutlierRatio is the share of pixels allowed above the chroma tolerance, for the specks of color
+// left by the scan or the compression.
+const grayscaleOutlierRatio = 1000
+
+// grayscaleContainer converts the image of the container to image.Gray when it has no color.
+// Returns whether the page is grayscale.
+func grayscaleContainer(container *manga.PageContainer, tolerance int) bool {
+	grayscale := isGrayscale(container.Image, tolerance)
+	log.Debug().
+		Uint16("page_index", container.Page.Index).
+		Uint16("split_part", container.Page.SplitPartIndex).
+		Bool("grayscale", grayscale).
+		Int("chroma_tolerance", tolerance).
+		Msg("Page color analyzed")
+
+	if grayscale {
+		if _, ok := container.Image.(*image.Gray); !ok {
+			container.Image = toGray(container.Image)
+		}
+	}
+	return grayscale
+}
+
+// isGrayscale tells if the chroma of the pixels, but a few outliers, is within the tolerance.
+func isGrayscale(img image.Image, tolerance int) bool {
+	bounds := img.Bounds()
+	maxOutliers := bounds.Dx() * bounds.Dy() / grayscaleOutlierRatio
+	outliers := 0
+
+	isColor := func(r, g, b uint8) bool {
+		chroma := int(max(r, g, b)) - int(min(r, g, b))
+		if chroma <= tolerance {
+			return false
+		}
+		outliers++
+		return outliers > maxOutliers
+	}
+
+	switch typed := img.(type) {
+	case *image.Gray, *image.Gray16:
+		return true
+	case *image.YCbCr:
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				chromaOffset := typed.COffset(x, y)
+				r, g, b := color.YCbCrToRGB(typed.Y[typed.YOffset(x, y)], typed.Cb[chromaOffset], typed.Cr[chromaOffset])
+				if isColor(r, g, b) {
+					return false
+				}
+			}
+		}
+	case *image.RGBA:
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				pixel := typed.Pix[typed.PixOffset(x, y):]
+				if isColor(pixel[0], pixel[1], pixel[2]) {
+					return false
+				}
+			}
+		}
+	case *image.NRGBA:
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				pixel := typed.Pix[typed.PixOffset(x, y):]
+				if isColor(pixel[0], pixel[1], pixel[2]) {
+					return false
+				}
+			}
+		}
+	default:
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				r, g, b, _ := img.At(x, y).RGBA()
+				if isColor(uint8(r>>8), uint8(g>>8), uint8(b>>8)) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// toGray converts the image to a single channel, keeping the luma of JPEG pages as is.
+func toGray(img image.Image) *image.Gray {
+	bounds := img.Bounds()
+	gray := image.NewGray(bounds)
+	if ycbcr, ok := img.(*image.YCbCr); ok {
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			copy(gray.Pix[gray.PixOffset(bounds.Min.X, y):gray.PixOffset(bounds.Max.X, y)], ycbcr.Y[ycbcr.YOffset(bounds.Min.X, y):])
+		}
+		return gray
+	}
+	draw.Draw(gray, bounds, img, bounds.Min, draw.Src)
+	return gray
+}
@@ -0,0 +1,101 @@
+package pipeline
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// toYCbCr converts the image like a JPEG decoder would return it.
+func toYCbCr(img image.Image) *image.YCbCr {
+	bounds := img.Bounds()
+	ycbcr := image.NewYCbCr(bounds, image.YCbCrSubsampleRatio444)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			yy, cb, cr := color.RGBToYCbCr(uint8(r>>8), uint8(g>>8), uint8(b>>8))
+			ycbcr.Y[ycbcr.YOffset(x, y)] = yy
+			ycbcr.Cb[ycbcr.COffset(x, y)] = cb
+			ycbcr.Cr[ycbcr.COffset(x, y)] = cr
+		}
+	}
+	return ycbcr
+}
+
+// tintedPage returns a gray gradient page with a patch of the given color covering the given share of the pixels.
+func tintedPage(tint color.RGBA, patchPixels int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 100; x++ {
+			level := uint8(x * 2)
+			img.SetRGBA(x, y, color.RGBA{R: level, G: level, B: level, A: 255})
+		}
+	}
+	for i := 0; i < patchPixels; i++ {
+		img.SetRGBA(i%100, i/100, tint)
+	}
+	return img
+}
+
+func TestIsGrayscale(t *testing.T) {
+	tests := []struct {
+		name      string
+		img       image.Image
+		tolerance int
+		expected  bool
+	}{
+		{name: "Gray image", img: image.NewGray(image.Rect(0, 0, 10, 10)), tolerance: 0, expected: true},
+		{name: "Neutral RGB page", img: tintedPage(color.RGBA{}, 0), tolerance: 0, expected: true},
+		{name: "Color page", img: tintedPage(color.RGBA{R: 200, G: 30, B: 30, A: 255}, 2000), tolerance: 16, expected: false},
+		{name: "Slight tint within tolerance", img: tintedPage(color.RGBA{R: 110, G: 100, B: 100, A: 255}, 2000), tolerance: 16, expected: true},
+		{name: "Slight tint above tolerance", img: tintedPage(color.RGBA{R: 110, G: 100, B: 100, A: 255}, 2000), tolerance: 4, expected: false},
+		{name: "A few colored specks", img: tintedPage(color.RGBA{R: 200, G: 30, B: 30, A: 255}, 5), tolerance: 16, expected: true},
+		{name: "Gray JPEG page", img: toYCbCr(tintedPage(color.RGBA{}, 0)), tolerance: 4, expected: true},
+		{name: "Color JPEG page", img: toYCbCr(tintedPage(color.RGBA{R: 30, G: 30, B: 200, A: 255}, 2000)), tolerance: 16, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, isGrayscale(tt.img, tt.tolerance))
+		})
+	}
+}
+
+func TestToGray_KeepsJPEGLuma(t *testing.T) {
+	source := toYCbCr(tintedPage(color.RGBA{}, 0))
+	gray := toGray(source)
+	for x := 0; x < 100; x += 10 {
+		assert.Equal(t, source.Y[source.YOffset(x, 50)], gray.GrayAt(x, 50).Y)
+	}
+}
+
+func TestGrayscaleContainer(t *testing.T) {
+	t.Run("Grayscale page is converted", func(t *testing.T) {
+		container := manga.NewContainer(&manga.Page{Index: 3}, tintedPage(color.RGBA{}, 0), "png", true)
+		assert.True(t, grayscaleContainer(container, 16))
+		gray, ok := container.Image.(*image.Gray)
+		require.True(t, ok, "page should be single channel")
+		assert.Equal(t, uint8(100), gray.GrayAt(50, 50).Y)
+	})
+
+	t.Run("Color page is left alone", func(t *testing.T) {
+		img := tintedPage(color.RGBA{R: 200, G: 30, B: 30, A: 255}, 2000)
+		container := manga.NewContainer(&manga.Page{Index: 0}, img, "png", true)
+		assert.False(t, grayscaleContainer(container, 16))
+		assert.Same(t, img, container.Image)
+	})
+
+	t.Run("Offset bounds", func(t *testing.T) {
+		img := image.NewRGBA(image.Rect(10, 20, 30, 60))
+		draw.Draw(img, img.Bounds(), image.NewUniform(color.Gray{Y: 80}), image.Point{}, draw.Src)
+		container := manga.NewContainer(&manga.Page{}, img, "png", true)
+		assert.True(t, grayscaleContainer(container, 0))
+		assert.Equal(t, img.Bounds(), container.Image.Bounds())
+		assert.Equal(t, uint8(80), container.Image.(*image.Gray).GrayAt(10, 20).Y)
+	})
+}
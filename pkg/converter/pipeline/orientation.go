@@ -0,0 +1,65 @@
+package pipeline
+
+import (
+	"image"
+	"image/draw"
+)
+
+// orient turns the image the way its EXIF orientation (2-8) says it is displayed.
+// Gray images stay gray, the other ones are converted to NRGBA.
+func orient(img image.Image, orientation int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	var src, dst []byte
+	var srcStride, dstStride, pixelSize int
+	var oriented image.Image
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+
+	if gray, ok := img.(*image.Gray); ok {
+		result := image.NewGray(image.Rect(0, 0, dstWidth, dstHeight))
+		src, srcStride = gray.Pix[gray.PixOffset(bounds.Min.X, bounds.Min.Y):], gray.Stride
+		dst, dstStride, pixelSize = result.Pix, result.Stride, 1
+		oriented = result
+	} else {
+		nrgba, ok := img.(*image.NRGBA)
+		if !ok {
+			nrgba = image.NewNRGBA(image.Rect(0, 0, width, height))
+			draw.Draw(nrgba, nrgba.Bounds(), img, bounds.Min, draw.Src)
+			bounds = nrgba.Bounds()
+		}
+		result := image.NewNRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+		src, srcStride = nrgba.Pix[nrgba.PixOffset(bounds.Min.X, bounds.Min.Y):], nrgba.Stride
+		dst, dstStride, pixelSize = result.Pix, result.Stride, 4
+		oriented = result
+	}
+
+	for y := 0; y < dstHeight; y++ {
+		for x := 0; x < dstWidth; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // Mirrored horizontally
+				sx, sy = width-1-x, y
+			case 3: // Rotated 180°
+				sx, sy = width-1-x, height-1-y
+			case 4: // Mirrored vertically
+				sx, sy = x, height-1-y
+			case 5: // Transposed
+				sx, sy = y, x
+			case 6: // Needs a 90° clockwise rotation
+				sx, sy = y, height-1-x
+			case 7: // Transversed
+				sx, sy = width-1-y, height-1-x
+			case 8: // Needs a 90° counterclockwise rotation
+				sx, sy = width-1-y, x
+			default:
+				sx, sy = x, y
+			}
+			copy(dst[y*dstStride+x*pixelSize:][:pixelSize], src[sy*srcStride+sx*pixelSize:][:pixelSize])
+		}
+	}
+	return oriented
+}
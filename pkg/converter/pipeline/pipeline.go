@@ -0,0 +1,408 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/constant"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/exp/slices"
+)
+
+// Stages holds the format specific steps used by Run to convert a chapter.
+type Stages struct {
+	// Format is the format the pages are converted to.
+	Format constant.ConversionFormat
+	// CheckPageNeedsSplit decodes the page and tells if it needs to be split.
+	// When an error is returned alongside a decoded image, the page is kept as is.
+	CheckPageNeedsSplit func(page *manga.Page, splitRequested bool) (bool, image.Image, string, error)
+	// CropImage splits a decoded image into multiple parts.
+	CropImage func(img image.Image) ([]image.Image, error)
+	// ConvertPage encodes the page of the container to the target format.
+	ConvertPage func(container *manga.PageContainer) (*manga.PageContainer, error)
+	// Stitch, when set, replaces CheckPageNeedsSplit and CropImage: it decodes all the pages and returns the
+	// containers to convert. An error returned alongside containers is reported without stopping the conversion.
+	Stitch func(pages []*manga.Page) ([]*manga.PageContainer, error)
+	// ConvertAnimation encodes the Animation of the container to an animation of the target format.
+	// Nil when the format has no animations, the animated pages are then kept as they are.
+	ConvertAnimation func(container *manga.PageContainer) (*manga.PageContainer, error)
+}
+
+// Run converts all the pages of the chapter concurrently using the given stages.
+//
+// Returns partial success where some pages are converted and some are not.
+func Run(ctx context.Context, chapter *manga.Chapter, opts *options.ConvertOptions, stages *Stages, progress func(message string, current uint32, total uint32)) (*manga.Chapter, error) {
+	var wgConvertedPages sync.WaitGroup
+	maxGoroutines := runtime.NumCPU()
+
+	pagesChan := make(chan *manga.PageContainer, maxGoroutines)
+	errChan := make(chan error, maxGoroutines)
+	doneChan := make(chan struct{})
+
+	// Errors are collected while the pages are processed, the channel would block the workers otherwise
+	var errList []error
+	errCollected := make(chan struct{})
+	go func() {
+		defer close(errCollected)
+		for err := range errChan {
+			errList = append(errList, err)
+		}
+	}()
+
+	var wgPages sync.WaitGroup
+
+	guard := make(chan struct{}, maxGoroutines)
+	pagesMutex := sync.Mutex{}
+	var pages []*manga.Page
+	var totalPages atomic.Uint32
+	totalPages.Store(uint32(len(chapter.Pages)))
+	var grayPages, colorPages atomic.Uint32
+	var keptAnimations, convertedAnimations atomic.Uint32
+
+	log.Debug().
+		Str("chapter", chapter.FilePath).
+		Int("total_pages", len(chapter.Pages)).
+		Int("worker_count", maxGoroutines).
+		Msg("Initialized conversion worker pool")
+
+	// Check if context is already cancelled
+	select {
+	case <-ctx.Done():
+		log.Warn().Str("chapter", chapter.FilePath).Msg("Chapter conversion cancelled due to timeout")
+		close(errChan)
+		return nil, ctx.Err()
+	default:
+	}
+
+	// Start the worker pool
+	go func() {
+		defer close(doneChan)
+		for page := range pagesChan {
+			select {
+			case <-ctx.Done():
+				// The pages left are drained so that every queued page is accounted for
+				wgConvertedPages.Done()
+				continue
+			case guard <- struct{}{}: // would block if guard channel is already filled
+			}
+
+			go func(pageToConvert *manga.PageContainer) {
+				defer func() {
+					wgConvertedPages.Done()
+					<-guard
+				}()
+
+				// Check context cancellation before processing
+				select {
+				case <-ctx.Done():
+					return
+				default:
+				}
+
+				if opts.Resize.Enabled() && pageToConvert.IsToBeConverted && pageToConvert.Image != nil {
+					resizeContainer(pageToConvert, &opts.Resize)
+				}
+				if opts.Adjust.Enabled() && pageToConvert.IsToBeConverted && pageToConvert.Image != nil {
+					adjustContainer(pageToConvert, &opts.Adjust)
+				}
+				if (opts.Grayscale || opts.GrayLevels > 0) && pageToConvert.IsToBeConverted && pageToConvert.Image != nil {
+					if grayscaleContainer(pageToConvert, opts.GrayscaleChromaTolerance()) {
+						grayPages.Add(1)
+						if opts.GrayLevels > 0 {
+							quantizeContainer(pageToConvert, opts.GrayLevels, opts.Dither)
+						}
+					} else {
+						colorPages.Add(1)
+					}
+				}
+
+				if pageToConvert.Animation != nil {
+					convertedPage, converted, err := convertAnimation(pageToConvert, stages.ConvertAnimation)
+					if converted {
+						convertedAnimations.Add(1)
+					} else {
+						keptAnimations.Add(1)
+					}
+					if err != nil {
+						select {
+						case errChan <- err:
+						case <-ctx.Done():
+							return
+						}
+					}
+					pagesMutex.Lock()
+					pages = append(pages, convertedPage.Page)
+					progress(fmt.Sprintf("Converted %d/%d pages to %s format", len(pages), totalPages.Load(), stages.Format), uint32(len(pages)), totalPages.Load())
+					pagesMutex.Unlock()
+					return
+				}
+
+				convertedPage, err := stages.ConvertPage(pageToConvert)
+				if err != nil {
+					if convertedPage == nil {
+						select {
+						case errChan <- err:
+						case <-ctx.Done():
+							return
+						}
+						return
+					}
+					buffer := new(bytes.Buffer)
+					err := png.Encode(buffer, convertedPage.Image)
+					if err != nil {
+						select {
+						case errChan <- err:
+						case <-ctx.Done():
+							return
+						}
+						return
+					}
+					convertedPage.Page.Contents = buffer
+					convertedPage.Page.Extension = ".png"
+					convertedPage.Page.Size = uint64(buffer.Len())
+				}
+				pagesMutex.Lock()
+				pages = append(pages, convertedPage.Page)
+				progress(fmt.Sprintf("Converted %d/%d pages to %s format", len(pages), totalPages.Load(), stages.Format), uint32(len(pages)), totalPages.Load())
+				pagesMutex.Unlock()
+			}(page)
+		}
+	}()
+
+	// queue hands a container to the worker pool, false when the conversion is cancelled
+	queue := func(container *manga.PageContainer) bool {
+		wgConvertedPages.Add(1)
+		select {
+		case pagesChan <- container:
+			return true
+		case <-ctx.Done():
+			wgConvertedPages.Done()
+			return false
+		}
+	}
+
+	// Process pages
+	if stages.Stitch != nil {
+		containers, err := stages.Stitch(chapter.Pages)
+		if err != nil {
+			if containers == nil {
+				close(pagesChan)
+				close(errChan)
+				<-errCollected
+				return nil, err
+			}
+			select {
+			case errChan <- err:
+			case <-ctx.Done():
+			}
+		}
+		totalPages.Store(uint32(len(containers)))
+		log.Debug().
+			Str("chapter", chapter.FilePath).
+			Int("original_pages", len(chapter.Pages)).
+			Int("stitched_pages", len(containers)).
+			Msg("Pages stitched")
+
+		for _, container := range containers {
+			if !queue(container) {
+				break
+			}
+		}
+	} else {
+		for _, page := range chapter.Pages {
+			if ctx.Err() != nil {
+				break
+			}
+
+			wgPages.Add(1)
+			go func(page *manga.Page) {
+				defer wgPages.Done()
+
+				if format := animationFormat(page.Contents.Bytes()); format != "" {
+					container, converted := animatedContainer(page, format, opts.Animations, stages)
+					if !converted {
+						keptAnimations.Add(1)
+					}
+					queue(container)
+					return
+				}
+
+				splitNeeded, img, format, err := stages.CheckPageNeedsSplit(page, opts.Split)
+				if err != nil {
+					select {
+					case errChan <- err:
+					case <-ctx.Done():
+						return
+					}
+					if img != nil {
+						queue(manga.NewContainer(page, img, format, false))
+					}
+					return
+				}
+
+				if opts.Trim.Enabled {
+					trimmedPage, trimmedImg, err := trimPage(page, img, &opts.Trim)
+					if err != nil {
+						select {
+						case errChan <- err:
+						case <-ctx.Done():
+							return
+						}
+					} else if trimmedPage != page {
+						page, img, format = trimmedPage, trimmedImg, "N/A"
+					}
+				}
+
+				if opts.Spreads != "" && opts.Spreads != options.SpreadKeep && isSpread(img) {
+					containers, err := spreadContainers(page, img, format, opts.Spreads)
+					if err != nil {
+						select {
+						case errChan <- err:
+						case <-ctx.Done():
+						}
+						return
+					}
+					totalPages.Add(uint32(len(containers) - 1))
+					for _, container := range containers {
+						if !queue(container) {
+							return
+						}
+					}
+					return
+				}
+
+				if !splitNeeded {
+					queue(manga.NewContainer(page, img, format, true))
+					return
+				}
+
+				images, err := stages.CropImage(img)
+				if err != nil {
+					select {
+					case errChan <- err:
+					case <-ctx.Done():
+						return
+					}
+					return
+				}
+
+				totalPages.Add(uint32(len(images) - 1))
+				for i, img := range images {
+					newPage := &manga.Page{
+						Index:          page.Index,
+						Path:           page.Path,
+						IsSplitted:     true,
+						SplitPartIndex: uint16(i),
+					}
+					if !queue(manga.NewContainer(newPage, img, "N/A", true)) {
+						return
+					}
+				}
+			}(page)
+		}
+	}
+
+	wgPages.Wait()
+	close(pagesChan)
+
+	// Wait for all conversions to complete or context cancellation
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		wgConvertedPages.Wait()
+	}()
+
+	select {
+	case <-done:
+		// Conversion completed successfully
+	case <-ctx.Done():
+		log.Warn().Str("chapter", chapter.FilePath).Msg("Chapter conversion cancelled due to timeout")
+		// The conversions still running stop at their next cancellation check, the errors are dropped once they did
+		go func() {
+			<-done
+			close(errChan)
+		}()
+		return nil, ctx.Err()
+	}
+
+	close(errChan)
+	close(guard)
+	<-errCollected
+
+	var aggregatedError error = nil
+	if len(errList) > 0 {
+		aggregatedError = errors.Join(errList...)
+		log.Debug().
+			Str("chapter", chapter.FilePath).
+			Int("error_count", len(errList)).
+			Msg("Conversion completed with errors")
+	} else {
+		log.Debug().
+			Str("chapter", chapter.FilePath).
+			Int("pages_converted", len(pages)).
+			Msg("Conversion completed successfully")
+	}
+
+	slices.SortFunc(pages, func(a, b *manga.Page) int {
+		if a.Index == b.Index {
+			return int(a.SplitPartIndex) - int(b.SplitPartIndex)
+		}
+		return int(a.Index) - int(b.Index)
+	})
+	chapter.Pages = pages
+
+	// The ComicInfo pages follow the original positions, shifted by the split pages
+	var doublePages []int
+	renumber := false
+	for i, page := range pages {
+		if page.IsDoublePage {
+			doublePages = append(doublePages, i)
+		}
+		renumber = renumber || page.IsSplitted
+	}
+	if renumber {
+		chapter.RenumberPages()
+	}
+	if len(doublePages) > 0 {
+		chapter.SetDoublePages(doublePages)
+		log.Debug().
+			Str("chapter", chapter.FilePath).
+			Ints("double_pages", doublePages).
+			Msg("Double page spreads marked in ComicInfo")
+	}
+
+	if opts.Grayscale || opts.GrayLevels > 0 {
+		log.Info().
+			Str("chapter", chapter.FilePath).
+			Uint32("grayscale_pages", grayPages.Load()).
+			Uint32("color_pages", colorPages.Load()).
+			Msg("Grayscale detection summary")
+	}
+
+	if kept, converted := keptAnimations.Load(), convertedAnimations.Load(); kept+converted > 0 {
+		log.Info().
+			Str("chapter", chapter.FilePath).
+			Uint32("kept_animations", kept).
+			Uint32("converted_animations", converted).
+			Msg("Animated pages summary")
+	}
+
+	log.Debug().
+		Str("chapter", chapter.FilePath).
+		Int("final_page_count", len(pages)).
+		Msg("Pages sorted and chapter updated")
+
+	runtime.GC()
+	log.Debug().Str("chapter", chapter.FilePath).Msg("Garbage collection completed")
+
+	return chapter, aggregatedError
+}
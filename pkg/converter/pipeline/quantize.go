@@ -0,0 +1,75 @@
+package pipeline
+
+import (
+	"image"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+	"github.com/rs/zerolog/log"
+)
+
+// quantizeContainer reduces the gray levels of the container image, when it is grayscale.
+func quantizeContainer(container *manga.PageContainer, levels int, dither bool) {
+	gray, ok := container.Image.(*image.Gray)
+	if !ok {
+		return
+	}
+
+	container.Image = quantizeGray(gray, levels, dither)
+	log.Debug().
+		Uint16("page_index", container.Page.Index).
+		Uint16("split_part", container.Page.SplitPartIndex).
+		Int("gray_levels", levels).
+		Bool("dither", dither).
+		Msg("Page quantized")
+
+	page := *container.Page
+	page.Contents = nil
+	page.Size = 0
+	page.IsModified = true
+	container.Page = &page
+	container.Format = "N/A"
+}
+
+// quantizeGray returns a copy of the image reduced to the given number of evenly spaced gray levels.
+// With dither, the quantization error is diffused to the neighbouring pixels with Floyd-Steinberg.
+func quantizeGray(img *image.Gray, levels int, dither bool) *image.Gray {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	quantized := image.NewGray(bounds)
+	step := 255 / float64(levels-1)
+	nearest := func(value float64) uint8 {
+		level := int(value/step + 0.5)
+		return uint8(min(max(float64(level)*step+0.5, 0), 255))
+	}
+
+	if !dither {
+		for y := 0; y < height; y++ {
+			source := img.Pix[img.PixOffset(bounds.Min.X, bounds.Min.Y+y):]
+			target := quantized.Pix[y*quantized.Stride:]
+			for x := 0; x < width; x++ {
+				target[x] = nearest(float64(source[x]))
+			}
+		}
+		return quantized
+	}
+
+	// Errors carried to the current and next rows, with a pixel of margin on both sides
+	current := make([]float64, width+2)
+	next := make([]float64, width+2)
+	for y := 0; y < height; y++ {
+		source := img.Pix[img.PixOffset(bounds.Min.X, bounds.Min.Y+y):]
+		target := quantized.Pix[y*quantized.Stride:]
+		for x := 0; x < width; x++ {
+			value := min(max(float64(source[x])+current[x+1], 0), 255)
+			target[x] = nearest(value)
+			diffusion := value - float64(target[x])
+			current[x+2] += diffusion * 7 / 16
+			next[x] += diffusion * 3 / 16
+			next[x+1] += diffusion * 5 / 16
+			next[x+2] += diffusion * 1 / 16
+		}
+		current, next = next, current
+		clear(next)
+	}
+	return quantized
+}
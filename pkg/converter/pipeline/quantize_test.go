@@ -0,0 +1,96 @@
+package pipeline
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+	"github.com/stretchr/testify/assert"
+)
+
+// grayGradient returns a horizontal gradient going through every gray level.
+func grayGradient() *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, 256, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 256; x++ {
+			img.SetGray(x, y, color.Gray{Y: uint8(x)})
+		}
+	}
+	return img
+}
+
+func distinctLevels(img *image.Gray) map[uint8]bool {
+	levels := make(map[uint8]bool)
+	for _, value := range img.Pix {
+		levels[value] = true
+	}
+	return levels
+}
+
+func TestQuantizeGray(t *testing.T) {
+	tests := []struct {
+		name   string
+		levels int
+		dither bool
+	}{
+		{name: "16 levels", levels: 16},
+		{name: "4 levels dithered", levels: 4, dither: true},
+		{name: "Black and white", levels: 2},
+		{name: "Black and white dithered", levels: 2, dither: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quantized := quantizeGray(grayGradient(), tt.levels, tt.dither)
+			levels := distinctLevels(quantized)
+			assert.Len(t, levels, tt.levels)
+			step := 255 / float64(tt.levels-1)
+			for value := range levels {
+				index := float64(value) / step
+				assert.InDelta(t, index, float64(int(index+0.5)), 0.05, "level %d isn't evenly spaced", value)
+			}
+		})
+	}
+}
+
+func TestQuantizeGray_Nearest(t *testing.T) {
+	quantized := quantizeGray(grayGradient(), 16, false)
+	assert.Equal(t, uint8(0), quantized.GrayAt(8, 0).Y)
+	assert.Equal(t, uint8(17), quantized.GrayAt(9, 0).Y)
+	assert.Equal(t, uint8(255), quantized.GrayAt(255, 0).Y)
+}
+
+func TestQuantizeGray_DitherKeepsTones(t *testing.T) {
+	// A flat mid gray is rendered with a mix of black and white averaging to it
+	img := image.NewGray(image.Rect(0, 0, 64, 64))
+	for i := range img.Pix {
+		img.Pix[i] = 100
+	}
+
+	plain := quantizeGray(img, 2, false)
+	assert.Len(t, distinctLevels(plain), 1)
+
+	dithered := quantizeGray(img, 2, true)
+	sum := 0
+	for _, value := range dithered.Pix {
+		sum += int(value)
+	}
+	assert.InDelta(t, 100, sum/len(dithered.Pix), 3)
+}
+
+func TestQuantizeContainer(t *testing.T) {
+	page := &manga.Page{Index: 1}
+	container := manga.NewContainer(page, grayGradient(), "png", true)
+	quantizeContainer(container, 4, false)
+	assert.Len(t, distinctLevels(container.Image.(*image.Gray)), 4)
+	assert.True(t, container.Page.IsModified)
+	assert.False(t, page.IsModified)
+
+	// Color pages are left alone
+	colorImage := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	colorContainer := manga.NewContainer(page, colorImage, "png", true)
+	quantizeContainer(colorContainer, 4, false)
+	assert.Same(t, colorImage, colorContainer.Image)
+	assert.Same(t, page, colorContainer.Page)
+}
@@ -0,0 +1,111 @@
+package pipeline
+
+import (
+	"image"
+	"math"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/image/draw"
+)
+
+// lanczos3 is the Lanczos kernel with 3 lobes, not provided by x/image/draw.
+var lanczos3 = &draw.Kernel{
+	Support: 3,
+	At: func(t float64) float64 {
+		if t == 0 {
+			return 1
+		}
+		if t >= 3 {
+			return 0
+		}
+		t *= math.Pi
+		return 3 * math.Sin(t) * math.Sin(t/3) / (t * t)
+	},
+}
+
+func resizeKernel(filter options.ResizeFilter) draw.Interpolator {
+	switch filter {
+	case options.FilterCatmullRom:
+		return draw.CatmullRom
+	case options.FilterBilinear:
+		return draw.BiLinear
+	default:
+		return lanczos3
+	}
+}
+
+// resizeContainer scales the image of the container into the resize box. A resized page gets a copy of the page
+// without its original contents, as they don't match the image anymore.
+func resizeContainer(container *manga.PageContainer, resize *options.Resize) {
+	resized, ok := resizeImage(container.Image, resize)
+	if !ok {
+		return
+	}
+
+	log.Debug().
+		Uint16("page_index", container.Page.Index).
+		Uint16("split_part", container.Page.SplitPartIndex).
+		Int("original_width", container.Image.Bounds().Dx()).
+		Int("original_height", container.Image.Bounds().Dy()).
+		Int("width", resized.Bounds().Dx()).
+		Int("height", resized.Bounds().Dy()).
+		Msg("Page resized")
+
+	page := *container.Page
+	page.Contents = nil
+	page.Size = 0
+	page.IsModified = true
+	container.Page = &page
+	container.Image = resized
+	container.Format = "N/A"
+}
+
+// resizeImage scales the image into the resize box, returning false when the image is kept as is.
+func resizeImage(img image.Image, resize *options.Resize) (image.Image, bool) {
+	bounds := img.Bounds()
+	width, height := float64(bounds.Dx()), float64(bounds.Dy())
+	if width == 0 || height == 0 {
+		return img, false
+	}
+
+	widthScale, heightScale := math.Inf(1), math.Inf(1)
+	if resize.Width > 0 {
+		widthScale = float64(resize.Width) / width
+	}
+	if resize.Height > 0 {
+		heightScale = float64(resize.Height) / height
+	}
+
+	// The source area scaled into the destination, all of it but when filling
+	source := bounds
+	var scale float64
+	if resize.Mode == options.ResizeFill {
+		scale = math.Max(widthScale, heightScale)
+	} else {
+		scale = math.Min(widthScale, heightScale)
+	}
+	if scale > 1 && !resize.Upscale {
+		scale = 1
+	}
+
+	targetWidth := max(int(math.Round(width*scale)), 1)
+	targetHeight := max(int(math.Round(height*scale)), 1)
+	if resize.Mode == options.ResizeFill {
+		targetWidth, targetHeight = min(targetWidth, resize.Width), min(targetHeight, resize.Height)
+		sourceWidth := min(int(math.Round(float64(targetWidth)/scale)), bounds.Dx())
+		sourceHeight := min(int(math.Round(float64(targetHeight)/scale)), bounds.Dy())
+		left := bounds.Min.X + (bounds.Dx()-sourceWidth)/2
+		top := bounds.Min.Y + (bounds.Dy()-sourceHeight)/2
+		source = image.Rect(left, top, left+sourceWidth, top+sourceHeight)
+	}
+
+	if targetWidth == bounds.Dx() && targetHeight == bounds.Dy() {
+		return img, false
+	}
+
+	resized := image.NewRGBA(image.Rect(0, 0, targetWidth, targetHeight))
+	resizeKernel(resize.Filter).Scale(resized, resized.Bounds(), img, source, draw.Src, nil)
+	return resized, true
+}
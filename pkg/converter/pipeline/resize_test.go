@@ -0,0 +1,75 @@
+package pipeline
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResizeImage(t *testing.T) {
+	tests := []struct {
+		name          string
+		size          image.Point
+		resize        options.Resize
+		expectResized bool
+		expectedSize  image.Point
+	}{
+		{name: "Fit in the box", size: image.Pt(3000, 4000), resize: options.Resize{Width: 1264, Height: 1680}, expectResized: true, expectedSize: image.Pt(1260, 1680)},
+		{name: "Fit limited by the width", size: image.Pt(3000, 3000), resize: options.Resize{Width: 1264, Height: 1680}, expectResized: true, expectedSize: image.Pt(1264, 1264)},
+		{name: "Width only", size: image.Pt(2000, 6000), resize: options.Resize{Width: 1000}, expectResized: true, expectedSize: image.Pt(1000, 3000)},
+		{name: "Smaller page isn't upscaled", size: image.Pt(800, 1000), resize: options.Resize{Width: 1264, Height: 1680}, expectedSize: image.Pt(800, 1000)},
+		{name: "Upscale when asked", size: image.Pt(800, 1000), resize: options.Resize{Width: 1264, Height: 1680, Upscale: true}, expectResized: true, expectedSize: image.Pt(1264, 1580)},
+		{name: "Fill crops the overflow", size: image.Pt(3000, 3000), resize: options.Resize{Width: 1000, Height: 1500, Mode: options.ResizeFill}, expectResized: true, expectedSize: image.Pt(1000, 1500)},
+		{name: "Fill without upscale only crops", size: image.Pt(800, 2000), resize: options.Resize{Width: 1000, Height: 1500, Mode: options.ResizeFill}, expectResized: true, expectedSize: image.Pt(800, 1500)},
+		{name: "Same size", size: image.Pt(1000, 1500), resize: options.Resize{Width: 1000, Height: 1500}, expectedSize: image.Pt(1000, 1500)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := image.NewRGBA(image.Rectangle{Max: tt.size})
+			resized, ok := resizeImage(img, &tt.resize)
+			assert.Equal(t, tt.expectResized, ok)
+			assert.Equal(t, tt.expectedSize, resized.Bounds().Size())
+		})
+	}
+}
+
+func TestResizeImage_Filters(t *testing.T) {
+	img := newSpread(400, 200)
+	for _, filter := range options.ResizeFilters {
+		t.Run(string(filter), func(t *testing.T) {
+			resized, ok := resizeImage(img, &options.Resize{Width: 100, Filter: filter})
+			assert.True(t, ok)
+			assert.Equal(t, image.Pt(100, 50), resized.Bounds().Size())
+			assert.Equal(t, leftColor, colorAt(resized, 10, 25))
+			assert.Equal(t, rightColor, colorAt(resized, 90, 25))
+		})
+	}
+}
+
+func TestResizeImage_FillKeepsTheCenter(t *testing.T) {
+	// The spread halves are cropped the same on each side
+	resized, ok := resizeImage(newSpread(400, 100), &options.Resize{Width: 100, Height: 100, Mode: options.ResizeFill})
+	assert.True(t, ok)
+	assert.Equal(t, image.Pt(100, 100), resized.Bounds().Size())
+	assert.Equal(t, leftColor, colorAt(resized, 10, 50))
+	assert.Equal(t, rightColor, colorAt(resized, 90, 50))
+}
+
+func TestResizeContainer(t *testing.T) {
+	page := &manga.Page{Index: 2, Contents: bytes.NewBufferString("original"), Extension: ".webp", Size: 8}
+	container := manga.NewContainer(page, image.NewRGBA(image.Rect(0, 0, 2000, 3000)), "webp", true)
+
+	resizeContainer(container, &options.Resize{Width: 1000})
+	assert.Equal(t, image.Pt(1000, 1500), container.Image.Bounds().Size())
+	assert.Equal(t, "N/A", container.Format, "the page has to be encoded again")
+	assert.Equal(t, uint16(2), container.Page.Index)
+	assert.True(t, container.Page.IsModified)
+	assert.Nil(t, container.Page.Contents)
+	assert.Equal(t, "original", page.Contents.String(), "the original page is left untouched")
+	assert.False(t, page.IsModified)
+}
@@ -0,0 +1,86 @@
+package pipeline
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/oliamb/cutter"
+	"github.com/rs/zerolog/log"
+)
+
+// isSpread tells if the image is a double page spread, wider than tall.
+func isSpread(img image.Image) bool {
+	return img.Bounds().Dx() > img.Bounds().Dy()
+}
+
+// spreadContainers applies the spread mode to a double page spread.
+func spreadContainers(page *manga.Page, img image.Image, format string, mode options.SpreadMode) ([]*manga.PageContainer, error) {
+	log.Debug().
+		Uint16("page_index", page.Index).
+		Int("width", img.Bounds().Dx()).
+		Int("height", img.Bounds().Dy()).
+		Str("spreads", string(mode)).
+		Msg("Double page spread detected")
+
+	switch mode {
+	case options.SpreadMark:
+		page.IsDoublePage = true
+		return []*manga.PageContainer{manga.NewContainer(page, img, format, true)}, nil
+	case options.SpreadRotate:
+		rotated := &manga.Page{Index: page.Index, Path: page.Path, IsModified: true}
+		return []*manga.PageContainer{manga.NewContainer(rotated, rotateClockwise(img), "N/A", true)}, nil
+	case options.SpreadSplitRTL, options.SpreadSplitLTR:
+		halves, err := splitSpread(img, mode == options.SpreadSplitRTL)
+		if err != nil {
+			return nil, fmt.Errorf("error splitting spread page %d: %w", page.Index, err)
+		}
+		containers := make([]*manga.PageContainer, len(halves))
+		for i, half := range halves {
+			newPage := &manga.Page{
+				Index:          page.Index,
+				Path:           page.Path,
+				IsSplitted:     true,
+				SplitPartIndex: uint16(i),
+			}
+			containers[i] = manga.NewContainer(newPage, half, "N/A", true)
+		}
+		return containers, nil
+	default:
+		return []*manga.PageContainer{manga.NewContainer(page, img, format, true)}, nil
+	}
+}
+
+// splitSpread cuts the spread in its two halves, in reading order.
+func splitSpread(img image.Image, rightToLeft bool) ([]image.Image, error) {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	leftWidth := width / 2
+
+	left, err := cutter.Crop(img, cutter.Config{Width: leftWidth, Height: height, Mode: cutter.TopLeft})
+	if err != nil {
+		return nil, err
+	}
+	right, err := cutter.Crop(img, cutter.Config{Width: width - leftWidth, Height: height, Anchor: image.Point{X: leftWidth}, Mode: cutter.TopLeft})
+	if err != nil {
+		return nil, err
+	}
+
+	if rightToLeft {
+		return []image.Image{right, left}, nil
+	}
+	return []image.Image{left, right}, nil
+}
+
+// rotateClockwise returns the image rotated by 90° clockwise.
+func rotateClockwise(img image.Image) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	rotated := image.NewRGBA(image.Rect(0, 0, height, width))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			rotated.Set(height-1-y, x, img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return rotated
+}
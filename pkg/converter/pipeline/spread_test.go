@@ -0,0 +1,99 @@
+package pipeline
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	leftColor  = color.RGBA{R: 255, A: 255}
+	rightColor = color.RGBA{B: 255, A: 255}
+)
+
+// newSpread returns a spread with a red left half and a blue right half.
+func newSpread(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < width/2 {
+				img.Set(x, y, leftColor)
+			} else {
+				img.Set(x, y, rightColor)
+			}
+		}
+	}
+	return img
+}
+
+func colorAt(img image.Image, x, y int) color.RGBA {
+	r, g, b, a := img.At(img.Bounds().Min.X+x, img.Bounds().Min.Y+y).RGBA()
+	return color.RGBA{R: uint8(r >> 8), G: uint8(g >> 8), B: uint8(b >> 8), A: uint8(a >> 8)}
+}
+
+func TestIsSpread(t *testing.T) {
+	assert.True(t, isSpread(newSpread(200, 100)))
+	assert.False(t, isSpread(newSpread(100, 200)))
+	assert.False(t, isSpread(newSpread(100, 100)))
+}
+
+func TestSpreadContainers(t *testing.T) {
+	tests := []struct {
+		name           string
+		mode           options.SpreadMode
+		expectedColors []color.RGBA
+		expectedSize   image.Point
+	}{
+		{name: "Right to left split", mode: options.SpreadSplitRTL, expectedColors: []color.RGBA{rightColor, leftColor}, expectedSize: image.Pt(101, 100)},
+		{name: "Left to right split", mode: options.SpreadSplitLTR, expectedColors: []color.RGBA{leftColor, rightColor}, expectedSize: image.Pt(101, 100)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := &manga.Page{Index: 7}
+			containers, err := spreadContainers(page, newSpread(202, 100), "png", tt.mode)
+			require.NoError(t, err)
+			require.Len(t, containers, 2)
+
+			for i, container := range containers {
+				assert.Equal(t, uint16(7), container.Page.Index)
+				assert.True(t, container.Page.IsSplitted)
+				assert.Equal(t, uint16(i), container.Page.SplitPartIndex)
+				assert.Equal(t, tt.expectedSize, container.Image.Bounds().Size())
+				assert.Equal(t, tt.expectedColors[i], colorAt(container.Image, 0, 0))
+				assert.Equal(t, tt.expectedColors[i], colorAt(container.Image, 100, 99))
+			}
+		})
+	}
+
+	t.Run("Rotate", func(t *testing.T) {
+		page := &manga.Page{Index: 3}
+		containers, err := spreadContainers(page, newSpread(200, 100), "png", options.SpreadRotate)
+		require.NoError(t, err)
+		require.Len(t, containers, 1)
+
+		rotated := containers[0]
+		assert.Equal(t, uint16(3), rotated.Page.Index)
+		assert.True(t, rotated.Page.IsModified)
+		assert.Nil(t, rotated.Page.Contents, "the original contents don't match the rotated image")
+		assert.Equal(t, image.Pt(100, 200), rotated.Image.Bounds().Size())
+		// Clockwise, the left half ends up on top
+		assert.Equal(t, leftColor, colorAt(rotated.Image, 50, 0))
+		assert.Equal(t, rightColor, colorAt(rotated.Image, 50, 199))
+	})
+
+	t.Run("Mark", func(t *testing.T) {
+		page := &manga.Page{Index: 3}
+		containers, err := spreadContainers(page, newSpread(200, 100), "png", options.SpreadMark)
+		require.NoError(t, err)
+		require.Len(t, containers, 1)
+		assert.Same(t, page, containers[0].Page)
+		assert.True(t, page.IsDoublePage)
+		assert.Equal(t, "png", containers[0].Format)
+	})
+}
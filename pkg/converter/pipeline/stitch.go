@@ -0,0 +1,154 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+	converterrors "github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// strip accumulates consecutive pages of the same width, cutting parts off its top as soon as a cut can be chosen.
+type strip struct {
+	first         *manga.Page
+	format        string
+	width         int
+	pages         int
+	cropHeight    int
+	maxPartHeight int
+	pending       *image.RGBA
+	parts         []image.Image
+}
+
+func newStrip(first *manga.Page, format string, width int, cropHeight int, maxPartHeight int) *strip {
+	return &strip{
+		first:         first,
+		format:        format,
+		width:         width,
+		cropHeight:    cropHeight,
+		maxPartHeight: maxPartHeight,
+		pending:       image.NewRGBA(image.Rect(0, 0, width, 0)),
+	}
+}
+
+// add appends the image below the pending rows and cuts the parts that can't move anymore.
+func (s *strip) add(img image.Image) {
+	pendingHeight := s.pending.Bounds().Dy()
+	stitched := image.NewRGBA(image.Rect(0, 0, s.width, pendingHeight+img.Bounds().Dy()))
+	draw.Draw(stitched, image.Rect(0, 0, s.width, pendingHeight), s.pending, s.pending.Bounds().Min, draw.Src)
+	draw.Draw(stitched, image.Rect(0, pendingHeight, s.width, stitched.Bounds().Dy()), img, img.Bounds().Min, draw.Src)
+	s.pending = stitched
+	s.pages++
+
+	// A cut is final once the whole search window below it is known
+	for s.pending.Bounds().Dy() > s.cropHeight+s.cropHeight/4 {
+		cut := nextCut(s.pending, 0, s.cropHeight, s.maxPartHeight)
+		bounds := s.pending.Bounds()
+		s.parts = append(s.parts, s.pending.SubImage(image.Rect(bounds.Min.X, bounds.Min.Y, bounds.Max.X, bounds.Min.Y+cut)))
+		s.pending = s.pending.SubImage(image.Rect(bounds.Min.X, bounds.Min.Y+cut, bounds.Max.X, bounds.Max.Y)).(*image.RGBA)
+	}
+}
+
+// containers cuts the remaining rows and returns the parts of the strip, numbered from the index of its first page.
+func (s *strip) containers() ([]*manga.PageContainer, error) {
+	if s.pending.Bounds().Dy() > 0 {
+		remaining, err := SmartCropImage(s.pending, s.cropHeight, s.maxPartHeight)
+		if err != nil {
+			return nil, err
+		}
+		s.parts = append(s.parts, remaining...)
+	}
+
+	// A lone page that isn't cut keeps its place and its format
+	if s.pages == 1 && len(s.parts) == 1 {
+		return []*manga.PageContainer{manga.NewContainer(s.first, s.parts[0], s.format, true)}, nil
+	}
+
+	log.Debug().
+		Uint16("first_page_index", s.first.Index).
+		Int("stitched_pages", s.pages).
+		Int("parts", len(s.parts)).
+		Msg("Strip stitched and re-cut")
+
+	containers := make([]*manga.PageContainer, len(s.parts))
+	for i, part := range s.parts {
+		page := &manga.Page{
+			Index:          s.first.Index,
+			Path:           s.first.Path,
+			IsSplitted:     true,
+			SplitPartIndex: uint16(i),
+		}
+		containers[i] = manga.NewContainer(page, part, "N/A", true)
+	}
+	return containers, nil
+}
+
+// StitchPages stitches consecutive pages of the same width into strips, re-cut at gutters into parts of about
+// cropHeight pixels, no part being taller than maxPartHeight (0 for no limit).
+//
+// The parts of a strip take the index of its first page and are numbered with SplitPartIndex, so the pages keep
+// sorting in reading order. A page that can't be decoded ends the strip and is kept as is, reported with a
+// PageIgnoredError.
+func StitchPages(pages []*manga.Page, cropHeight int, maxPartHeight int) ([]*manga.PageContainer, error) {
+	if maxPartHeight > 0 && cropHeight > maxPartHeight {
+		cropHeight = maxPartHeight
+	}
+
+	var containers []*manga.PageContainer
+	var errList []error
+	var current *strip
+
+	flush := func() error {
+		if current == nil {
+			return nil
+		}
+		stripContainers, err := current.containers()
+		if err != nil {
+			return fmt.Errorf("error cutting the strip starting at page %d: %w", current.first.Index, err)
+		}
+		containers = append(containers, stripContainers...)
+		current = nil
+		return nil
+	}
+
+	for _, page := range pages {
+		if format := animationFormat(page.Contents.Bytes()); format != "" {
+			log.Info().Uint16("page_index", page.Index).Str("format", format).Msg("Animated page kept as is, out of the strip")
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			containers = append(containers, manga.NewContainer(page, nil, format, false))
+			continue
+		}
+
+		img, format, err := DecodePage(page)
+		if err != nil {
+			log.Debug().Uint16("page_index", page.Index).Err(err).Msg("Failed to decode page image, keeping it out of the strip")
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			errList = append(errList, converterrors.NewPageIgnored(fmt.Sprintf("page %d can't be decoded, it is kept as is: %v", page.Index, err)))
+			containers = append(containers, manga.NewContainer(page, nil, format, false))
+			continue
+		}
+
+		width := img.Bounds().Dx()
+		if current != nil && current.width != width {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+		if current == nil {
+			current = newStrip(page, format, width, cropHeight, maxPartHeight)
+		}
+		current.add(img)
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	return containers, errors.Join(errList...)
+}
@@ -0,0 +1,135 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/constant"
+	converterrors "github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/errors"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slicePages cuts the image into PNG pages of sliceHeight pixels, indexed from firstIndex.
+func slicePages(t *testing.T, img *image.RGBA, sliceHeight int, firstIndex uint16) []*manga.Page {
+	var pages []*manga.Page
+	for y := 0; y < img.Bounds().Dy(); y += sliceHeight {
+		slice := img.SubImage(image.Rect(0, y, img.Bounds().Dx(), min(y+sliceHeight, img.Bounds().Dy())))
+		buf := new(bytes.Buffer)
+		require.NoError(t, png.Encode(buf, slice))
+		pages = append(pages, &manga.Page{Index: firstIndex + uint16(len(pages)), Contents: buf, Extension: ".png", Size: uint64(buf.Len())})
+	}
+	return pages
+}
+
+func TestStitchPages(t *testing.T) {
+	strip := stripWithGutters(50, 3500, [2]int{1880, 1920})
+	pages := slicePages(t, strip, 700, 3)
+
+	containers, err := StitchPages(pages, 1000, 0)
+	require.NoError(t, err)
+
+	heights := make([]int, len(containers))
+	for i, container := range containers {
+		heights[i] = container.Image.Bounds().Dy()
+		assert.Equal(t, uint16(3), container.Page.Index, "parts are numbered after the first slice")
+		assert.True(t, container.Page.IsSplitted)
+		assert.Equal(t, uint16(i), container.Page.SplitPartIndex)
+		assert.True(t, container.IsToBeConverted)
+	}
+	assert.Equal(t, []int{1000, 900, 1000, 600}, heights)
+
+	// The parts hold the rows of the strip, across the slice boundaries
+	second := containers[1].Image
+	assert.Equal(t, strip.At(7, 1000), second.At(second.Bounds().Min.X+7, second.Bounds().Min.Y))
+	assert.Equal(t, strip.At(7, 1401), second.At(second.Bounds().Min.X+7, second.Bounds().Min.Y+401))
+}
+
+func TestStitchPages_WidthChange(t *testing.T) {
+	pages := append(slicePages(t, stripWithGutters(50, 1400), 700, 0), slicePages(t, stripWithGutters(60, 700), 700, 2)...)
+
+	containers, err := StitchPages(pages, 1000, 0)
+	require.NoError(t, err)
+	require.Len(t, containers, 3)
+
+	assert.Equal(t, uint16(0), containers[0].Page.Index)
+	assert.Equal(t, uint16(0), containers[1].Page.Index)
+	assert.Equal(t, uint16(1), containers[1].Page.SplitPartIndex)
+	assert.Equal(t, 400, containers[1].Image.Bounds().Dy())
+
+	// A lone page keeps its place and format
+	assert.Same(t, pages[2], containers[2].Page)
+	assert.False(t, containers[2].Page.IsSplitted)
+	assert.Equal(t, "png", containers[2].Format)
+	assert.Equal(t, 60, containers[2].Image.Bounds().Dx())
+}
+
+func TestStitchPages_UndecodablePage(t *testing.T) {
+	pages := slicePages(t, stripWithGutters(50, 2100), 700, 0)
+	broken := &manga.Page{Index: 1, Contents: bytes.NewBufferString("not an image"), Extension: ".png"}
+	pages = []*manga.Page{pages[0], broken, pages[1], pages[2]}
+	pages[2].Index, pages[3].Index = 2, 3
+
+	containers, err := StitchPages(pages, 1000, 0)
+	var pageIgnoredError *converterrors.PageIgnoredError
+	assert.True(t, errors.As(err, &pageIgnoredError))
+	require.Len(t, containers, 4)
+
+	assert.Same(t, pages[0], containers[0].Page)
+	assert.Same(t, broken, containers[1].Page)
+	assert.False(t, containers[1].IsToBeConverted)
+	assert.Equal(t, uint16(2), containers[2].Page.Index)
+	assert.Equal(t, 1000, containers[2].Image.Bounds().Dy())
+	assert.Equal(t, 400, containers[3].Image.Bounds().Dy())
+}
+
+func TestStitchPages_MaxPartHeight(t *testing.T) {
+	pages := slicePages(t, stripWithGutters(50, 3000, [2]int{1180, 1220}), 500, 0)
+
+	containers, err := StitchPages(pages, 2000, 1100)
+	require.NoError(t, err)
+	for _, container := range containers {
+		assert.LessOrEqual(t, container.Image.Bounds().Dy(), 1100)
+	}
+}
+
+func TestRun_StitchCancelled(t *testing.T) {
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	img := image.NewGray(image.Rect(0, 0, 10, 10))
+	stages := &Stages{
+		Format: constant.WebP,
+		Stitch: func(pages []*manga.Page) ([]*manga.PageContainer, error) {
+			var containers []*manga.PageContainer
+			for i := range 4 * runtime.NumCPU() {
+				containers = append(containers, manga.NewContainer(&manga.Page{Index: uint16(i)}, img, "N/A", true))
+			}
+			return containers, errors.New("one slice kept as is")
+		},
+		ConvertPage: func(container *manga.PageContainer) (*manga.PageContainer, error) {
+			// The conversion is cancelled while the first pages are being converted
+			cancel()
+			return container, nil
+		},
+	}
+	converted, err := Run(ctx, &manga.Chapter{}, &options.ConvertOptions{Stitch: true}, stages, func(string, uint32, uint32) {})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, converted)
+
+	// The workers and the error collector stop once the conversions left noticed the cancellation
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before, "goroutines left running")
+}
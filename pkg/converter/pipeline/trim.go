@@ -0,0 +1,170 @@
+package pipeline
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/oliamb/cutter"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// minBorderLines is the thinnest border trimmed, thinner bands are taken as part of the art.
+	minBorderLines = 4
+	// minBorderSides is the number of sides that must show a border of the same color for the page to be trimmed.
+	// Art bleeding off the page rarely leaves matching uniform bands on two of its edges, scanner borders do.
+	minBorderSides = 2
+	// borderOutlierRatio allows one pixel in borderOutlierRatio of a border line to be off the border color,
+	// for the dust and noise of the scans.
+	borderOutlierRatio = 100
+	// maxTrimAspectChange is the largest relative change of the width to height ratio of a trimmed page.
+	maxTrimAspectChange = 0.25
+)
+
+// border is a band of uniform color along one side of a page.
+type border struct {
+	depth int
+	luma  uint8
+}
+
+// trimPage crops the uniform borders of the page. Returns the page and image to convert, the originals when the
+// page is kept as is.
+func trimPage(page *manga.Page, img image.Image, trim *options.Trim) (*manga.Page, image.Image, error) {
+	bounds := trimBounds(img, trim)
+	if bounds == img.Bounds() {
+		return page, img, nil
+	}
+
+	trimmed, err := cutter.Crop(img, cutter.Config{
+		Width:  bounds.Dx(),
+		Height: bounds.Dy(),
+		Anchor: bounds.Min.Sub(img.Bounds().Min),
+		Mode:   cutter.TopLeft,
+	})
+	if err != nil {
+		return page, img, fmt.Errorf("error trimming page %d: %w", page.Index, err)
+	}
+
+	log.Debug().
+		Uint16("page_index", page.Index).
+		Int("original_width", img.Bounds().Dx()).
+		Int("original_height", img.Bounds().Dy()).
+		Int("width", bounds.Dx()).
+		Int("height", bounds.Dy()).
+		Msg("Page borders trimmed")
+
+	trimmedPage := *page
+	trimmedPage.Contents = nil
+	trimmedPage.Size = 0
+	trimmedPage.IsModified = true
+	return &trimmedPage, trimmed, nil
+}
+
+// trimBounds returns the bounds of the image without its borders, or the image bounds when it shouldn't be trimmed.
+func trimBounds(img image.Image, trim *options.Trim) image.Rectangle {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 || isSpread(img) {
+		return bounds
+	}
+
+	tolerance := trim.BorderTolerance()
+	maxWidth := width * trim.MaxSidePercent() / 100
+	maxHeight := height * trim.MaxSidePercent() / 100
+	sides := []border{
+		findBorder(width, maxHeight, tolerance, func(line, i int) uint8 { return lumaAt(img, bounds.Min.X+i, bounds.Min.Y+line) }),
+		findBorder(width, maxHeight, tolerance, func(line, i int) uint8 { return lumaAt(img, bounds.Min.X+i, bounds.Max.Y-1-line) }),
+		findBorder(height, maxWidth, tolerance, func(line, i int) uint8 { return lumaAt(img, bounds.Min.X+line, bounds.Min.Y+i) }),
+		findBorder(height, maxWidth, tolerance, func(line, i int) uint8 { return lumaAt(img, bounds.Max.X-1-line, bounds.Min.Y+i) }),
+	}
+
+	// Keep the borders of the color shared by most sides, the others are art
+	best, bestCount := border{}, 0
+	for _, side := range sides {
+		count := 0
+		for _, other := range sides {
+			if side.depth > 0 && other.depth > 0 && absDiff(side.luma, other.luma) <= tolerance {
+				count++
+			}
+		}
+		if count > bestCount {
+			best, bestCount = side, count
+		}
+	}
+	if bestCount < minBorderSides {
+		return bounds
+	}
+	for i, side := range sides {
+		if side.depth == 0 || absDiff(side.luma, best.luma) > tolerance {
+			sides[i].depth = 0
+		}
+	}
+
+	trimmed := image.Rect(
+		bounds.Min.X+sides[2].depth,
+		bounds.Min.Y+sides[0].depth,
+		bounds.Max.X-sides[3].depth,
+		bounds.Max.Y-sides[1].depth,
+	)
+
+	// A trimmed page must still look like the page it was
+	aspect := float64(width) / float64(height)
+	trimmedAspect := float64(trimmed.Dx()) / float64(trimmed.Dy())
+	if trimmed.Dx() > trimmed.Dy() || trimmedAspect < aspect*(1-maxTrimAspectChange) || trimmedAspect > aspect*(1+maxTrimAspectChange) {
+		log.Debug().
+			Int("width", width).
+			Int("height", height).
+			Int("trimmed_width", trimmed.Dx()).
+			Int("trimmed_height", trimmed.Dy()).
+			Msg("Page not trimmed, the aspect ratio would change too much")
+		return bounds
+	}
+	return trimmed
+}
+
+// findBorder measures the border along one side, walking the lines from the edge inwards. The border color is the
+// dominant luma of the outermost line, the border ends at the first line that doesn't match it.
+func findBorder(length int, maxDepth int, tolerance int, luma func(line, i int) uint8) border {
+	if maxDepth < minBorderLines {
+		return border{}
+	}
+
+	var histogram [256]int
+	for i := 0; i < length; i++ {
+		histogram[luma(0, i)]++
+	}
+	var color uint8
+	for value, count := range histogram {
+		if count > histogram[color] {
+			color = uint8(value)
+		}
+	}
+
+	maxOutliers := length / borderOutlierRatio
+	depth := 0
+	for ; depth < maxDepth; depth++ {
+		outliers := 0
+		for i := 0; i < length && outliers <= maxOutliers; i++ {
+			if absDiff(luma(depth, i), color) > tolerance {
+				outliers++
+			}
+		}
+		if outliers > maxOutliers {
+			break
+		}
+	}
+
+	if depth < minBorderLines {
+		return border{}
+	}
+	return border{depth: depth, luma: color}
+}
+
+func absDiff(a, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
@@ -0,0 +1,113 @@
+package pipeline
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scannedPage returns a page whose art, a noisy pattern, fills the given rectangle over a background of the given luma.
+func scannedPage(width, height int, art image.Rectangle, background uint8) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.Gray{Y: background}), image.Point{}, draw.Src)
+	for y := art.Min.Y; y < art.Max.Y; y++ {
+		for x := art.Min.X; x < art.Max.X; x++ {
+			img.SetGray(x, y, color.Gray{Y: uint8((x*7 + y*13) % 256)})
+		}
+	}
+	return img
+}
+
+func TestTrimBounds(t *testing.T) {
+	tests := []struct {
+		name     string
+		img      image.Image
+		trim     options.Trim
+		expected image.Rectangle
+	}{
+		{
+			name:     "White scanner borders",
+			img:      scannedPage(400, 600, image.Rect(20, 30, 380, 570), 255),
+			expected: image.Rect(20, 30, 380, 570),
+		},
+		{
+			name:     "Black borders on two sides",
+			img:      scannedPage(400, 600, image.Rect(0, 0, 370, 560), 0),
+			expected: image.Rect(0, 0, 370, 560),
+		},
+		{
+			name:     "Trim capped by the max percent",
+			img:      scannedPage(400, 600, image.Rect(100, 150, 300, 450), 255),
+			trim:     options.Trim{MaxPercent: 10},
+			expected: image.Rect(40, 60, 360, 540),
+		},
+		{
+			name:     "Full bleed art",
+			img:      scannedPage(400, 600, image.Rect(0, 0, 400, 600), 255),
+			expected: image.Rect(0, 0, 400, 600),
+		},
+		{
+			name:     "Single uniform side is taken as art",
+			img:      scannedPage(400, 600, image.Rect(0, 50, 400, 600), 255),
+			expected: image.Rect(0, 0, 400, 600),
+		},
+		{
+			name:     "Thin border is kept",
+			img:      scannedPage(400, 600, image.Rect(2, 2, 398, 598), 255),
+			expected: image.Rect(0, 0, 400, 600),
+		},
+		{
+			name:     "Spreads are not trimmed",
+			img:      scannedPage(800, 600, image.Rect(20, 20, 780, 580), 255),
+			expected: image.Rect(0, 0, 800, 600),
+		},
+		{
+			name:     "Aspect ratio change too large",
+			img:      scannedPage(400, 600, image.Rect(120, 0, 280, 600), 255),
+			trim:     options.Trim{MaxPercent: options.MaxTrimPercent},
+			expected: image.Rect(0, 0, 400, 600),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, trimBounds(tt.img, &tt.trim))
+		})
+	}
+}
+
+func TestTrimBounds_IgnoresDust(t *testing.T) {
+	img := scannedPage(400, 600, image.Rect(20, 30, 380, 570), 255)
+	img.SetGray(200, 5, color.Gray{Y: 0})
+	img.SetGray(5, 300, color.Gray{Y: 0})
+
+	assert.Equal(t, image.Rect(20, 30, 380, 570), trimBounds(img, &options.Trim{}))
+}
+
+func TestTrimPage(t *testing.T) {
+	page := &manga.Page{Index: 4, Extension: ".jpg", Size: 100}
+	img := scannedPage(400, 600, image.Rect(20, 30, 380, 570), 255)
+
+	trimmedPage, trimmed, err := trimPage(page, img, &options.Trim{Enabled: true})
+	require.NoError(t, err)
+	assert.Equal(t, image.Pt(360, 540), trimmed.Bounds().Size())
+	assert.Equal(t, uint16(4), trimmedPage.Index)
+	assert.True(t, trimmedPage.IsModified)
+	assert.Nil(t, trimmedPage.Contents)
+	assert.False(t, page.IsModified, "the original page is left alone")
+
+	// The art starts at the top left corner of the trimmed page
+	assert.Equal(t, lumaAt(img, 20, 30), lumaAt(trimmed, trimmed.Bounds().Min.X, trimmed.Bounds().Min.Y))
+
+	fullBleed := scannedPage(400, 600, image.Rect(0, 0, 400, 600), 255)
+	keptPage, kept, err := trimPage(page, fullBleed, &options.Trim{Enabled: true})
+	require.NoError(t, err)
+	assert.Same(t, page, keptPage)
+	assert.Equal(t, fullBleed.Bounds(), kept.Bounds())
+}
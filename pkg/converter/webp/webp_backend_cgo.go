@@ -0,0 +1,130 @@
+//go:build libwebp && cgo
+
+package webp
+
+/*
+#cgo pkg-config: libwebp
+#include <stdlib.h>
+#include <webp/encode.h>
+
+// cbz_webp_encode encodes RGBA pixels with the advanced API, the output has to be released with WebPFree.
+// A negative near_lossless disables the near lossless encoding.
+static int cbz_webp_encode(const uint8_t* rgba, int width, int height, int stride,
+		float quality, int lossless, int method, int preset, int sharp_yuv, int autofilter, int near_lossless,
+		uint8_t** output, size_t* size) {
+	WebPConfig config;
+	WebPPicture picture;
+	WebPMemoryWriter writer;
+	int ok;
+
+	if (!WebPConfigPreset(&config, (WebPPreset)preset, quality)) {
+		return 0;
+	}
+	config.lossless = lossless;
+	config.method = method;
+	config.use_sharp_yuv = sharp_yuv;
+	config.autofilter = autofilter;
+	if (near_lossless >= 0) {
+		// Like cwebp, near lossless implies the lossless mode
+		config.lossless = 1;
+		config.near_lossless = near_lossless;
+	}
+	if (!WebPValidateConfig(&config) || !WebPPictureInit(&picture)) {
+		return 0;
+	}
+
+	picture.use_argb = 1;
+	picture.width = width;
+	picture.height = height;
+	if (!WebPPictureImportRGBA(&picture, rgba, stride)) {
+		return 0;
+	}
+	WebPMemoryWriterInit(&writer);
+	picture.writer = WebPMemoryWrite;
+	picture.custom_ptr = &writer;
+
+	ok = WebPEncode(&config, &picture);
+	WebPPictureFree(&picture);
+	if (!ok) {
+		WebPMemoryWriterClear(&writer);
+		return 0;
+	}
+	*output = writer.mem;
+	*size = writer.size;
+	return 1;
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+	"slices"
+	"unsafe"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/options"
+)
+
+func init() {
+	backends = append([]Backend{&cgoBackend{}}, backends...)
+}
+
+// cgoBackend links against the system libwebp, only built with the libwebp build tag.
+type cgoBackend struct{}
+
+func (b *cgoBackend) Name() string {
+	return "cgo"
+}
+
+func (b *cgoBackend) Prepare() error {
+	if C.WebPGetEncoderVersion() == 0 {
+		return errors.New("libwebp encoder not available")
+	}
+	return nil
+}
+
+func (b *cgoBackend) SupportsTuning() bool {
+	return true
+}
+
+func (b *cgoBackend) Encode(w io.Writer, m image.Image, encodeOptions EncodeOptions) error {
+	img, ok := m.(*image.NRGBA)
+	if !ok {
+		img = image.NewNRGBA(m.Bounds())
+		draw.Draw(img, img.Bounds(), m, m.Bounds().Min, draw.Src)
+	}
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	if width == 0 || height == 0 {
+		return errors.New("can't encode an empty image")
+	}
+
+	// The presets are listed in the order of the WebPPreset enum, no preset is the default one
+	preset := max(slices.Index(options.WebPPresets, encodeOptions.Tuning.Preset), 0)
+	nearLossless := -1
+	if encodeOptions.Tuning.NearLossless != nil {
+		nearLossless = *encodeOptions.Tuning.NearLossless
+	}
+
+	pix := (*C.uint8_t)(unsafe.Pointer(&img.Pix[img.PixOffset(img.Bounds().Min.X, img.Bounds().Min.Y)]))
+	var output *C.uint8_t
+	var size C.size_t
+	if C.cbz_webp_encode(pix, C.int(width), C.int(height), C.int(img.Stride),
+		C.float(encodeOptions.Quality), cBool(encodeOptions.Lossless), C.int(encodeOptions.Method), C.int(preset),
+		cBool(encodeOptions.Tuning.SharpYUV), cBool(encodeOptions.Tuning.AutoFilter), C.int(nearLossless),
+		&output, &size) == 0 {
+		return errors.New("libwebp failed to encode the image")
+	}
+	defer C.WebPFree(unsafe.Pointer(output))
+
+	_, err := w.Write(C.GoBytes(unsafe.Pointer(output), C.int(size)))
+	return err
+}
+
+func cBool(value bool) C.int {
+	if value {
+		return 1
+	}
+	return 0
+}
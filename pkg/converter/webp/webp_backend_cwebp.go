@@ -0,0 +1,65 @@
+package webp
+
+import (
+	"image"
+	"io"
+	"strconv"
+
+	"github.com/danielkitchener/go-webpbin/v2"
+)
+
+const libwebpVersion = "1.6.0"
+
+// cwebpBackend runs the cwebp binary, downloading it on first use.
+type cwebpBackend struct{}
+
+func (b *cwebpBackend) Name() string {
+	return "cwebp"
+}
+
+func (b *cwebpBackend) Prepare() error {
+	webpbin.SetLibVersion(libwebpVersion)
+	container := webpbin.NewCWebP()
+	return container.BinWrapper.Run()
+}
+
+func (b *cwebpBackend) SupportsTuning() bool {
+	return true
+}
+
+func (b *cwebpBackend) Encode(w io.Writer, m image.Image, options EncodeOptions) error {
+	var webp = webpbin.NewCWebP()
+
+	if options.Lossless {
+		webp.Lossless()
+	} else {
+		webp.Quality(options.Quality)
+	}
+	for _, arg := range cwebpArgs(options) {
+		webp.Arg(arg[0], arg[1:]...)
+	}
+	return webp.
+		InputImage(m).
+		Output(w).
+		Run()
+}
+
+// cwebpArgs returns the cwebp arguments, with their values, for the method and the tuning.
+// The preset comes first as cwebp requires.
+func cwebpArgs(options EncodeOptions) [][]string {
+	var args [][]string
+	if options.Tuning.Preset != "" {
+		args = append(args, []string{"-preset", options.Tuning.Preset})
+	}
+	args = append(args, []string{"-m", strconv.Itoa(options.Method)})
+	if options.Tuning.SharpYUV {
+		args = append(args, []string{"-sharp_yuv"})
+	}
+	if options.Tuning.AutoFilter {
+		args = append(args, []string{"-af"})
+	}
+	if options.Tuning.NearLossless != nil {
+		args = append(args, []string{"-near_lossless", strconv.Itoa(*options.Tuning.NearLossless)})
+	}
+	return args
+}
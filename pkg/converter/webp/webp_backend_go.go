@@ -0,0 +1,33 @@
+package webp
+
+import (
+	"image"
+	"io"
+
+	gowebp "github.com/gen2brain/webp"
+)
+
+// goBackend encodes in-process with libwebp transpiled to Go, or the system libwebp when it can be loaded.
+// It doesn't need cgo nor network access.
+type goBackend struct{}
+
+func (b *goBackend) Name() string {
+	return "go"
+}
+
+func (b *goBackend) Prepare() error {
+	return gowebp.Encode(io.Discard, image.NewGray(image.Rect(0, 0, 1, 1)), gowebp.Options{Lossless: true})
+}
+
+// SupportsTuning is false, the in-process encoder only exposes the quality and the method.
+func (b *goBackend) SupportsTuning() bool {
+	return false
+}
+
+func (b *goBackend) Encode(w io.Writer, m image.Image, options EncodeOptions) error {
+	return gowebp.Encode(w, m, gowebp.Options{
+		Quality:  int(options.Quality),
+		Lossless: options.Lossless,
+		Method:   options.Method,
+	})
+}
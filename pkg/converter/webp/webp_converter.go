@@ -3,21 +3,18 @@ package webp
 import (
 	"bytes"
 	"context"
-	"errors"
 	"fmt"
 	"image"
 	_ "image/jpeg"
-	"image/png"
+	_ "image/png"
 	"runtime"
-	"sync"
-	"sync/atomic"
 
 	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
 	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/constant"
 	converterrors "github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/errors"
-	"github.com/oliamb/cutter"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/pipeline"
 	"github.com/rs/zerolog/log"
-	"golang.org/x/exp/slices"
 	_ "golang.org/x/image/webp"
 )
 
@@ -26,6 +23,9 @@ const webpMaxHeight = 16383
 type Converter struct {
 	maxHeight  int
 	cropHeight int
+	splitMode  options.SplitMode
+	method     int
+	tuning     options.WebPTuning
 	isPrepared bool
 }
 
@@ -38,12 +38,14 @@ func New() *Converter {
 		//maxHeight: 16383 / 2,
 		maxHeight:  4000,
 		cropHeight: 2000,
+		method:     DefaultMethod,
 		isPrepared: false,
 	}
 }
 
 func (converter *Converter) PrepareConverter() error {
-	if converter.isPrepared {
+	// SetBackend drops the prepared backend when another one is selected
+	if converter.isPrepared && CurrentBackend() != "" {
 		return nil
 	}
 	err := PrepareEncoder()
@@ -54,296 +56,87 @@ func (converter *Converter) PrepareConverter() error {
 	return nil
 }
 
-func (converter *Converter) ConvertChapter(ctx context.Context, chapter *manga.Chapter, quality uint8, lossless bool, split bool, progress func(message string, current uint32, total uint32)) (*manga.Chapter, error) {
+// Backend returns the name of the encoder backend picked by PrepareConverter.
+func (converter *Converter) Backend() string {
+	return CurrentBackend()
+}
+
+func (converter *Converter) ConvertChapter(ctx context.Context, chapter *manga.Chapter, opts *options.ConvertOptions, progress func(message string, current uint32, total uint32)) (*manga.Chapter, error) {
+	err := opts.Validate()
+	if err != nil {
+		return nil, err
+	}
+	converter = converter.withOptions(opts)
+
 	log.Debug().
 		Str("chapter", chapter.FilePath).
 		Int("pages", len(chapter.Pages)).
-		Uint8("quality", quality).
-		Bool("split", split).
+		Uint8("quality", opts.Quality).
+		Bool("lossless", opts.Lossless).
+		Bool("split", opts.Split).
+		Str("split_mode", string(converter.splitMode)).
+		Str("spreads", string(opts.Spreads)).
+		Bool("stitch", opts.Stitch).
+		Int("max_height", converter.maxHeight).
+		Int("crop_height", converter.cropHeight).
+		Int("method", converter.method).
+		Str("preset", converter.tuning.Preset).
+		Bool("sharp_yuv", converter.tuning.SharpYUV).
+		Bool("auto_filter", converter.tuning.AutoFilter).
+		Any("near_lossless", converter.tuning.NearLossless).
 		Int("max_goroutines", runtime.NumCPU()).
 		Msg("Starting chapter conversion")
 
-	err := converter.PrepareConverter()
+	err = converter.PrepareConverter()
 	if err != nil {
 		log.Error().Str("chapter", chapter.FilePath).Err(err).Msg("Failed to prepare converter")
 		return nil, err
 	}
-
-	var wgConvertedPages sync.WaitGroup
-	maxGoroutines := runtime.NumCPU()
-
-	pagesChan := make(chan *manga.PageContainer, maxGoroutines)
-	errChan := make(chan error, maxGoroutines)
-	doneChan := make(chan struct{})
-
-	var wgPages sync.WaitGroup
-	wgPages.Add(len(chapter.Pages))
-
-	guard := make(chan struct{}, maxGoroutines)
-	pagesMutex := sync.Mutex{}
-	var pages []*manga.Page
-	var totalPages = uint32(len(chapter.Pages))
-
-	log.Debug().
-		Str("chapter", chapter.FilePath).
-		Int("total_pages", len(chapter.Pages)).
-		Int("worker_count", maxGoroutines).
-		Msg("Initialized conversion worker pool")
-
-	// Check if context is already cancelled
-	select {
-	case <-ctx.Done():
-		log.Warn().Str("chapter", chapter.FilePath).Msg("Chapter conversion cancelled due to timeout")
-		return nil, ctx.Err()
-	default:
-	}
-
-	// Start the worker pool
-	go func() {
-		defer close(doneChan)
-		for page := range pagesChan {
-			select {
-			case <-ctx.Done():
-				return
-			case guard <- struct{}{}: // would block if guard channel is already filled
-			}
-
-			go func(pageToConvert *manga.PageContainer) {
-				defer func() {
-					wgConvertedPages.Done()
-					<-guard
-				}()
-
-				// Check context cancellation before processing
-				select {
-				case <-ctx.Done():
-					return
-				default:
-				}
-
-				convertedPage, err := converter.convertPage(pageToConvert, quality, lossless)
-				if err != nil {
-					if convertedPage == nil {
-						select {
-						case errChan <- err:
-						case <-ctx.Done():
-							return
-						}
-						return
-					}
-					buffer := new(bytes.Buffer)
-					err := png.Encode(buffer, convertedPage.Image)
-					if err != nil {
-						select {
-						case errChan <- err:
-						case <-ctx.Done():
-							return
-						}
-						return
-					}
-					convertedPage.Page.Contents = buffer
-					convertedPage.Page.Extension = ".png"
-					convertedPage.Page.Size = uint64(buffer.Len())
-				}
-				pagesMutex.Lock()
-				pages = append(pages, convertedPage.Page)
-				progress(fmt.Sprintf("Converted %d/%d pages to %s format", len(pages), totalPages, converter.Format()), uint32(len(pages)), totalPages)
-				pagesMutex.Unlock()
-			}(page)
-		}
-	}()
-
-	// Process pages
-	for _, page := range chapter.Pages {
-		select {
-		case <-ctx.Done():
-			log.Warn().Str("chapter", chapter.FilePath).Msg("Chapter conversion cancelled due to timeout")
-			return nil, ctx.Err()
-		default:
+	log.Debug().Str("chapter", chapter.FilePath).Str("backend", converter.Backend()).Msg("Using WebP encoder backend")
+	if !converter.tuning.IsZero() {
+		err = PrepareTuning()
+		if err != nil {
+			log.Error().Str("chapter", chapter.FilePath).Str("backend", converter.Backend()).Err(err).Msg("WebP encoder backend doesn't support the tuning options")
+			return nil, err
 		}
-
-		go func(page *manga.Page) {
-			defer wgPages.Done()
-
-			splitNeeded, img, format, err := converter.checkPageNeedsSplit(page, split)
-			if err != nil {
-				select {
-				case errChan <- err:
-				case <-ctx.Done():
-					return
-				}
-				if img != nil {
-					wgConvertedPages.Add(1)
-					select {
-					case pagesChan <- manga.NewContainer(page, img, format, false):
-					case <-ctx.Done():
-						return
-					}
-				}
-				return
-			}
-
-			if !splitNeeded {
-				wgConvertedPages.Add(1)
-				select {
-				case pagesChan <- manga.NewContainer(page, img, format, true):
-				case <-ctx.Done():
-					return
-				}
-				return
-			}
-
-			images, err := converter.cropImage(img)
-			if err != nil {
-				select {
-				case errChan <- err:
-				case <-ctx.Done():
-					return
-				}
-				return
-			}
-
-			atomic.AddUint32(&totalPages, uint32(len(images)-1))
-			for i, img := range images {
-				select {
-				case <-ctx.Done():
-					return
-				default:
-				}
-
-				newPage := &manga.Page{
-					Index:          page.Index,
-					IsSplitted:     true,
-					SplitPartIndex: uint16(i),
-				}
-				wgConvertedPages.Add(1)
-				select {
-				case pagesChan <- manga.NewContainer(newPage, img, "N/A", true):
-				case <-ctx.Done():
-					return
-				}
-			}
-		}(page)
 	}
 
-	wgPages.Wait()
-	close(pagesChan)
-
-	// Wait for all conversions to complete or context cancellation
-	done := make(chan struct{})
-	go func() {
-		defer close(done)
-		wgConvertedPages.Wait()
-	}()
-
-	select {
-	case <-done:
-		// Conversion completed successfully
-	case <-ctx.Done():
-		log.Warn().Str("chapter", chapter.FilePath).Msg("Chapter conversion cancelled due to timeout")
-		return nil, ctx.Err()
+	stages := &pipeline.Stages{
+		Format:              converter.Format(),
+		CheckPageNeedsSplit: converter.checkPageNeedsSplit,
+		CropImage:           converter.cropImage,
+		ConvertPage: func(container *manga.PageContainer) (*manga.PageContainer, error) {
+			return converter.convertPage(container, opts.Quality, opts.Lossless)
+		},
+		ConvertAnimation: func(container *manga.PageContainer) (*manga.PageContainer, error) {
+			return converter.convertAnimation(container, opts.Quality, opts.Lossless)
+		},
 	}
-
-	close(errChan)
-	close(guard)
-
-	var errList []error
-	for err := range errChan {
-		errList = append(errList, err)
-	}
-
-	var aggregatedError error = nil
-	if len(errList) > 0 {
-		aggregatedError = errors.Join(errList...)
-		log.Debug().
-			Str("chapter", chapter.FilePath).
-			Int("error_count", len(errList)).
-			Msg("Conversion completed with errors")
-	} else {
-		log.Debug().
-			Str("chapter", chapter.FilePath).
-			Int("pages_converted", len(pages)).
-			Msg("Conversion completed successfully")
+	if opts.Stitch {
+		stages.Stitch = converter.stitchPages
 	}
 
-	slices.SortFunc(pages, func(a, b *manga.Page) int {
-		if a.Index == b.Index {
-			return int(a.SplitPartIndex) - int(b.SplitPartIndex)
-		}
-		return int(a.Index) - int(b.Index)
-	})
-	chapter.Pages = pages
-
-	log.Debug().
-		Str("chapter", chapter.FilePath).
-		Int("final_page_count", len(pages)).
-		Msg("Pages sorted and chapter updated")
-
-	runtime.GC()
-	log.Debug().Str("chapter", chapter.FilePath).Msg("Garbage collection completed")
+	return pipeline.Run(ctx, chapter, opts, stages, progress)
+}
 
-	return chapter, aggregatedError
+// withOptions returns a copy of the converter using the heights, split mode, effort and tuning of the options.
+func (converter *Converter) withOptions(opts *options.ConvertOptions) *Converter {
+	configured := *converter
+	configured.maxHeight, configured.cropHeight = opts.Heights(converter.maxHeight, converter.cropHeight)
+	configured.splitMode = opts.SplitMode
+	configured.method = opts.ScaleEffort(0, 6, converter.method)
+	configured.tuning = opts.WebP
+	return &configured
 }
 
 func (converter *Converter) cropImage(img image.Image) ([]image.Image, error) {
-	bounds := img.Bounds()
-	height := bounds.Dy()
-	width := bounds.Dx()
-
-	numParts := height / converter.cropHeight
-	if height%converter.cropHeight != 0 {
-		numParts++
-	}
-
-	log.Debug().
-		Int("original_width", width).
-		Int("original_height", height).
-		Int("crop_height", converter.cropHeight).
-		Int("num_parts", numParts).
-		Msg("Starting image cropping for page splitting")
-
-	parts := make([]image.Image, numParts)
-
-	for i := 0; i < numParts; i++ {
-		partHeight := converter.cropHeight
-		if i == numParts-1 {
-			partHeight = height - i*converter.cropHeight
-		}
-
-		log.Debug().
-			Int("part_index", i).
-			Int("part_height", partHeight).
-			Int("y_offset", i*converter.cropHeight).
-			Msg("Cropping image part")
-
-		part, err := cutter.Crop(img, cutter.Config{
-			Width:  bounds.Dx(),
-			Height: partHeight,
-			Anchor: image.Point{Y: i * converter.cropHeight},
-			Mode:   cutter.TopLeft,
-		})
-		if err != nil {
-			log.Error().
-				Int("part_index", i).
-				Err(err).
-				Msg("Failed to crop image part")
-			return nil, fmt.Errorf("error cropping part %d: %v", i+1, err)
-		}
-
-		parts[i] = part
-
-		log.Debug().
-			Int("part_index", i).
-			Int("cropped_width", part.Bounds().Dx()).
-			Int("cropped_height", part.Bounds().Dy()).
-			Msg("Image part cropped successfully")
-	}
-
-	log.Debug().
-		Int("total_parts", len(parts)).
-		Msg("Image cropping completed")
+	// Parts stay below the height from which checkPageNeedsSplit ignores a page
+	return pipeline.SplitImage(img, converter.splitMode, converter.cropHeight, webpMaxHeight-1)
+}
 
-	return parts, nil
+// stitchPages re-cuts the chapter into parts of about cropHeight, below the height from which a page is ignored.
+func (converter *Converter) stitchPages(pages []*manga.Page) ([]*manga.PageContainer, error) {
+	return pipeline.StitchPages(pages, converter.cropHeight, webpMaxHeight-1)
 }
 
 func (converter *Converter) checkPageNeedsSplit(page *manga.Page, splitRequested bool) (bool, image.Image, string, error) {
@@ -353,8 +146,7 @@ func (converter *Converter) checkPageNeedsSplit(page *manga.Page, splitRequested
 		Int("page_size", len(page.Contents.Bytes())).
 		Msg("Analyzing page for splitting")
 
-	reader := bytes.NewBuffer(page.Contents.Bytes())
-	img, format, err := image.Decode(reader)
+	img, format, err := pipeline.DecodePage(page)
 	if err != nil {
 		log.Debug().Uint16("page_index", page.Index).Err(err).Msg("Failed to decode page image")
 		return false, nil, format, err
@@ -439,12 +231,38 @@ func (converter *Converter) convertPage(container *manga.PageContainer, quality
 	return container, nil
 }
 
+// convertAnimation encodes the frames of the container to an animated WebP file.
+func (converter *Converter) convertAnimation(container *manga.PageContainer, quality uint8, lossless bool) (*manga.PageContainer, error) {
+	log.Debug().
+		Uint16("page_index", container.Page.Index).
+		Int("frames", len(container.Animation.Frames)).
+		Uint8("quality", quality).
+		Msg("Encoding animated page to WebP format")
+
+	var buf bytes.Buffer
+	err := EncodeAnimation(&buf, container.Animation, EncodeOptions{
+		Quality:  uint(quality),
+		Lossless: lossless,
+		Method:   converter.method,
+	})
+	if err != nil {
+		return nil, err
+	}
+	container.SetConverted(&buf, ".webp")
+	return container, nil
+}
+
 // convert converts an image to the WebP format. It decodes the image from the input buffer,
 // encodes it as a WebP file using the webp.Encode() function, and returns the resulting WebP
 // file as a bytes.Buffer.
 func (converter *Converter) convert(image image.Image, quality uint, lossless bool) (*bytes.Buffer, error) {
 	var buf bytes.Buffer
-	err := Encode(&buf, image, quality, lossless)
+	err := EncodeWithOptions(&buf, image, EncodeOptions{
+		Quality:  quality,
+		Lossless: lossless,
+		Method:   converter.method,
+		Tuning:   converter.tuning,
+	})
 	if err != nil {
 		return nil, err
 	}
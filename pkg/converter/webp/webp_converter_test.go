@@ -3,10 +3,17 @@ package webp
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"image"
 	"image/color"
+	"image/draw"
+	"image/gif"
 	"image/jpeg"
 	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
 	"sync"
 	"testing"
 
@@ -14,6 +21,8 @@ import (
 
 	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
 	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/constant"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/options"
+	gowebp "github.com/gen2brain/webp"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -172,7 +181,7 @@ func TestConverter_ConvertChapter(t *testing.T) {
 				assert.LessOrEqual(t, current, total, "Current progress should not exceed total")
 			}
 
-			convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, 80, false, tt.split, progress)
+			convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, &options.ConvertOptions{Quality: 80, Split: tt.split}, progress)
 
 			if tt.expectError {
 				assert.Error(t, err)
@@ -356,10 +365,650 @@ func TestConverter_ConvertChapter_Timeout(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 1)
 	defer cancel()
 
-	convertedChapter, err := converter.ConvertChapter(ctx, chapter, 80, false, false, progress)
+	convertedChapter, err := converter.ConvertChapter(ctx, chapter, &options.ConvertOptions{Quality: 80}, progress)
 
 	// Should return context error due to timeout
 	assert.Error(t, err)
 	assert.Nil(t, convertedChapter)
 	assert.Equal(t, context.DeadlineExceeded, err)
 }
+
+func TestConverter_ConvertChapter_InvalidOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		options options.ConvertOptions
+	}{
+		{name: "Future version", options: options.ConvertOptions{Version: options.Version + 1, Quality: 80}},
+		{name: "Crop taller than split height", options: options.ConvertOptions{Quality: 80, MaxHeight: 1000, CropHeight: 1500}},
+		{name: "Effort too high", options: options.ConvertOptions{Quality: 80, Effort: options.MaxEffort + 1}},
+		{name: "Unknown preset", options: options.ConvertOptions{Quality: 80, WebP: options.WebPTuning{Preset: "manga"}}},
+		{name: "Near lossless above 100", options: options.ConvertOptions{Quality: 80, WebP: options.WebPTuning{NearLossless: nearLossless(101)}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			converter := New()
+			chapter := &manga.Chapter{Pages: []*manga.Page{createTestPage(t, 1, 100, 100, "png")}}
+
+			convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, &tt.options, func(string, uint32, uint32) {})
+			assert.Error(t, err)
+			assert.Nil(t, convertedChapter)
+		})
+	}
+}
+
+func TestConverter_withOptions(t *testing.T) {
+	converter := New()
+
+	configured := converter.withOptions(&options.ConvertOptions{MaxHeight: 3000, CropHeight: 1000, Effort: options.MaxEffort})
+	assert.Equal(t, 3000, configured.maxHeight)
+	assert.Equal(t, 1000, configured.cropHeight)
+	assert.Equal(t, 6, configured.method)
+
+	// The shared converter keeps its defaults
+	assert.Equal(t, 4000, converter.maxHeight)
+	assert.Equal(t, 2000, converter.cropHeight)
+	assert.Equal(t, DefaultMethod, converter.method)
+}
+
+// recordingBackend keeps the options of each encode and delegates the encoding to the go backend.
+type recordingBackend struct {
+	mutex   sync.Mutex
+	tuning  bool
+	options []EncodeOptions
+	images  []image.Image
+}
+
+func (b *recordingBackend) Name() string {
+	return "recording"
+}
+
+func (b *recordingBackend) Prepare() error {
+	return nil
+}
+
+func (b *recordingBackend) SupportsTuning() bool {
+	return b.tuning
+}
+
+func (b *recordingBackend) Encode(w io.Writer, m image.Image, options EncodeOptions) error {
+	b.mutex.Lock()
+	b.options = append(b.options, options)
+	b.images = append(b.images, m)
+	b.mutex.Unlock()
+	return (&goBackend{}).Encode(w, m, EncodeOptions{Quality: options.Quality, Lossless: options.Lossless, Method: options.Method})
+}
+
+// useBackends replaces the registered backends for the duration of the test.
+func useBackends(t *testing.T, name string, registered ...Backend) {
+	previous := backends
+	backends = registered
+	resetBackends()
+	require.NoError(t, SetBackend(name))
+	t.Cleanup(func() {
+		require.NoError(t, SetBackend(AutoBackend))
+		backends = previous
+		resetBackends()
+	})
+}
+
+// resetBackends drops the prepared backends, picked among the registered ones.
+func resetBackends() {
+	backendMutex.Lock()
+	defer backendMutex.Unlock()
+	currentBackend = nil
+	tuningBackend = nil
+}
+
+func TestConverter_ConvertChapter_SplitHeights(t *testing.T) {
+	tests := []struct {
+		name          string
+		options       options.ConvertOptions
+		expectedParts int
+		maxPartHeight int
+	}{
+		{name: "Default heights", options: options.ConvertOptions{Quality: 80, Split: true}, expectedParts: 1, maxPartHeight: 1800},
+		{name: "Custom split and crop heights", options: options.ConvertOptions{Quality: 80, Split: true, MaxHeight: 1000, CropHeight: 500}, expectedParts: 4, maxPartHeight: 500},
+		{name: "Crop height capped by split height", options: options.ConvertOptions{Quality: 80, Split: true, MaxHeight: 1000}, expectedParts: 2, maxPartHeight: 1000},
+		{name: "Custom heights without split", options: options.ConvertOptions{Quality: 80, MaxHeight: 1000, CropHeight: 500}, expectedParts: 1, maxPartHeight: 1800},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			converter := New()
+			chapter := &manga.Chapter{Pages: []*manga.Page{createTestPage(t, 0, 100, 1800, "png")}}
+
+			convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, &tt.options, func(string, uint32, uint32) {})
+			require.NoError(t, err)
+			require.Len(t, convertedChapter.Pages, tt.expectedParts)
+			for _, page := range convertedChapter.Pages {
+				img, _, err := image.Decode(bytes.NewReader(page.Contents.Bytes()))
+				require.NoError(t, err)
+				assert.LessOrEqual(t, img.Bounds().Dy(), tt.maxPartHeight)
+			}
+		})
+	}
+}
+
+func TestConverter_ConvertChapter_SmartSplit(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 1800))
+	for y := 0; y < 1800; y++ {
+		for x := 0; x < 100; x++ {
+			c := color.RGBA{R: uint8(x * 255 / 100), G: uint8(y * 255 / 1800), B: 100, A: 255}
+			if y >= 430 && y < 470 {
+				c = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	buf, ext, err := encodeImage(img, "png")
+	require.NoError(t, err)
+
+	tests := []struct {
+		mode     options.SplitMode
+		expected []int
+	}{
+		{mode: options.SplitFixed, expected: []int{500, 500, 500, 300}},
+		{mode: options.SplitSmart, expected: []int{450, 500, 500, 350}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			chapter := &manga.Chapter{Pages: []*manga.Page{{Index: 0, Contents: bytes.NewBuffer(buf.Bytes()), Extension: ext, Size: uint64(buf.Len())}}}
+			convertedChapter, err := New().ConvertChapter(context.Background(), chapter, &options.ConvertOptions{
+				Quality:    80,
+				Split:      true,
+				SplitMode:  tt.mode,
+				MaxHeight:  1000,
+				CropHeight: 500,
+			}, func(string, uint32, uint32) {})
+			require.NoError(t, err)
+
+			heights := make([]int, len(convertedChapter.Pages))
+			for i, page := range convertedChapter.Pages {
+				decoded, _, err := image.Decode(bytes.NewReader(page.Contents.Bytes()))
+				require.NoError(t, err)
+				heights[i] = decoded.Bounds().Dy()
+			}
+			assert.Equal(t, tt.expected, heights)
+		})
+	}
+}
+
+func TestConverter_ConvertChapter_Stitch(t *testing.T) {
+	chapter := &manga.Chapter{Pages: []*manga.Page{
+		createTestPage(t, 0, 100, 600, "png"),
+		createTestPage(t, 1, 100, 600, "jpeg"),
+		createTestPage(t, 2, 100, 600, "png"),
+		createTestPage(t, 3, 100, 600, "png"),
+		createTestPage(t, 4, 80, 300, "png"),
+	}}
+
+	var lastTotal uint32
+	convertedChapter, err := New().ConvertChapter(context.Background(), chapter, &options.ConvertOptions{
+		Quality:    80,
+		Stitch:     true,
+		CropHeight: 1000,
+	}, func(_ string, _ uint32, total uint32) {
+		lastTotal = total
+	})
+	require.NoError(t, err)
+	require.Len(t, convertedChapter.Pages, 4)
+	assert.Equal(t, uint32(4), lastTotal)
+
+	expected := []struct {
+		index     uint16
+		splitted  bool
+		partIndex uint16
+		height    int
+	}{
+		{index: 0, splitted: true, partIndex: 0, height: 1000},
+		{index: 0, splitted: true, partIndex: 1, height: 1000},
+		{index: 0, splitted: true, partIndex: 2, height: 400},
+		{index: 4, splitted: false, partIndex: 0, height: 300},
+	}
+	for i, page := range convertedChapter.Pages {
+		assert.Equal(t, expected[i].index, page.Index)
+		assert.Equal(t, expected[i].splitted, page.IsSplitted)
+		assert.Equal(t, expected[i].partIndex, page.SplitPartIndex)
+		assert.Equal(t, ".webp", page.Extension)
+		validateConvertedImage(t, page)
+
+		img, _, err := image.Decode(bytes.NewReader(page.Contents.Bytes()))
+		require.NoError(t, err)
+		assert.Equal(t, expected[i].height, img.Bounds().Dy())
+	}
+}
+
+func TestConverter_ConvertChapter_Spreads(t *testing.T) {
+	tests := []struct {
+		name            string
+		spreads         options.SpreadMode
+		expectedPages   []string
+		expectedWidth   []int
+		expectedMarking bool
+	}{
+		{name: "Keep", spreads: options.SpreadKeep, expectedPages: []string{"0", "1", "2"}, expectedWidth: []int{100, 300, 100}},
+		{name: "Split", spreads: options.SpreadSplitRTL, expectedPages: []string{"0", "1-0", "1-1", "2"}, expectedWidth: []int{100, 150, 150, 100}},
+		{name: "Rotate", spreads: options.SpreadRotate, expectedPages: []string{"0", "1", "2"}, expectedWidth: []int{100, 200, 100}},
+		{name: "Mark", spreads: options.SpreadMark, expectedPages: []string{"0", "1", "2"}, expectedWidth: []int{100, 300, 100}, expectedMarking: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chapter := &manga.Chapter{Pages: []*manga.Page{
+				createTestPage(t, 0, 100, 150, "png"),
+				createTestPage(t, 1, 300, 200, "jpeg"),
+				createTestPage(t, 2, 100, 150, "png"),
+			}}
+
+			convertedChapter, err := New().ConvertChapter(context.Background(), chapter, &options.ConvertOptions{Quality: 80, Spreads: tt.spreads}, func(string, uint32, uint32) {})
+			require.NoError(t, err)
+			require.Len(t, convertedChapter.Pages, len(tt.expectedPages))
+
+			for i, page := range convertedChapter.Pages {
+				name := fmt.Sprintf("%d", page.Index)
+				if page.IsSplitted {
+					name = fmt.Sprintf("%d-%d", page.Index, page.SplitPartIndex)
+				}
+				assert.Equal(t, tt.expectedPages[i], name)
+				validateConvertedImage(t, page)
+
+				img, _, err := image.Decode(bytes.NewReader(page.Contents.Bytes()))
+				require.NoError(t, err)
+				assert.Equal(t, tt.expectedWidth[i], img.Bounds().Dx())
+			}
+
+			if tt.expectedMarking {
+				assert.Contains(t, convertedChapter.ComicInfoXml, `<Page Image="1" DoublePage="true" />`)
+			} else {
+				assert.Empty(t, convertedChapter.ComicInfoXml)
+			}
+		})
+	}
+}
+
+func TestConverter_ConvertChapter_SpreadsAfterSplitPage(t *testing.T) {
+	chapter := &manga.Chapter{
+		Pages: []*manga.Page{
+			createTestPage(t, 0, 100, 5000, "png"),
+			createTestPage(t, 1, 300, 200, "jpeg"),
+			createTestPage(t, 2, 100, 150, "png"),
+		},
+		ComicInfoXml: `<?xml version="1.0"?>
+<ComicInfo>
+  <Pages>
+    <Page Image="0" Type="FrontCover" />
+    <Page Image="1" />
+    <Page Image="2" Type="BackCover" />
+  </Pages>
+</ComicInfo>`,
+	}
+
+	convertedChapter, err := New().ConvertChapter(context.Background(), chapter, &options.ConvertOptions{Quality: 80, Split: true, Spreads: options.SpreadMark}, func(string, uint32, uint32) {})
+	require.NoError(t, err)
+
+	// The tall page is split in parts, which shifts the spread
+	spread := slices.IndexFunc(convertedChapter.Pages, func(page *manga.Page) bool { return page.Index == 1 })
+	require.Greater(t, spread, 1)
+	assert.True(t, convertedChapter.Pages[spread].IsDoublePage)
+	assert.Contains(t, convertedChapter.ComicInfoXml, `<Page Image="0" Type="FrontCover" />`)
+	assert.Contains(t, convertedChapter.ComicInfoXml, fmt.Sprintf(`<Page DoublePage="true" Image="%d" />`, spread))
+	assert.Contains(t, convertedChapter.ComicInfoXml, fmt.Sprintf(`<Page Image="%d" Type="BackCover" />`, spread+1))
+	assert.NotContains(t, convertedChapter.ComicInfoXml, `<Page Image="1" />`)
+}
+
+func TestConverter_ConvertChapter_Resize(t *testing.T) {
+	chapter := &manga.Chapter{Pages: []*manga.Page{
+		createTestPage(t, 0, 400, 600, "png"),
+		createTestPage(t, 1, 400, 600, "webp"),
+		createTestPage(t, 2, 100, 150, "png"),
+	}}
+
+	convertedChapter, err := New().ConvertChapter(context.Background(), chapter, &options.ConvertOptions{
+		Quality: 80,
+		Resize:  options.Resize{Width: 200, Height: 1000},
+	}, func(string, uint32, uint32) {})
+	require.NoError(t, err)
+	require.Len(t, convertedChapter.Pages, 3)
+
+	// WebP pages are encoded again once resized, smaller pages are left as is
+	expected := []image.Point{image.Pt(200, 300), image.Pt(200, 300), image.Pt(100, 150)}
+	for i, page := range convertedChapter.Pages {
+		validateConvertedImage(t, page)
+		img, _, err := image.Decode(bytes.NewReader(page.Contents.Bytes()))
+		require.NoError(t, err)
+		assert.Equal(t, expected[i], img.Bounds().Size())
+		assert.Equal(t, i < 2, page.IsModified)
+	}
+}
+
+func TestConverter_ConvertChapter_Trim(t *testing.T) {
+	// Art with a white scanner border around it
+	scan := image.NewRGBA(image.Rect(0, 0, 400, 600))
+	draw.Draw(scan, scan.Bounds(), image.White, image.Point{}, draw.Src)
+	art, err := createTestImage(360, 540, "png")
+	require.NoError(t, err)
+	draw.Draw(scan, image.Rect(20, 30, 380, 570), art, image.Point{}, draw.Src)
+	buf, ext, err := encodeImage(scan, "png")
+	require.NoError(t, err)
+
+	chapter := &manga.Chapter{Pages: []*manga.Page{
+		{Index: 0, Contents: buf, Extension: ext, Size: uint64(buf.Len())},
+		createTestPage(t, 1, 400, 600, "png"),
+	}}
+
+	convertedChapter, err := New().ConvertChapter(context.Background(), chapter, &options.ConvertOptions{
+		Quality: 80,
+		Trim:    options.Trim{Enabled: true},
+	}, func(string, uint32, uint32) {})
+	require.NoError(t, err)
+	require.Len(t, convertedChapter.Pages, 2)
+
+	// The full bleed page is left alone
+	expected := []image.Point{image.Pt(360, 540), image.Pt(400, 600)}
+	for i, page := range convertedChapter.Pages {
+		validateConvertedImage(t, page)
+		img, _, err := image.Decode(bytes.NewReader(page.Contents.Bytes()))
+		require.NoError(t, err)
+		assert.Equal(t, expected[i], img.Bounds().Size())
+		assert.Equal(t, i == 0, page.IsModified)
+	}
+}
+
+func TestConverter_ConvertChapter_Metadata(t *testing.T) {
+	var pages []*manga.Page
+	for i, name := range []string{"page_orientation6.jpeg", "page_cmyk.jpeg", "page_adobe_rgb.jpeg"} {
+		data, err := os.ReadFile(filepath.Join("..", "pipeline", "testdata", name))
+		require.NoError(t, err)
+		pages = append(pages, &manga.Page{Index: uint16(i), Contents: bytes.NewBuffer(data), Extension: ".jpeg", Size: uint64(len(data))})
+	}
+	chapter := &manga.Chapter{Pages: pages}
+
+	convertedChapter, err := New().ConvertChapter(context.Background(), chapter, &options.ConvertOptions{Quality: 80}, func(string, uint32, uint32) {})
+	require.NoError(t, err)
+	require.Len(t, convertedChapter.Pages, 3)
+
+	// The rotated page is turned upright, all of them are in RGB
+	for _, page := range convertedChapter.Pages {
+		validateConvertedImage(t, page)
+		img, _, err := image.Decode(bytes.NewReader(page.Contents.Bytes()))
+		require.NoError(t, err)
+		assert.Equal(t, image.Pt(150, 103), img.Bounds().Size(), "page %d", page.Index)
+		assert.NotEqual(t, color.CMYKModel, img.ColorModel())
+		assert.True(t, page.IsModified)
+	}
+}
+
+func TestConverter_ConvertChapter_Animations(t *testing.T) {
+	var animated bytes.Buffer
+	require.NoError(t, gif.EncodeAll(&animated, &gif.GIF{
+		Image: []*image.Paletted{
+			image.NewPaletted(image.Rect(0, 0, 64, 64), color.Palette{color.Black, color.White}),
+			image.NewPaletted(image.Rect(0, 0, 64, 64), color.Palette{color.White, color.Black}),
+		},
+		Delay: []int{20, 20},
+	}))
+	original := bytes.Clone(animated.Bytes())
+
+	for _, mode := range []options.AnimationMode{options.AnimationKeep, options.AnimationConvert} {
+		t.Run(string(mode), func(t *testing.T) {
+			chapter := &manga.Chapter{Pages: []*manga.Page{
+				{Index: 0, Contents: bytes.NewBuffer(original), Extension: ".gif", Size: uint64(len(original))},
+				createTestPage(t, 1, 100, 100, "png"),
+			}}
+
+			convertedChapter, err := New().ConvertChapter(context.Background(), chapter, &options.ConvertOptions{
+				Quality:    80,
+				Animations: mode,
+			}, func(string, uint32, uint32) {})
+			require.NoError(t, err)
+			require.Len(t, convertedChapter.Pages, 2)
+			assert.Equal(t, ".webp", convertedChapter.Pages[1].Extension)
+
+			page := convertedChapter.Pages[0]
+			if mode == options.AnimationKeep {
+				assert.Equal(t, ".gif", page.Extension)
+				assert.Equal(t, original, page.Contents.Bytes())
+				return
+			}
+			assert.Equal(t, ".webp", page.Extension)
+			animation, err := gowebp.DecodeAll(bytes.NewReader(page.Contents.Bytes()))
+			require.NoError(t, err)
+			assert.Len(t, animation.Image, 2)
+			assert.Equal(t, []int{200, 200}, animation.Delay)
+		})
+	}
+}
+
+func TestConverter_ConvertChapter_Adjust(t *testing.T) {
+	recorder := &recordingBackend{}
+	useBackends(t, recorder.Name(), recorder)
+
+	// Grey paper with a band of faded ink
+	scan := image.NewGray(image.Rect(0, 0, 100, 100))
+	for i := range scan.Pix {
+		scan.Pix[i] = 190
+	}
+	for i := 0; i < 1000; i++ {
+		scan.Pix[i] = 70
+	}
+	buf, ext, err := encodeImage(scan, "png")
+	require.NoError(t, err)
+	chapter := &manga.Chapter{Pages: []*manga.Page{{Index: 0, Contents: buf, Extension: ext, Size: uint64(buf.Len())}}}
+
+	convertedChapter, err := New().ConvertChapter(context.Background(), chapter, &options.ConvertOptions{
+		Quality: 80,
+		Adjust:  options.Adjust{AutoLevels: true},
+	}, func(string, uint32, uint32) {})
+	require.NoError(t, err)
+	require.Len(t, convertedChapter.Pages, 1)
+	validateConvertedImage(t, convertedChapter.Pages[0])
+	assert.True(t, convertedChapter.Pages[0].IsModified)
+
+	require.Len(t, recorder.images, 1)
+	encoded := recorder.images[0]
+	assert.Equal(t, color.Gray{Y: 0}, color.GrayModel.Convert(encoded.At(0, 0)), "faded ink is encoded black")
+	assert.Equal(t, color.Gray{Y: 255}, color.GrayModel.Convert(encoded.At(50, 50)), "grey paper is encoded white")
+}
+
+func TestConverter_ConvertChapter_Grayscale(t *testing.T) {
+	recorder := &recordingBackend{}
+	useBackends(t, recorder.Name(), recorder)
+
+	// A black and white scan saved as RGB JPEG, next to a color page
+	scan := image.NewRGBA(image.Rect(0, 0, 200, 300))
+	for y := 0; y < 300; y++ {
+		for x := 0; x < 200; x++ {
+			level := uint8(x)
+			scan.Set(x, y, color.RGBA{R: level, G: level, B: level, A: 255})
+		}
+	}
+	buf, ext, err := encodeImage(scan, "jpeg")
+	require.NoError(t, err)
+	chapter := &manga.Chapter{Pages: []*manga.Page{
+		{Index: 0, Contents: buf, Extension: ext, Size: uint64(buf.Len())},
+		createTestPage(t, 1, 200, 300, "jpeg"),
+	}}
+
+	convertedChapter, err := New().ConvertChapter(context.Background(), chapter, &options.ConvertOptions{Quality: 80, Grayscale: true}, func(string, uint32, uint32) {})
+	require.NoError(t, err)
+	require.Len(t, convertedChapter.Pages, 2)
+	for _, page := range convertedChapter.Pages {
+		validateConvertedImage(t, page)
+	}
+
+	require.Len(t, recorder.images, 2)
+	grayPages := 0
+	for _, img := range recorder.images {
+		if _, ok := img.(*image.Gray); ok {
+			grayPages++
+		}
+	}
+	assert.Equal(t, 1, grayPages, "only the scan should be encoded as grayscale")
+}
+
+func TestConverter_ConvertChapter_GrayLevels(t *testing.T) {
+	recorder := &recordingBackend{}
+	useBackends(t, recorder.Name(), recorder)
+
+	gradient := image.NewGray(image.Rect(0, 0, 256, 64))
+	for i := range gradient.Pix {
+		gradient.Pix[i] = uint8(i % 256)
+	}
+	buf, ext, err := encodeImage(gradient, "png")
+	require.NoError(t, err)
+	chapter := &manga.Chapter{Pages: []*manga.Page{
+		{Index: 0, Contents: buf, Extension: ext, Size: uint64(buf.Len())},
+		createTestPage(t, 1, 256, 64, "png"),
+	}}
+
+	convertedChapter, err := New().ConvertChapter(context.Background(), chapter, &options.ConvertOptions{
+		Lossless:   true,
+		GrayLevels: 16,
+	}, func(string, uint32, uint32) {})
+	require.NoError(t, err)
+	require.Len(t, convertedChapter.Pages, 2)
+
+	var quantized *image.Gray
+	for _, img := range recorder.images {
+		if gray, ok := img.(*image.Gray); ok {
+			quantized = gray
+		}
+	}
+	require.NotNil(t, quantized, "the grayscale page should be encoded as grayscale")
+	levels := make(map[uint8]bool)
+	for _, value := range quantized.Pix {
+		levels[value] = true
+	}
+	assert.Len(t, levels, 16)
+	assert.True(t, convertedChapter.Pages[0].IsModified)
+	assert.False(t, convertedChapter.Pages[1].IsModified, "color pages are left alone")
+}
+
+func TestConverter_ConvertChapter_Effort(t *testing.T) {
+	tests := []struct {
+		effort         int
+		expectedMethod int
+	}{
+		{effort: 0, expectedMethod: DefaultMethod},
+		{effort: 1, expectedMethod: 0},
+		{effort: 5, expectedMethod: 2},
+		{effort: options.MaxEffort, expectedMethod: 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("effort %d", tt.effort), func(t *testing.T) {
+			recorder := &recordingBackend{}
+			useBackends(t, recorder.Name(), recorder)
+
+			chapter := &manga.Chapter{Pages: []*manga.Page{createTestPage(t, 0, 100, 100, "png")}}
+			_, err := New().ConvertChapter(context.Background(), chapter, &options.ConvertOptions{Quality: 80, Effort: tt.effort}, func(string, uint32, uint32) {})
+			require.NoError(t, err)
+
+			require.Len(t, recorder.options, 1)
+			assert.Equal(t, tt.expectedMethod, recorder.options[0].Method)
+		})
+	}
+}
+
+func TestConverter_ConvertChapter_Tuning(t *testing.T) {
+	tuning := options.WebPTuning{Preset: "drawing", SharpYUV: true, AutoFilter: true, NearLossless: nearLossless(60)}
+
+	t.Run("Tuning is given to the backend", func(t *testing.T) {
+		recorder := &recordingBackend{tuning: true}
+		useBackends(t, AutoBackend, &goBackend{}, recorder)
+
+		chapter := &manga.Chapter{Pages: []*manga.Page{createTestPage(t, 0, 100, 100, "png")}}
+		_, err := New().ConvertChapter(context.Background(), chapter, &options.ConvertOptions{Quality: 80, WebP: tuning}, func(string, uint32, uint32) {})
+		require.NoError(t, err)
+
+		// Auto mode encodes the tuned pages with the first backend supporting tuning
+		require.Len(t, recorder.options, 1)
+		assert.Equal(t, tuning, recorder.options[0].Tuning)
+	})
+
+	t.Run("Backend without tuning support is rejected", func(t *testing.T) {
+		useBackends(t, "go", &goBackend{})
+
+		chapter := &manga.Chapter{Pages: []*manga.Page{createTestPage(t, 0, 100, 100, "png")}}
+		convertedChapter, err := New().ConvertChapter(context.Background(), chapter, &options.ConvertOptions{Quality: 80, WebP: tuning}, func(string, uint32, uint32) {})
+		assert.Error(t, err)
+		assert.Nil(t, convertedChapter)
+	})
+
+	t.Run("Prepared backend without tuning support is kept", func(t *testing.T) {
+		recorder := &recordingBackend{tuning: true}
+		useBackends(t, AutoBackend, &goBackend{}, recorder)
+		require.NoError(t, PrepareEncoder())
+
+		chapter := &manga.Chapter{Pages: []*manga.Page{createTestPage(t, 0, 100, 100, "png")}}
+		_, err := New().ConvertChapter(context.Background(), chapter, &options.ConvertOptions{Quality: 80, WebP: tuning}, func(string, uint32, uint32) {})
+		require.NoError(t, err)
+		// The chapters converted in parallel keep the backend they were prepared with
+		assert.Equal(t, "go", CurrentBackend())
+
+		_, err = New().ConvertChapter(context.Background(), chapter, &options.ConvertOptions{Quality: 80}, func(string, uint32, uint32) {})
+		require.NoError(t, err)
+		assert.Len(t, recorder.options, 1, "a chapter without tuning uses the prepared backend")
+	})
+
+	t.Run("Auto mode without a backend supporting tuning fails", func(t *testing.T) {
+		useBackends(t, AutoBackend, &goBackend{})
+
+		chapter := &manga.Chapter{Pages: []*manga.Page{createTestPage(t, 0, 100, 100, "png")}}
+		convertedChapter, err := New().ConvertChapter(context.Background(), chapter, &options.ConvertOptions{Quality: 80, WebP: tuning}, func(string, uint32, uint32) {})
+		assert.ErrorContains(t, err, "no webp encoder backend supporting the webp tuning options")
+		assert.Nil(t, convertedChapter)
+	})
+
+	t.Run("Encoding with tuning on an unsupported backend fails", func(t *testing.T) {
+		useBackends(t, "go", &goBackend{})
+		require.NoError(t, PrepareEncoder())
+
+		img, err := createTestImage(10, 10, "png")
+		require.NoError(t, err)
+		assert.Error(t, EncodeWithOptions(&bytes.Buffer{}, img, EncodeOptions{Quality: 80, Method: DefaultMethod, Tuning: tuning}))
+	})
+}
+
+func TestCwebpArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  EncodeOptions
+		expected [][]string
+	}{
+		{
+			name:     "Method only",
+			options:  EncodeOptions{Quality: 80, Method: 5},
+			expected: [][]string{{"-m", "5"}},
+		},
+		{
+			name:    "All tuning options",
+			options: EncodeOptions{Quality: 80, Method: 6, Tuning: options.WebPTuning{Preset: "drawing", SharpYUV: true, AutoFilter: true, NearLossless: nearLossless(60)}},
+			expected: [][]string{
+				{"-preset", "drawing"},
+				{"-m", "6"},
+				{"-sharp_yuv"},
+				{"-af"},
+				{"-near_lossless", "60"},
+			},
+		},
+		{
+			name:     "Strongest near lossless",
+			options:  EncodeOptions{Quality: 80, Method: 4, Tuning: options.WebPTuning{NearLossless: nearLossless(0)}},
+			expected: [][]string{{"-m", "4"}, {"-near_lossless", "0"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, cwebpArgs(tt.options))
+		})
+	}
+}
+
+// nearLossless returns an options.WebPTuning.NearLossless level.
+func nearLossless(level int) *int {
+	return &level
+}
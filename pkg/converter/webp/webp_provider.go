@@ -1,29 +1,208 @@
 package webp
 
 import (
+	"errors"
+	"fmt"
 	"image"
 	"io"
+	"strings"
+	"sync"
 
-	"github.com/danielkitchener/go-webpbin/v2"
+	"github.com/danielkitchener/CBZOptimizer/v2/internal/manga"
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/options"
+	gowebp "github.com/gen2brain/webp"
+	"github.com/rs/zerolog/log"
 )
 
-const libwebpVersion = "1.6.0"
+// AutoBackend lets PrepareEncoder pick the first backend that can be used.
+const AutoBackend = "auto"
 
+// DefaultMethod is the compression method used when none is given, like cwebp.
+const DefaultMethod = 4
+
+// EncodeOptions holds the encoder settings.
+type EncodeOptions struct {
+	Quality  uint
+	Lossless bool
+	// Method trades encoding speed for size, from 0 (fastest) to 6 (smallest).
+	Method int
+	// Tuning is only supported by some backends, see PrepareTuning.
+	Tuning options.WebPTuning
+}
+
+// Backend encodes images to the WebP format.
+type Backend interface {
+	// Name identifies the backend when selecting it.
+	Name() string
+	// Prepare makes sure the backend can be used, downloading or loading what it needs.
+	Prepare() error
+	// SupportsTuning tells if Encode applies EncodeOptions.Tuning.
+	SupportsTuning() bool
+	Encode(w io.Writer, m image.Image, options EncodeOptions) error
+}
+
+// backends in order of preference. The cgo backend is registered first when built with the libwebp tag.
+var backends = []Backend{&goBackend{}, &cwebpBackend{}}
+
+var (
+	backendMutex     sync.Mutex
+	requestedBackend = AutoBackend
+	currentBackend   Backend
+	// tuningBackend encodes the images with EncodeOptions.Tuning in auto mode when currentBackend doesn't support it.
+	tuningBackend Backend
+)
+
+// Backends returns the names of the available backends, in order of preference.
+func Backends() []string {
+	names := make([]string, 0, len(backends))
+	for _, backend := range backends {
+		names = append(names, backend.Name())
+	}
+	return names
+}
+
+// SetBackend selects the backend prepared by PrepareEncoder. AutoBackend picks the first one that works.
+func SetBackend(name string) error {
+	name = strings.ToLower(name)
+	if name == "" {
+		name = AutoBackend
+	}
+	if name != AutoBackend && findBackend(name) == nil {
+		return fmt.Errorf("unknown webp encoder backend \"%s\", available options are %s, %s", name, AutoBackend, strings.Join(Backends(), ", "))
+	}
+
+	backendMutex.Lock()
+	defer backendMutex.Unlock()
+	if requestedBackend != name {
+		requestedBackend = name
+		currentBackend = nil
+		tuningBackend = nil
+	}
+	return nil
+}
+
+// CurrentBackend returns the name of the backend chosen by PrepareEncoder, empty if none was prepared yet.
+func CurrentBackend() string {
+	backendMutex.Lock()
+	defer backendMutex.Unlock()
+	if currentBackend == nil {
+		return ""
+	}
+	return currentBackend.Name()
+}
+
+func findBackend(name string) Backend {
+	for _, backend := range backends {
+		if backend.Name() == name {
+			return backend
+		}
+	}
+	return nil
+}
+
+// PrepareEncoder prepares the selected backend, or the first one available in auto mode.
 func PrepareEncoder() error {
-	webpbin.SetLibVersion(libwebpVersion)
-	container := webpbin.NewCWebP()
-	return container.BinWrapper.Run()
+	backendMutex.Lock()
+	defer backendMutex.Unlock()
+
+	if currentBackend != nil {
+		return nil
+	}
+
+	if requestedBackend != AutoBackend {
+		backend := findBackend(requestedBackend)
+		if err := backend.Prepare(); err != nil {
+			return fmt.Errorf("webp encoder backend %s is not available: %w", backend.Name(), err)
+		}
+		currentBackend = backend
+		log.Info().Str("backend", backend.Name()).Msg("Using requested WebP encoder backend")
+		return nil
+	}
+
+	var errList []error
+	for _, backend := range backends {
+		if err := backend.Prepare(); err != nil {
+			log.Debug().Str("backend", backend.Name()).Err(err).Msg("WebP encoder backend not available")
+			errList = append(errList, fmt.Errorf("%s: %w", backend.Name(), err))
+			continue
+		}
+		currentBackend = backend
+		log.Info().Str("backend", backend.Name()).Msg("Selected WebP encoder backend")
+		return nil
+	}
+	return fmt.Errorf("no webp encoder backend available: %w", errors.Join(errList...))
+}
+
+// PrepareTuning prepares PrepareEncoder's backend and makes sure the images with EncodeOptions.Tuning can be
+// encoded. A selected backend must support the tuning, in auto mode the first available backend supporting it
+// encodes them when the prepared one doesn't, the others keep using the prepared one.
+func PrepareTuning() error {
+	if err := PrepareEncoder(); err != nil {
+		return err
+	}
+
+	backendMutex.Lock()
+	defer backendMutex.Unlock()
+
+	if currentBackend == nil || currentBackend.SupportsTuning() || tuningBackend != nil {
+		return nil
+	}
+	if requestedBackend != AutoBackend {
+		return fmt.Errorf("webp encoder backend %s doesn't support the webp tuning options", currentBackend.Name())
+	}
+
+	var errList []error
+	for _, backend := range backends {
+		if !backend.SupportsTuning() {
+			continue
+		}
+		if err := backend.Prepare(); err != nil {
+			log.Debug().Str("backend", backend.Name()).Err(err).Msg("WebP encoder backend not available")
+			errList = append(errList, fmt.Errorf("%s: %w", backend.Name(), err))
+			continue
+		}
+		tuningBackend = backend
+		log.Info().Str("backend", backend.Name()).Msg("Selected WebP encoder backend for the tuning options")
+		return nil
+	}
+	return fmt.Errorf("no webp encoder backend supporting the webp tuning options available: %w", errors.Join(errList...))
 }
+
 func Encode(w io.Writer, m image.Image, quality uint, lossless bool) error {
-	var webp = webpbin.NewCWebP();
+	return EncodeWithOptions(w, m, EncodeOptions{
+		Quality:  quality,
+		Lossless: lossless,
+		Method:   DefaultMethod,
+	})
+}
 
-	if (lossless) {
-		webp.Lossless()
-	} else {
-		webp.Quality(quality)
+func EncodeWithOptions(w io.Writer, m image.Image, options EncodeOptions) error {
+	backendMutex.Lock()
+	backend := currentBackend
+	if !options.Tuning.IsZero() && tuningBackend != nil {
+		backend = tuningBackend
 	}
-	return webp.
-		InputImage(m).
-		Output(w).
-		Run()
+	backendMutex.Unlock()
+
+	if backend == nil {
+		return errors.New("webp encoder is not prepared")
+	}
+	if !options.Tuning.IsZero() && !backend.SupportsTuning() {
+		return fmt.Errorf("webp encoder backend %s doesn't support the webp tuning options", backend.Name())
+	}
+	return backend.Encode(w, m, options)
+}
+
+// EncodeAnimation encodes the frames to an animated WebP file. The animations are always encoded in-process,
+// whatever the selected backend, and without the tuning options.
+func EncodeAnimation(w io.Writer, animation *manga.Animation, options EncodeOptions) error {
+	return gowebp.EncodeAll(w, &gowebp.WEBP{
+		Image:     animation.Frames,
+		Delay:     animation.Delays,
+		LoopCount: animation.LoopCount,
+	}, gowebp.Options{
+		Quality:  int(options.Quality),
+		Lossless: options.Lossless,
+		Method:   options.Method,
+	})
 }
@@ -0,0 +1,87 @@
+package webp
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"github.com/danielkitchener/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetBackend(t *testing.T) {
+	defer func() { require.NoError(t, SetBackend(AutoBackend)) }()
+
+	assert.Error(t, SetBackend("unknown"))
+	assert.NoError(t, SetBackend(""))
+	for _, name := range Backends() {
+		assert.NoError(t, SetBackend(name))
+	}
+	assert.NoError(t, SetBackend("GO"), "backend names are case insensitive")
+}
+
+func TestPrepareEncoder_Auto(t *testing.T) {
+	require.NoError(t, SetBackend(AutoBackend))
+	require.NoError(t, PrepareEncoder())
+
+	// The in-process backend is always available, so auto never ends up without a backend
+	assert.Contains(t, Backends(), CurrentBackend())
+	assert.NotEqual(t, "cwebp", CurrentBackend(), "auto should prefer an in-process backend over spawning cwebp")
+
+	converter := New()
+	require.NoError(t, converter.PrepareConverter())
+	assert.Equal(t, CurrentBackend(), converter.Backend())
+}
+
+func TestBackends_Encode(t *testing.T) {
+	defer func() { require.NoError(t, SetBackend(AutoBackend)) }()
+	img, err := createTestImage(120, 80, "png")
+	require.NoError(t, err)
+
+	for _, name := range Backends() {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, SetBackend(name))
+			if err := PrepareEncoder(); err != nil {
+				t.Skipf("backend %s not available: %v", name, err)
+			}
+			assert.Equal(t, name, CurrentBackend())
+
+			for _, lossless := range []bool{false, true} {
+				var buf bytes.Buffer
+				require.NoError(t, Encode(&buf, img, 80, lossless))
+
+				decoded, format, err := image.Decode(bytes.NewReader(buf.Bytes()))
+				require.NoError(t, err)
+				assert.Equal(t, "webp", format)
+				assert.Equal(t, img.Bounds().Size(), decoded.Bounds().Size())
+			}
+
+			if findBackend(name).SupportsTuning() {
+				var buf bytes.Buffer
+				require.NoError(t, EncodeWithOptions(&buf, img, EncodeOptions{
+					Quality: 80,
+					Method:  DefaultMethod,
+					Tuning:  options.WebPTuning{Preset: "drawing", SharpYUV: true, AutoFilter: true, NearLossless: nearLossless(60)},
+				}))
+				_, format, err := image.Decode(bytes.NewReader(buf.Bytes()))
+				require.NoError(t, err)
+				assert.Equal(t, "webp", format)
+			}
+		})
+	}
+}
+
+func TestEncode_NotPrepared(t *testing.T) {
+	defer func() { require.NoError(t, SetBackend(AutoBackend)) }()
+
+	// Selecting another backend drops the prepared one
+	require.NoError(t, SetBackend(AutoBackend))
+	require.NoError(t, PrepareEncoder())
+	require.NoError(t, SetBackend("cwebp"))
+	assert.Empty(t, CurrentBackend())
+
+	img, err := createTestImage(10, 10, "png")
+	require.NoError(t, err)
+	assert.Error(t, Encode(&bytes.Buffer{}, img, 80, false))
+}